@@ -0,0 +1,330 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+// display writes v as JSON if --json was specified, or using text
+// otherwise.
+func display(fv *CommonFlags, v any, text func(w io.Writer)) error {
+	if fv.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+func onOff(state bool) string {
+	if state {
+		return "on"
+	}
+	return "off"
+}
+
+func timeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func discover(ctx context.Context, values any, _ []string) error {
+	fv := values.(*discoverFlags)
+	ctx = fv.context(ctx)
+	gateways, err := slnet.Discover(ctx, fv.DiscoveryAddr, fv.Timeout)
+	if err != nil {
+		return err
+	}
+	return display(&fv.CommonFlags, gateways, func(w io.Writer) {
+		for _, gw := range gateways {
+			fmt.Fprintf(w, "%v\t%v\ttype %v.%v\n", gw.Name, gw.Addr, gw.Type, gw.Subtype)
+		}
+	})
+}
+
+func version(ctx context.Context, values any, _ []string) error {
+	fv := values.(*CommonFlags)
+	return withClient(ctx, fv, func(ctx context.Context, c *client) error {
+		v, err := protocol.GetVersionInfo(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		return display(fv, struct{ Version string }{v}, func(w io.Writer) {
+			fmt.Fprintln(w, v)
+		})
+	})
+}
+
+func dateTime(ctx context.Context, values any, _ []string) error {
+	fv := values.(*CommonFlags)
+	return withClient(ctx, fv, func(ctx context.Context, c *client) error {
+		t, err := protocol.GetTimeAndDate(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		return display(fv, struct{ Time time.Time }{t}, func(w io.Writer) {
+			fmt.Fprintln(w, t.Format(time.DateTime))
+		})
+	})
+}
+
+func config(ctx context.Context, values any, _ []string) error {
+	fv := values.(*CommonFlags)
+	return withClient(ctx, fv, func(ctx context.Context, c *client) error {
+		cfg, err := protocol.GetControllerConfig(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		return display(fv, cfg, func(w io.Writer) {
+			printConfig(w, cfg)
+		})
+	})
+}
+
+func printConfig(w io.Writer, cfg protocol.ControllerConfig) {
+	units := "F"
+	if cfg.Celsius {
+		units = "C"
+	}
+	fmt.Fprintf(w, "model:\t%v\n", cfg.Model)
+	fmt.Fprintf(w, "id:\t%v\n", cfg.ID)
+	fmt.Fprintf(w, "units:\t%v\n", units)
+	fmt.Fprintf(w, "equipment:\t%#x\n", int(cfg.Equipment))
+	fmt.Fprintf(w, "pumps:\t%v\n", len(cfg.IntelliFlo))
+	fmt.Fprintf(w, "\nID\tNAME\tFUNCTION\tINTERFACE\n")
+	for _, ckt := range cfg.Circuits {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", ckt.ID, ckt.Name, ckt.Function, ckt.Interface)
+	}
+}
+
+func exportDevices(ctx context.Context, values any, _ []string) error {
+	fv := values.(*exportFlags)
+	return withClient(ctx, &fv.CommonFlags, func(ctx context.Context, c *client) error {
+		cfg, err := protocol.GetControllerConfig(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		return screenlogic.ExportDevices(os.Stdout, fv.Controller, cfg)
+	})
+}
+
+func status(ctx context.Context, values any, _ []string) error {
+	fv := values.(*statusFlags)
+	return withClient(ctx, &fv.CommonFlags, func(ctx context.Context, c *client) error {
+		cfg, err := protocol.GetControllerConfig(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		st, err := protocol.GetControllerStatus(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		if err := displayStatus(&fv.CommonFlags, cfg, st); err != nil {
+			return err
+		}
+		if fv.Watch == 0 {
+			return nil
+		}
+		return watchStatus(ctx, &fv.CommonFlags, c, cfg, st, fv.Watch)
+	})
+}
+
+// watchStatus polls for the controller's status and displays it
+// whenever it changes, until the context is canceled.
+func watchStatus(ctx context.Context, fv *CommonFlags, c *client, cfg protocol.ControllerConfig, last protocol.ControllerStatus, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		st, err := protocol.GetControllerStatus(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(st, last) {
+			continue
+		}
+		last = st
+		if !fv.JSON {
+			fmt.Printf("\n--- %v ---\n", time.Now().Format(time.DateTime))
+		}
+		if err := displayStatus(fv, cfg, st); err != nil {
+			return err
+		}
+	}
+}
+
+func displayStatus(fv *CommonFlags, cfg protocol.ControllerConfig, st protocol.ControllerStatus) error {
+	return display(fv, st, func(w io.Writer) {
+		fmt.Fprintf(w, "state:\t%v\n", st.State)
+		if st.FreezeMode {
+			fmt.Fprintf(w, "freeze mode:\tactive\n")
+		}
+		fmt.Fprintf(w, "air temp:\t%v\n", st.AirTemp)
+		for _, b := range st.Bodies {
+			fmt.Fprintf(w, "%v:\t%v, set point %v, heat mode %v, heating %v\n",
+				b.Type, b.CurrentTemp, b.HeatSetPoint, b.HeatMode, b.HeatStatus)
+		}
+		if cfg.Equipment&protocol.IntelliChem != 0 {
+			fmt.Fprintf(w, "chemistry:\tpH %.2f, ORP %v, saturation %.1f, salt %v ppm\n",
+				st.PH, st.ORP, st.Saturation, st.SaltPPM)
+		}
+		fmt.Fprintf(w, "\nID\tNAME\tSTATE\n")
+		for _, cs := range st.Circuits {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", cs.ID, cfg.CircuitName(cs.ID), onOff(cs.State))
+		}
+	})
+}
+
+// findCircuit returns the circuit whose ID or name matches nameOrID,
+// an exact match on the name is preferred to a case insensitive one.
+func findCircuit(cfg protocol.ControllerConfig, nameOrID string) (protocol.Circuit, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		if c := cfg.CircuitByID(id); c.ID == id {
+			return c, nil
+		}
+	}
+	if c := cfg.CircuitBytName(nameOrID); c.ID != 0 {
+		return c, nil
+	}
+	for _, c := range cfg.Circuits {
+		if strings.EqualFold(c.Name, nameOrID) {
+			return c, nil
+		}
+	}
+	return protocol.Circuit{}, fmt.Errorf("unknown circuit: %q", nameOrID)
+}
+
+func circuit(ctx context.Context, values any, args []string) error {
+	fv := values.(*CommonFlags)
+	op := args[0]
+	if op != "on" && op != "off" && op != "toggle" {
+		return fmt.Errorf("unknown operation: %q, must be one of on, off or toggle", op)
+	}
+	return withClient(ctx, fv, func(ctx context.Context, c *client) error {
+		cfg, err := protocol.GetControllerConfig(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		ckt, err := findCircuit(cfg, args[1])
+		if err != nil {
+			return err
+		}
+		state := op == "on"
+		if op == "toggle" {
+			st, err := protocol.GetControllerStatus(ctx, c.session)
+			if err != nil {
+				return err
+			}
+			state = !st.StatusForID(ckt.ID)
+		}
+		if err := protocol.SetCircuitState(ctx, c.session, ckt.ID, state); err != nil {
+			return err
+		}
+		return display(fv, struct {
+			ID    int
+			Name  string
+			State bool
+		}{ckt.ID, ckt.Name, state}, func(w io.Writer) {
+			fmt.Fprintf(w, "%v (%v):\t%v\n", ckt.Name, ckt.ID, onOff(state))
+		})
+	})
+}
+
+func setpoint(ctx context.Context, values any, args []string) error {
+	fv := values.(*setpointFlags)
+	body, err := protocol.ParseBodyType(args[0])
+	if err != nil {
+		return err
+	}
+	temp, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid temperature: %q: %w", args[1], err)
+	}
+	mode := protocol.HeatModeUnchanged
+	if len(fv.Mode) > 0 {
+		if mode, err = protocol.ParseHeatMode(strings.ReplaceAll(fv.Mode, "-", " ")); err != nil {
+			return err
+		}
+	}
+	return withClient(ctx, &fv.CommonFlags, func(ctx context.Context, c *client) error {
+		if err := protocol.SetHeatSetPoint(ctx, c.session, body, temp); err != nil {
+			return err
+		}
+		if mode != protocol.HeatModeUnchanged {
+			if err := protocol.SetHeatMode(ctx, c.session, body, mode); err != nil {
+				return err
+			}
+		}
+		st, err := protocol.GetControllerStatus(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		bs, _ := st.Body(body)
+		return display(&fv.CommonFlags, bs, func(w io.Writer) {
+			fmt.Fprintf(w, "%v:\t%v, set point %v, heat mode %v, heating %v\n",
+				bs.Type, bs.CurrentTemp, bs.HeatSetPoint, bs.HeatMode, bs.HeatStatus)
+		})
+	})
+}
+
+func light(ctx context.Context, values any, args []string) error {
+	fv := values.(*CommonFlags)
+	mode, err := protocol.ParseColorMode(strings.ReplaceAll(args[0], "-", " "))
+	if err != nil {
+		return err
+	}
+	return withClient(ctx, fv, func(ctx context.Context, c *client) error {
+		if err := protocol.SendLightCommand(ctx, c.session, mode); err != nil {
+			return err
+		}
+		return display(fv, struct{ Command string }{mode.String()}, func(w io.Writer) {
+			fmt.Fprintf(w, "lights:\t%v\n", mode)
+		})
+	})
+}
+
+func schedules(ctx context.Context, values any, _ []string) error {
+	fv := values.(*schedulesFlags)
+	st := protocol.ScheduleRecurring
+	if fv.RunOnce {
+		st = protocol.ScheduleRunOnce
+	}
+	return withClient(ctx, &fv.CommonFlags, func(ctx context.Context, c *client) error {
+		cfg, err := protocol.GetControllerConfig(ctx, c.session)
+		if err != nil {
+			return err
+		}
+		scheds, err := protocol.GetSchedules(ctx, c.session, st)
+		if err != nil {
+			return err
+		}
+		return display(&fv.CommonFlags, scheds, func(w io.Writer) {
+			fmt.Fprintf(w, "ID\tCIRCUIT\tSTART\tSTOP\tDAYS\n")
+			for _, s := range scheds {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", s.ID, cfg.CircuitName(s.CircuitID),
+					timeOfDay(s.Start), timeOfDay(s.Stop), s.Days)
+			}
+		})
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command screenlogic queries and controls screenlogic gateways directly,
+// without requiring an automation deployment.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/net/streamconn"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+const spec = `name: screenlogic
+summary: |
+  query and control screenlogic gateways on the local network. If --addr
+  is not specified the first gateway that responds to a discovery request
+  is used.
+commands:
+  - name: discover
+    summary: list the gateways that respond to a discovery request
+  - name: version
+    summary: display the gateway's firmware version
+  - name: time
+    summary: display the controller's date and time
+  - name: config
+    summary: display the controller's configuration and circuits
+  - name: status
+    summary: |
+      display the controller's status, use --watch to poll for and display
+      changes
+  - name: circuit
+    summary: turn a circuit on or off, or toggle its current state
+    arguments:
+      - on|off|toggle
+      - <name-or-id> - the circuit's name, ignoring case, or its numeric ID
+  - name: setpoint
+    summary: set the heat set point, and optionally the heat mode, for a body
+    arguments:
+      - <body> - pool or spa
+      - <temperature>
+  - name: light
+    summary: send a command to the color lights
+    arguments:
+      - <command> - eg. all-on, all-off, party, caribbean or sync
+  - name: schedules
+    summary: display the recurring, or run once, schedules
+  - name: exportdevices
+    summary: |
+      write a devices: configuration for the controller's circuits, lights,
+      bodies and pumps
+`
+
+type CommonFlags struct {
+	Addr    string        `subcmd:"addr,,'gateway address, if not specified the gateway is discovered'"`
+	Timeout time.Duration `subcmd:"timeout,5s,timeout for discovery and for each request"`
+	JSON    bool          `subcmd:"json,false,display output as JSON"`
+	Verbose bool          `subcmd:"verbose,false,log protocol messages to stderr"`
+}
+
+type discoverFlags struct {
+	CommonFlags
+	DiscoveryAddr string `subcmd:"discovery-addr,255.255.255.255:1444,address to send discovery requests to"`
+}
+
+type statusFlags struct {
+	CommonFlags
+	Watch time.Duration `subcmd:"watch,0s,'if non-zero, poll for the status at this interval and display it whenever it changes'"`
+}
+
+type setpointFlags struct {
+	CommonFlags
+	Mode string `subcmd:"mode,,'heat mode to set: off, solar, solar-preferred or heater'"`
+}
+
+type exportFlags struct {
+	CommonFlags
+	Controller string `subcmd:"controller,screenlogic,name of the controller that the devices refer to"`
+}
+
+type schedulesFlags struct {
+	CommonFlags
+	RunOnce bool `subcmd:"run-once,false,display the run once rather than the recurring schedules"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("discover").MustRunner(discover, &discoverFlags{})
+	cmdSet.Set("version").MustRunner(version, &CommonFlags{})
+	cmdSet.Set("time").MustRunner(dateTime, &CommonFlags{})
+	cmdSet.Set("config").MustRunner(config, &CommonFlags{})
+	cmdSet.Set("status").MustRunner(status, &statusFlags{})
+	cmdSet.Set("circuit").MustRunner(circuit, &CommonFlags{})
+	cmdSet.Set("setpoint").MustRunner(setpoint, &setpointFlags{})
+	cmdSet.Set("light").MustRunner(light, &CommonFlags{})
+	cmdSet.Set("schedules").MustRunner(schedules, &schedulesFlags{})
+	cmdSet.Set("exportdevices").MustRunner(exportDevices, &exportFlags{})
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cmdSet.MustDispatch(ctx)
+}
+
+func (fv *CommonFlags) context(ctx context.Context) context.Context {
+	if fv.Verbose {
+		return ctxlog.NewJSONLogger(ctx, os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return ctx
+}
+
+type noIdle struct{}
+
+func (noIdle) Reset(context.Context) {}
+
+// client represents a logged in connection to a gateway.
+type client struct {
+	conn    *slnet.Conn
+	session *protocol.Session
+}
+
+// connect connects and logs in to the gateway specified by --addr, or to
+// the first gateway found by discovery.
+func connect(ctx context.Context, fv *CommonFlags) (*client, error) {
+	addr := fv.Addr
+	if len(addr) == 0 {
+		gateways, err := slnet.Discover(ctx, slnet.DiscoveryAddr, fv.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		if len(gateways) == 0 {
+			return nil, fmt.Errorf("no gateways found, use --addr to specify one")
+		}
+		addr = gateways[0].Addr.String()
+	}
+	conn, err := slnet.Dial(ctx, addr, fv.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	var mgr streamconn.SessionManager
+	session := protocol.NewSession(mgr.New(conn, noIdle{}))
+	if err := protocol.Login(ctx, session); err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("%v: %w", addr, err)
+	}
+	return &client{conn: conn, session: session}, nil
+}
+
+func (c *client) Close(ctx context.Context) error {
+	c.session.Release()
+	return c.conn.Close(ctx)
+}
+
+// withClient connects to the gateway and calls fn.
+func withClient(ctx context.Context, fv *CommonFlags, fn func(context.Context, *client) error) error {
+	ctx = fv.context(ctx)
+	c, err := connect(ctx, fv)
+	if err != nil {
+		return err
+	}
+	defer c.Close(ctx)
+	return fn(ctx, c)
+}
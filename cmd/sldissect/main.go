@@ -0,0 +1,89 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command sldissect decodes screenlogic protocol exchanges captured
+// using tcpdump (or similar) or provided as textual hex dumps.
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"github.com/cosnicolaou/pentair/screenlogic/dissect"
+)
+
+const spec = `name: sldissect
+summary: |
+  decode screenlogic protocol messages from pcap capture files or hex dumps.
+  The input format is determined automatically, use - to read from stdin.
+  Capture with, for example: tcpdump -w capture.pcap host <gateway>
+arguments:
+  - <file>...
+`
+
+type dissectFlags struct {
+	Port int  `subcmd:"port,80,'the gateway TCP port used to determine the direction of pcap streams, 0 to infer the direction from the connect string'"`
+	Hex  bool `subcmd:"hex,false,treat the input as a hex dump even if it looks like a pcap file"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("sldissect").MustRunner(dissectFiles, &dissectFlags{})
+	cmdSet.MustDispatch(context.Background())
+}
+
+func dissectFiles(_ context.Context, values any, args []string) error {
+	fv := values.(*dissectFlags)
+	if fv.Port < 0 || fv.Port > 0xffff {
+		return fmt.Errorf("invalid port: %v", fv.Port)
+	}
+	for _, arg := range args {
+		if len(args) > 1 {
+			fmt.Printf("==> %s <==\n", arg)
+		}
+		if err := dissectFile(arg, uint16(fv.Port), fv.Hex); err != nil {
+			return fmt.Errorf("%v: %w", arg, err)
+		}
+	}
+	return nil
+}
+
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func dissectFile(name string, port uint16, forceHex bool) error {
+	buf, err := readInput(name)
+	if err != nil {
+		return err
+	}
+	var streams []dissect.Stream
+	if !forceHex && dissect.IsPcap(buf) {
+		segs, err := dissect.ReadPcap(bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		streams = dissect.Reassemble(segs)
+		dissect.SetDirections(streams, port)
+	} else {
+		streams, err = dissect.ReadHex(bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+	}
+	for _, st := range streams {
+		if st.Src.IsValid() {
+			fmt.Printf("stream %v %v %v: %v chunks\n", st.Src, st.Dir, st.Dst, len(st.Chunks))
+		}
+	}
+	dissect.New(os.Stdout).Print(dissect.MergeFrames(streams))
+	return nil
+}
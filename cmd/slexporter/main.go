@@ -0,0 +1,86 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command slexporter serves the status of a screenlogic controller as
+// Prometheus metrics.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/exporter"
+)
+
+const spec = `name: slexporter
+summary: |
+  poll a screenlogic gateway for its status and serve it as Prometheus
+  metrics on /metrics.
+`
+
+type exporterFlags struct {
+	Addr      string        `subcmd:"addr,,gateway address"`
+	Listen    string        `subcmd:"listen,:9617,address to serve metrics on"`
+	Interval  time.Duration `subcmd:"interval,30s,interval at which to poll the gateway"`
+	Timeout   time.Duration `subcmd:"timeout,10s,timeout for each request sent to the gateway"`
+	KeepAlive time.Duration `subcmd:"keep-alive,5m,'how long to keep the connection to the gateway open when idle'"`
+	Verbose   bool          `subcmd:"verbose,false,log every request sent to the gateway"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("slexporter").MustRunner(runExporter, &exporterFlags{})
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cmdSet.MustDispatch(ctx)
+}
+
+func runExporter(ctx context.Context, values any, _ []string) error {
+	fv := values.(*exporterFlags)
+	if len(fv.Addr) == 0 {
+		return errors.New("--addr must be specified")
+	}
+	level := slog.LevelInfo
+	if fv.Verbose {
+		level = slog.LevelDebug
+	}
+	ctx = ctxlog.NewJSONLogger(ctx, os.Stderr, &slog.HandlerOptions{Level: level})
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress: fv.Addr,
+		KeepAlive: fv.KeepAlive,
+	}, fv.Timeout)
+	if err != nil {
+		return err
+	}
+	defer pa.Close(context.WithoutCancel(ctx))
+
+	e := exporter.New(pa, fv.Interval)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", e)
+	srv := &http.Server{
+		Addr:              fv.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		_ = e.Run(ctx)
+	}()
+	ctxlog.Info(ctx, "screenlogic: exporter: listening", "addr", fv.Listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
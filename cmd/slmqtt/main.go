@@ -0,0 +1,84 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command slmqtt bridges a screenlogic controller to an MQTT broker,
+// including support for Home Assistant MQTT discovery.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/mqttbridge"
+)
+
+const spec = `name: slmqtt
+summary: |
+  publish the status of a screenlogic gateway to an MQTT broker and
+  accept commands to control it, optionally publishing Home Assistant
+  discovery payloads.
+`
+
+type bridgeFlags struct {
+	Addr             string        `subcmd:"addr,,gateway address"`
+	Broker           string        `subcmd:"broker,tcp://localhost:1883,MQTT broker url"`
+	ClientID         string        `subcmd:"client-id,screenlogic-bridge,MQTT client id"`
+	Username         string        `subcmd:"username,,MQTT username"`
+	Password         string        `subcmd:"password,,MQTT password"`
+	TopicPrefix      string        `subcmd:"topic-prefix,screenlogic,prefix for status and command topics"`
+	DiscoveryPrefix  string        `subcmd:"discovery-prefix,homeassistant,prefix for Home Assistant discovery topics"`
+	DisableDiscovery bool          `subcmd:"disable-discovery,false,do not publish Home Assistant discovery payloads"`
+	Interval         time.Duration `subcmd:"interval,30s,interval at which to poll the gateway"`
+	Timeout          time.Duration `subcmd:"timeout,10s,timeout for each request sent to the gateway"`
+	KeepAlive        time.Duration `subcmd:"keep-alive,5m,'how long to keep the connection to the gateway open when idle'"`
+	Verbose          bool          `subcmd:"verbose,false,log every request sent to the gateway"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("slmqtt").MustRunner(runBridge, &bridgeFlags{})
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cmdSet.MustDispatch(ctx)
+}
+
+func runBridge(ctx context.Context, values any, _ []string) error {
+	fv := values.(*bridgeFlags)
+	if len(fv.Addr) == 0 {
+		return errors.New("--addr must be specified")
+	}
+	level := slog.LevelInfo
+	if fv.Verbose {
+		level = slog.LevelDebug
+	}
+	ctx = ctxlog.NewJSONLogger(ctx, os.Stderr, &slog.HandlerOptions{Level: level})
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress: fv.Addr,
+		KeepAlive: fv.KeepAlive,
+	}, fv.Timeout)
+	if err != nil {
+		return err
+	}
+	defer pa.Close(context.WithoutCancel(ctx))
+
+	b := mqttbridge.New(pa, mqttbridge.Options{
+		Broker:           fv.Broker,
+		ClientID:         fv.ClientID,
+		Username:         fv.Username,
+		Password:         fv.Password,
+		TopicPrefix:      fv.TopicPrefix,
+		DiscoveryPrefix:  fv.DiscoveryPrefix,
+		DisableDiscovery: fv.DisableDiscovery,
+		PollInterval:     fv.Interval,
+	})
+	ctxlog.Info(ctx, "screenlogic: mqtt: bridging", "gateway", fv.Addr, "broker", fv.Broker)
+	return b.Run(ctx)
+}
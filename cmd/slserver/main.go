@@ -0,0 +1,116 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command slserver serves a REST/JSON API for a screenlogic controller
+// and a stream of status changes as server-sent events on /events.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/restapi"
+)
+
+const spec = `name: slserver
+summary: |
+  serve a REST/JSON API for querying and controlling a screenlogic
+  gateway, and a stream of status changes as server-sent events on
+  /events.
+`
+
+type serverFlags struct {
+	Addr         string        `subcmd:"addr,,gateway address"`
+	Listen       string        `subcmd:"listen,127.0.0.1:8080,'address to serve the API on, the API is unauthenticated so use eg. :8080 to explicitly serve it on all interfaces'"`
+	Interval     time.Duration `subcmd:"interval,5s,interval at which to poll the gateway for /events"`
+	Timeout      time.Duration `subcmd:"timeout,10s,timeout for each request sent to the gateway"`
+	KeepAlive    time.Duration `subcmd:"keep-alive,5m,'how long to keep the connection to the gateway open when idle'"`
+	PingInterval time.Duration `subcmd:"ping-interval,0s,'interval at which to ping the gateway whilst the connection is open, 0 disables pings'"`
+	CacheTTL     time.Duration `subcmd:"cache-ttl,2s,'how long to cache the status and configuration of the gateway, 0 disables caching'"`
+	SyncWait     time.Duration `subcmd:"sync-wait,30s,how long to defer commands whilst the gateway is syncing"`
+	RateLimit    float64       `subcmd:"rate-limit,0,'maximum number of commands per second sent to the gateway, 0 disables rate limiting'"`
+	Debounce     time.Duration `subcmd:"debounce,0s,'window within which repeated commands to set a circuit to the same state are dropped'"`
+	Verbose      bool          `subcmd:"verbose,false,log every request sent to the gateway"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("slserver").MustRunner(runServer, &serverFlags{})
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cmdSet.MustDispatch(ctx)
+}
+
+func runServer(ctx context.Context, values any, _ []string) error {
+	fv := values.(*serverFlags)
+	if len(fv.Addr) == 0 {
+		return errors.New("--addr must be specified")
+	}
+	level := slog.LevelInfo
+	if fv.Verbose {
+		level = slog.LevelDebug
+	}
+	ctx = ctxlog.NewJSONLogger(ctx, os.Stderr, &slog.HandlerOptions{Level: level})
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress:    fv.Addr,
+		KeepAlive:    fv.KeepAlive,
+		PingInterval: fv.PingInterval,
+		CacheTTL:     fv.CacheTTL,
+		SyncWait:     fv.SyncWait,
+		RateLimit:    screenlogic.RateLimitConfig{Rate: fv.RateLimit},
+		Debounce:     fv.Debounce,
+	}, fv.Timeout)
+	if err != nil {
+		return err
+	}
+	defer pa.Close(context.WithoutCancel(ctx))
+
+	events := restapi.NewEvents(pa, fv.Interval)
+	mux := http.NewServeMux()
+	mux.Handle("GET /events", events)
+	mux.Handle("/", restapi.New(pa))
+	srv := &http.Server{
+		Addr:              fv.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		_ = events.Run(ctx)
+	}()
+	if !isLoopback(fv.Listen) {
+		ctxlog.Warn(ctx, "screenlogic: restapi: serving the unauthenticated API on a non-loopback address", "addr", fv.Listen)
+	}
+	ctxlog.Info(ctx, "screenlogic: restapi: listening", "addr", fv.Listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// isLoopback returns true if addr only accepts connections from the
+// local host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Command slsim runs a simulated screenlogic gateway.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/signal"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+	"gopkg.in/yaml.v3"
+)
+
+const spec = `name: slsim
+summary: |
+  run a simulated screenlogic gateway. The gateway's circuits, bodies,
+  pumps and water chemistry are read from a YAML configuration file
+  or, if none is specified, a default configuration is used; use
+  --print-config to display the default configuration. Faults, such as
+  delayed, split or truncated replies and connection resets, may be
+  injected using --scenario.
+`
+
+type simFlags struct {
+	Addr         string        `subcmd:"addr,127.0.0.1:8080,address to listen on"`
+	Discovery    string        `subcmd:"discovery,,'if set, the UDP address on which to respond to discovery requests, eg. :1444'"`
+	Config       string        `subcmd:"config,,YAML configuration file"`
+	Scenario     string        `subcmd:"scenario,,YAML file containing faults to inject"`
+	PushInterval time.Duration `subcmd:"push-interval,0s,'if non-zero, the interval at which status updates are pushed to registered clients, overrides the configuration file'"`
+	PrintConfig  bool          `subcmd:"print-config,false,print the configuration and exit"`
+	Verbose      bool          `subcmd:"verbose,false,log every request received"`
+}
+
+func main() {
+	cmdSet := subcmd.MustFromYAML(spec)
+	cmdSet.Set("slsim").MustRunner(runSimulator, &simFlags{})
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cmdSet.MustDispatch(ctx)
+}
+
+func runSimulator(ctx context.Context, values any, _ []string) error {
+	fv := values.(*simFlags)
+	cfg := simulator.DefaultConfig()
+	if len(fv.Config) > 0 {
+		var err error
+		if cfg, err = simulator.ReadConfig(fv.Config); err != nil {
+			return err
+		}
+	}
+	if fv.PushInterval != 0 {
+		cfg.PushInterval = fv.PushInterval
+	}
+	if fv.PrintConfig {
+		return yaml.NewEncoder(os.Stdout).Encode(cfg)
+	}
+	level := slog.LevelInfo
+	if fv.Verbose {
+		level = slog.LevelDebug
+	}
+	ctx = ctxlog.NewJSONLogger(ctx, os.Stderr, &slog.HandlerOptions{Level: level})
+	gw, err := simulator.New(cfg)
+	if err != nil {
+		return err
+	}
+	if len(fv.Scenario) > 0 {
+		sc, err := simulator.ReadScenario(fv.Scenario)
+		if err != nil {
+			return err
+		}
+		if err := gw.Inject(sc.Faults...); err != nil {
+			return fmt.Errorf("%v: %w", fv.Scenario, err)
+		}
+	}
+	if len(fv.Discovery) == 0 {
+		return gw.ListenAndServe(ctx, fv.Addr)
+	}
+	gwAddr, err := netip.ParseAddrPort(fv.Addr)
+	if err != nil {
+		return fmt.Errorf("--discovery requires an IP address and port for --addr: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.ListenAndServeDiscovery(ctx, fv.Discovery, gwAddr)
+	}()
+	err = gw.ListenAndServe(ctx, fv.Addr)
+	cancel()
+	return errors.Join(err, <-errCh)
+}
@@ -5,14 +5,20 @@ go 1.23.3
 toolchain go1.24.2
 
 require (
+	cloudeng.io/cmdutil v0.0.0-20250428223124-bb967ac9f3f8
 	cloudeng.io/logging v0.0.0-20250428223124-bb967ac9f3f8
 	github.com/cosnicolaou/automation v0.0.0-20250516220144-b6f3bad30206
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/mochi-mqtt/server/v2 v2.7.9
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	cloudeng.io/cmdutil v0.0.0-20250428223124-bb967ac9f3f8 // indirect
 	cloudeng.io/datetime v0.0.0-20250428223124-bb967ac9f3f8 // indirect
 	cloudeng.io/file v0.0.0-20250428223124-bb967ac9f3f8 // indirect
-	github.com/kr/text v0.2.0 // indirect
+	cloudeng.io/text v0.0.11 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/net v0.39.0 // indirect
+	golang.org/x/sync v0.13.0 // indirect
 )
@@ -0,0 +1,338 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package dissect provides support for decoding captured screenlogic
+// protocol exchanges, either from pcap files or textual hex dumps, into
+// a human readable form.
+package dissect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+// Direction represents the direction of a stream relative to the gateway.
+type Direction int
+
+const (
+	DirUnknown Direction = iota
+	DirToGateway
+	DirFromGateway
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirToGateway:
+		return "->"
+	case DirFromGateway:
+		return "<-"
+	}
+	return "??"
+}
+
+// Chunk represents a contiguous piece of a stream, or a gap in it.
+type Chunk struct {
+	Index int // Used to order chunks from different streams.
+	Time  time.Time
+	Data  []byte
+	Gap   int // Number of bytes missing before this chunk.
+}
+
+// Stream represents the data sent in one direction of a connection.
+type Stream struct {
+	Src, Dst netip.AddrPort
+	Dir      Direction
+	Chunks   []Chunk
+}
+
+// Frame represents a single framed message, the connect string or data
+// that could not be framed.
+type Frame struct {
+	Index   int
+	Time    time.Time
+	Dir     Direction
+	Connect bool
+	Msg     protocol.Message
+	Raw     []byte // Data that could not be framed.
+	Err     error  // The reason that Raw could not be framed.
+}
+
+// maxFrameSize is used to detect a loss of framing.
+const maxFrameSize = 1 << 16
+
+// SetDirections sets the direction of each stream, either using the
+// gateway port or, if port is zero, by assuming that the stream that
+// starts with the connect string, and its reverse, are to and from the
+// gateway.
+func SetDirections(streams []Stream, port uint16) {
+	gateways := map[netip.AddrPort]bool{}
+	for _, st := range streams {
+		if port != 0 {
+			if st.Dst.Port() == port {
+				gateways[st.Dst] = true
+			}
+			continue
+		}
+		if len(st.Chunks) > 0 && bytes.HasPrefix(st.Chunks[0].Data, []byte(protocol.ConnectString[:8])) {
+			gateways[st.Dst] = true
+		}
+	}
+	for i := range streams {
+		switch {
+		case gateways[streams[i].Dst]:
+			streams[i].Dir = DirToGateway
+		case gateways[streams[i].Src]:
+			streams[i].Dir = DirFromGateway
+		}
+	}
+}
+
+// SplitFrames splits a stream into frames.
+func SplitFrames(st Stream) []Frame {
+	var frames []Frame
+	var buf []byte
+	var start Chunk
+	flush := func(err error) {
+		if len(buf) > 0 {
+			frames = append(frames, Frame{Index: start.Index, Time: start.Time, Dir: st.Dir, Raw: buf, Err: err})
+		}
+		buf = nil
+	}
+	for _, c := range st.Chunks {
+		if c.Gap > 0 {
+			flush(fmt.Errorf("incomplete frame, followed by a gap of %v bytes", c.Gap))
+			continue
+		}
+		if len(buf) == 0 {
+			start = c
+		}
+		buf = append(buf, c.Data...)
+		for len(buf) > 0 {
+			if bytes.HasPrefix(buf, []byte(protocol.ConnectString)) {
+				frames = append(frames, Frame{Index: start.Index, Time: start.Time, Dir: st.Dir, Connect: true})
+				buf = buf[len(protocol.ConnectString):]
+				start = c
+				continue
+			}
+			if len(buf) < len(protocol.ConnectString) && strings.HasPrefix(protocol.ConnectString, string(buf)) {
+				break
+			}
+			if len(buf) < slnet.MessageHeaderSize {
+				break
+			}
+			size := slnet.MessageHeader(buf).Size()
+			if size > maxFrameSize {
+				flush(fmt.Errorf("lost framing: message size of %v is too large", size))
+				break
+			}
+			n := slnet.MessageHeaderSize + int(size)
+			if len(buf) < n {
+				break
+			}
+			frames = append(frames, Frame{Index: start.Index, Time: start.Time, Dir: st.Dir, Msg: protocol.Message(bytes.Clone(buf[:n]))})
+			buf = buf[n:]
+			start = c
+		}
+	}
+	flush(fmt.Errorf("incomplete frame at end of stream"))
+	return frames
+}
+
+// MergeFrames returns the frames from all of the supplied streams in the
+// order in which they were captured.
+func MergeFrames(streams []Stream) []Frame {
+	var frames []Frame
+	for _, st := range streams {
+		frames = append(frames, SplitFrames(st)...)
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		if !frames[i].Time.Equal(frames[j].Time) {
+			return frames[i].Time.Before(frames[j].Time)
+		}
+		return frames[i].Index < frames[j].Index
+	})
+	return frames
+}
+
+type pending struct {
+	n    int
+	code protocol.MsgCode
+	id   uint16
+	time time.Time
+}
+
+// Dissector prints frames, matching responses to requests.
+type Dissector struct {
+	out     io.Writer
+	n       int
+	pending []pending
+}
+
+// New returns a new Dissector that writes to out.
+func New(out io.Writer) *Dissector {
+	return &Dissector{out: out}
+}
+
+// Print prints all of the supplied frames.
+func (d *Dissector) Print(frames []Frame) {
+	for _, f := range frames {
+		d.PrintFrame(f)
+	}
+}
+
+// PrintFrame prints a single frame.
+func (d *Dissector) PrintFrame(f Frame) {
+	d.n++
+	ts := ""
+	if !f.Time.IsZero() {
+		ts = f.Time.Format("15:04:05.000000 ")
+	}
+	switch {
+	case f.Connect:
+		fmt.Fprintf(d.out, "%s#%d %v connect: %q\n", ts, d.n, f.Dir, protocol.ConnectString)
+		return
+	case f.Raw != nil:
+		fmt.Fprintf(d.out, "%s#%d %v undecodable: %v\n", ts, d.n, f.Dir, f.Err)
+		HexDump(d.out, "    ", f.Raw)
+		return
+	}
+	m := f.Msg
+	code := m.Code()
+	info, _ := protocol.LookupMsg(code)
+	dir := f.Dir
+	if dir == DirUnknown {
+		switch info.Kind {
+		case protocol.MsgKindRequest:
+			dir = DirToGateway
+		case protocol.MsgKindResponse, protocol.MsgKindPush, protocol.MsgKindError:
+			dir = DirFromGateway
+		}
+	}
+	name := code.String()
+	if code.Known() {
+		name = fmt.Sprintf("%v(%d)", code, uint16(code))
+	}
+	fmt.Fprintf(d.out, "%s#%d %v %v id=%d size=%d%s\n", ts, d.n, dir, name, m.ID(), m.Size(), d.match(f, dir, info))
+	d.printPayload(m, info)
+}
+
+func (d *Dissector) match(f Frame, dir Direction, info protocol.MsgInfo) string {
+	m := f.Msg
+	if dir == DirToGateway {
+		d.pending = append(d.pending, pending{n: d.n, code: m.Code(), id: m.ID(), time: f.Time})
+		return ""
+	}
+	if !info.Code.Known() {
+		return " (unknown message code)"
+	}
+	if info.Kind == protocol.MsgKindPush {
+		return " (push)"
+	}
+	idx := -1
+	for i, p := range d.pending {
+		if info.Kind == protocol.MsgKindError || p.code.Response() == m.Code() {
+			if p.id == m.ID() {
+				idx = i
+				break
+			}
+			if idx < 0 {
+				idx = i
+			}
+		}
+	}
+	if idx < 0 {
+		return " (no matching request)"
+	}
+	p := d.pending[idx]
+	d.pending = append(d.pending[:idx], d.pending[idx+1:]...)
+	if p.id != m.ID() {
+		return fmt.Sprintf(" (reply to #%d %v, id mismatch %d)", p.n, p.code, p.id)
+	}
+	if !p.time.IsZero() && !f.Time.IsZero() {
+		return fmt.Sprintf(" (reply to #%d %v, %v)", p.n, p.code, f.Time.Sub(p.time))
+	}
+	return fmt.Sprintf(" (reply to #%d %v)", p.n, p.code)
+}
+
+func (d *Dissector) printPayload(m protocol.Message, info protocol.MsgInfo) {
+	pl := m.Payload()
+	if len(pl) == 0 {
+		return
+	}
+	if info.Decode == nil {
+		HexDump(d.out, "    ", pl)
+		return
+	}
+	v, err := info.Decode(m)
+	if err != nil {
+		fmt.Fprintf(d.out, "    decode failed: %v\n", err)
+		HexDump(d.out, "    ", pl)
+		return
+	}
+	buf, err := json.MarshalIndent(v, "    ", "  ")
+	if err != nil {
+		fmt.Fprintf(d.out, "    %+v\n", v)
+		return
+	}
+	fmt.Fprintf(d.out, "    %s\n", buf)
+}
+
+// HexDump writes an annotated hex dump of buf to out. Each line displays
+// 16 bytes as hex and ASCII followed by the little-endian uint32 values
+// of the 4 byte words in that line. Any length-prefixed strings found at
+// 4 byte aligned offsets are listed after the dump.
+func HexDump(out io.Writer, indent string, buf []byte) {
+	for off := 0; off < len(buf); off += 16 {
+		line := buf[off:min(off+16, len(buf))]
+		var hex, ascii, words strings.Builder
+		for i := range 16 {
+			if i == 8 {
+				hex.WriteByte(' ')
+			}
+			if i >= len(line) {
+				hex.WriteString("   ")
+				continue
+			}
+			fmt.Fprintf(&hex, "%02x ", line[i])
+			if line[i] >= 0x20 && line[i] < 0x7f {
+				ascii.WriteByte(line[i])
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		for i := 0; i+4 <= len(line); i += 4 {
+			fmt.Fprintf(&words, " %d", binary.LittleEndian.Uint32(line[i:]))
+		}
+		fmt.Fprintf(out, "%s%04x  %s |%-16s| u32:%s\n", indent, off, hex.String(), ascii.String(), words.String())
+	}
+	for off := 0; off+4 <= len(buf); off += 4 {
+		if s, ok := stringAt(buf[off:]); ok {
+			fmt.Fprintf(out, "%s@%04x string %q\n", indent, off, s)
+		}
+	}
+}
+
+func stringAt(buf []byte) (string, bool) {
+	n := int(binary.LittleEndian.Uint32(buf))
+	if n == 0 || n > 128 || len(buf) < 4+n {
+		return "", false
+	}
+	s := buf[4 : 4+n]
+	for _, c := range s {
+		if c < 0x20 || c >= 0x7f {
+			return "", false
+		}
+	}
+	return string(s), true
+}
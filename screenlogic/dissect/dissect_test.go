@@ -0,0 +1,149 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package dissect_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/cosnicolaou/pentair/screenlogic/dissect"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+type packet struct {
+	toGateway bool
+	seq       uint32
+	data      []byte
+}
+
+// writePcap creates a pcap file containing ethernet/ipv4/tcp packets
+// between 10.0.0.1:5000 and the gateway at 10.0.0.2:80.
+func writePcap(pkts []packet) []byte {
+	var out bytes.Buffer
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], 1)
+	out.Write(hdr)
+	client, gw := []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+	for i, p := range pkts {
+		src, dst, sport, dport := client, gw, uint16(5000), uint16(80)
+		if !p.toGateway {
+			src, dst, sport, dport = gw, client, 80, 5000
+		}
+		eth := make([]byte, 14)
+		binary.BigEndian.PutUint16(eth[12:], 0x0800)
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+20+len(p.data)))
+		ip[9] = 6
+		copy(ip[12:], src)
+		copy(ip[16:], dst)
+		tcp := make([]byte, 20)
+		binary.BigEndian.PutUint16(tcp[0:], sport)
+		binary.BigEndian.PutUint16(tcp[2:], dport)
+		binary.BigEndian.PutUint32(tcp[4:], p.seq)
+		tcp[12] = 5 << 4
+		pkt := append(append(append(eth, ip...), tcp...), p.data...)
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[0:], 1700000000)
+		binary.LittleEndian.PutUint32(rec[4:], uint32(i*1000))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+		out.Write(rec)
+		out.Write(pkt)
+	}
+	return out.Bytes()
+}
+
+func TestPcap(t *testing.T) {
+	press, err := protocol.MarshalMessage(7, protocol.MsgButtonPress,
+		protocol.ButtonPress{CircuitID: 505, State: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := protocol.NewMessage(7, protocol.MsgButtonPress+1, nil)
+	unknown := protocol.NewMessage(9, 4242, []byte{3, 0, 0, 0, 'a', 'b', 'c', 0})
+	cs := []byte(protocol.ConnectString)
+
+	pkts := []packet{
+		{true, 100, cs},
+		{true, 100 + uint32(len(cs)), press[:10]},
+		{true, 100 + uint32(len(cs)), press[:10]}, // retransmission
+		{true, 110 + uint32(len(cs)), press[10:]},
+		{false, 500, ack},
+		{false, 500 + uint32(len(ack)), unknown},
+	}
+	segs, err := dissect.ReadPcap(bytes.NewReader(writePcap(pkts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(segs), len(pkts); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	streams := dissect.Reassemble(segs)
+	dissect.SetDirections(streams, 0)
+	if got, want := len(streams), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := streams[0].Dir, dissect.DirToGateway; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := streams[1].Dir, dissect.DirFromGateway; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var out strings.Builder
+	dissect.New(&out).Print(dissect.MergeFrames(streams))
+	for _, want := range []string{
+		`#1 -> connect: "CONNECTSERVERHOST\r\n\r\n"`,
+		`#2 -> ButtonPress(12530) id=7 size=12`,
+		`"CircuitID": 505`,
+		`#3 <- ButtonPressResponse(12531) id=7 size=0 (reply to #2 ButtonPress, 3ms)`,
+		`#4 <- Unknown(4242) id=9 size=8 (unknown message code)`,
+		`@0000 string "abc"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q\n%s", want, out.String())
+		}
+	}
+}
+
+func TestHex(t *testing.T) {
+	input := `# a comment
+> 0000 1b00 0000 0000
+< 00000000: 0000 1c00 0000 0000  ........
+0100 d430 0000 0000 0200 4242 0200 0000 0102 |abc
+`
+	streams, err := dissect.ReadHex(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := dissect.MergeFrames(streams)
+	if got, want := len(frames), 4; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var out strings.Builder
+	dissect.New(&out).Print(frames)
+	for _, want := range []string{
+		`#1 -> LocalLogin(27) id=0 size=0`,
+		`#2 <- LocalLoginResponse(28) id=0 size=0 (reply to #1 LocalLogin)`,
+		`#3 <- StatusChanged(12500) id=1 size=0 (push)`,
+		`#4 <- Unknown(16962) id=2 size=2 (unknown message code)`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q\n%s", want, out.String())
+		}
+	}
+
+	_, err = dissect.ReadHex(strings.NewReader("> zz 00\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package dissect
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadHex parses a textual hex dump of a screenlogic exchange. The
+// format is deliberately forgiving so that the output of tools such as
+// xxd, hexdump -C or copy/paste from a debugger can be used directly:
+//
+//   - '#' introduces a comment that extends to the end of the line.
+//   - a line that starts with '>' contains data sent to the gateway and
+//     one that starts with '<' data sent by the gateway; the direction
+//     applies to subsequent lines until changed. The direction may be
+//     omitted entirely, in which case it is inferred from the message codes.
+//   - tokens that end in ':' are treated as offsets and ignored.
+//   - hex tokens may be of any even length and may have a 0x prefix.
+//   - anything after a '|', or after the first non-hex token that follows
+//     a hex token, is treated as an ASCII column and ignored.
+func ReadHex(rd io.Reader) ([]Stream, error) {
+	streams := map[Direction]*Stream{}
+	var order []Direction
+	dir := DirUnknown
+	sc := bufio.NewScanner(rd)
+	lineNo, index := 0, 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexAny(line, "#|"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, ">"):
+			dir, line = DirToGateway, line[1:]
+		case strings.HasPrefix(line, "<"):
+			dir, line = DirFromGateway, line[1:]
+		}
+		data, err := parseHexLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", lineNo, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		st, ok := streams[dir]
+		if !ok {
+			st = &Stream{Dir: dir}
+			streams[dir] = st
+			order = append(order, dir)
+		}
+		st.Chunks = append(st.Chunks, Chunk{Index: index, Data: data})
+		index++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Stream, 0, len(order))
+	for _, d := range order {
+		out = append(out, *streams[d])
+	}
+	return out, nil
+}
+
+func parseHexLine(line string) ([]byte, error) {
+	var data []byte
+	for _, tok := range strings.Fields(line) {
+		if strings.HasSuffix(tok, ":") {
+			continue
+		}
+		tok = strings.TrimPrefix(strings.TrimPrefix(tok, "0x"), "0X")
+		b, err := hex.DecodeString(tok)
+		if err != nil {
+			if len(data) > 0 {
+				break // ASCII column.
+			}
+			return nil, fmt.Errorf("invalid hex token: %q", tok)
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package dissect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Segment represents the payload of a single TCP segment.
+type Segment struct {
+	Index   int // The index of the segment in the capture.
+	Time    time.Time
+	Src     netip.AddrPort
+	Dst     netip.AddrPort
+	Seq     uint32
+	SYN     bool
+	Payload []byte
+}
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapngMagic    = 0x0a0d0d0a
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeSLL2     = 276
+)
+
+var ErrNotPcap = errors.New("not a pcap file")
+
+// IsPcap returns true if buf starts with a pcap or pcapng magic number.
+func IsPcap(buf []byte) bool {
+	if len(buf) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(buf) {
+	case pcapMagicMicro, pcapMagicNano, pcapngMagic:
+		return true
+	}
+	switch binary.BigEndian.Uint32(buf) {
+	case pcapMagicMicro, pcapMagicNano:
+		return true
+	}
+	return false
+}
+
+// ReadPcap reads a classic (libpcap) capture file and returns the
+// TCP segments it contains that carry a payload or a SYN. Non-IPv4 and
+// non-TCP packets are ignored. pcapng files are not supported and
+// must be converted first, eg. using editcap -F pcap.
+func ReadPcap(rd io.Reader) ([]Segment, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %w", err)
+	}
+	var order binary.ByteOrder
+	nano := false
+	switch {
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapngMagic:
+		return nil, fmt.Errorf("pcapng is not supported, convert to pcap with editcap -F pcap: %w", ErrNotPcap)
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapMagicMicro:
+		order = binary.LittleEndian
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapMagicNano:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMagicMicro:
+		order = binary.BigEndian
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMagicNano:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, ErrNotPcap
+	}
+	linkType := order.Uint32(hdr[20:])
+
+	var segs []Segment
+	var rec [16]byte
+	for {
+		if _, err := io.ReadFull(rd, rec[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read pcap record header: %w", err)
+		}
+		secs, frac := order.Uint32(rec[0:]), order.Uint32(rec[4:])
+		if !nano {
+			frac *= 1000
+		}
+		size := order.Uint32(rec[8:])
+		if size > 1<<18 {
+			return nil, fmt.Errorf("pcap record too large: %v", size)
+		}
+		pkt := make([]byte, size)
+		if _, err := io.ReadFull(rd, pkt); err != nil {
+			return nil, fmt.Errorf("failed to read pcap record: %w", err)
+		}
+		ip, ok := ipv4Packet(linkType, pkt)
+		if !ok {
+			continue
+		}
+		seg, ok := tcpSegment(ip)
+		if !ok {
+			continue
+		}
+		seg.Time = time.Unix(int64(secs), int64(frac))
+		seg.Index = len(segs)
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+// ipv4Packet strips the link layer header from pkt and returns the
+// IPv4 packet it contains.
+func ipv4Packet(linkType uint32, pkt []byte) ([]byte, bool) {
+	var ethType uint16
+	switch linkType {
+	case linkTypeEthernet:
+		if len(pkt) < 14 {
+			return nil, false
+		}
+		ethType, pkt = binary.BigEndian.Uint16(pkt[12:]), pkt[14:]
+		if ethType == 0x8100 && len(pkt) >= 4 { // VLAN
+			ethType, pkt = binary.BigEndian.Uint16(pkt[2:]), pkt[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(pkt) < 16 {
+			return nil, false
+		}
+		ethType, pkt = binary.BigEndian.Uint16(pkt[14:]), pkt[16:]
+	case linkTypeSLL2:
+		if len(pkt) < 20 {
+			return nil, false
+		}
+		ethType, pkt = binary.BigEndian.Uint16(pkt[0:]), pkt[20:]
+	case linkTypeNull:
+		// The address family is in host byte order, AF_INET is 2 everywhere.
+		if len(pkt) < 4 || (pkt[0] != 2 && pkt[3] != 2) {
+			return nil, false
+		}
+		ethType, pkt = 0x0800, pkt[4:]
+	case linkTypeRaw, linkTypeIPv4:
+		ethType = 0x0800
+	default:
+		return nil, false
+	}
+	if ethType != 0x0800 || len(pkt) < 20 || pkt[0]>>4 != 4 {
+		return nil, false
+	}
+	return pkt, true
+}
+
+func tcpSegment(ip []byte) (Segment, bool) {
+	ihl := int(ip[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(ip[2:]))
+	if ip[9] != 6 || ihl < 20 || total < ihl || total > len(ip) {
+		return Segment{}, false
+	}
+	src, _ := netip.AddrFromSlice(ip[12:16])
+	dst, _ := netip.AddrFromSlice(ip[16:20])
+	tcp := ip[ihl:total]
+	if len(tcp) < 20 {
+		return Segment{}, false
+	}
+	off := int(tcp[12]>>4) * 4
+	if off < 20 || off > len(tcp) {
+		return Segment{}, false
+	}
+	seg := Segment{
+		Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(tcp[0:])),
+		Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(tcp[2:])),
+		Seq:     binary.BigEndian.Uint32(tcp[4:]),
+		SYN:     tcp[13]&0x02 != 0,
+		Payload: tcp[off:],
+	}
+	if len(seg.Payload) == 0 && !seg.SYN {
+		return Segment{}, false
+	}
+	return seg, true
+}
+
+type flow struct {
+	src, dst netip.AddrPort
+}
+
+// Reassemble groups segments by flow and direction and returns the
+// in-order byte stream for each flow, retransmitted data is dropped and
+// gaps in the sequence space are recorded as chunks with a non-zero Gap.
+// The flows are returned in the order in which they were first seen.
+func Reassemble(segs []Segment) []Stream {
+	byFlow := map[flow][]Segment{}
+	var order []flow
+	for _, seg := range segs {
+		f := flow{seg.Src, seg.Dst}
+		if _, ok := byFlow[f]; !ok {
+			order = append(order, f)
+		}
+		byFlow[f] = append(byFlow[f], seg)
+	}
+	streams := make([]Stream, 0, len(order))
+	for _, f := range order {
+		streams = append(streams, reassembleFlow(f, byFlow[f]))
+	}
+	return streams
+}
+
+func reassembleFlow(f flow, segs []Segment) Stream {
+	sort.SliceStable(segs, func(i, j int) bool {
+		return int32(segs[i].Seq-segs[j].Seq) < 0 //nolint:gosec // sequence number arithmetic.
+	})
+	st := Stream{Src: f.src, Dst: f.dst}
+	started := false
+	var next uint32
+	for _, seg := range segs {
+		seq, pl := seg.Seq, seg.Payload
+		if seg.SYN {
+			seq++
+		}
+		if !started {
+			next, started = seq, true
+		}
+		if d := int32(next - seq); d > 0 { //nolint:gosec // sequence number arithmetic.
+			if int(d) >= len(pl) {
+				continue // retransmission.
+			}
+			pl = pl[d:]
+		} else if d < 0 {
+			st.Chunks = append(st.Chunks, Chunk{Index: seg.Index, Time: seg.Time, Gap: int(-d)})
+		}
+		if len(pl) == 0 {
+			continue
+		}
+		st.Chunks = append(st.Chunks, Chunk{Index: seg.Index, Time: seg.Time, Data: pl})
+		next = seq + uint32(len(seg.Payload)) //nolint:gosec // sequence number arithmetic.
+	}
+	return st
+}
@@ -0,0 +1,190 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package exporter provides an http.Handler that serves the status of a
+// screenlogic controller as Prometheus metrics.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// Source is the source of the data exported, it is implemented by
+// screenlogic.Adapter.
+type Source interface {
+	GetConfig(ctx context.Context) (protocol.ControllerConfig, error)
+	GetStatus(ctx context.Context) (protocol.ControllerStatus, error)
+	GetPumpStatus(ctx context.Context, pump int) (protocol.PumpStatus, error)
+	Stats() screenlogic.AdapterStats
+}
+
+// Exporter polls a Source for the controller's status and serves the
+// most recently obtained status as Prometheus metrics.
+type Exporter struct {
+	src      Source
+	interval time.Duration
+
+	mu         sync.Mutex
+	config     protocol.ControllerConfig
+	haveConfig bool
+	status     protocol.ControllerStatus
+	pumps      map[int]protocol.PumpStatus
+	up         bool
+	lastPoll   time.Time
+	pollErrors int64
+}
+
+// New returns a new Exporter that polls src at the specified interval
+// once Run is called.
+func New(src Source, interval time.Duration) *Exporter {
+	return &Exporter{src: src, interval: interval}
+}
+
+// Run polls the source until the context is canceled.
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Poll(ctx); err != nil {
+			ctxlog.Warn(ctx, "screenlogic: exporter: poll failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll obtains the controller's current status, and its configuration if
+// not already obtained, from the source.
+func (e *Exporter) Poll(ctx context.Context) error {
+	err := e.poll(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.up = err == nil
+	if err != nil {
+		e.pollErrors++
+	}
+	return err
+}
+
+func (e *Exporter) poll(ctx context.Context) error {
+	e.mu.Lock()
+	cfg, haveConfig := e.config, e.haveConfig
+	e.mu.Unlock()
+	if !haveConfig {
+		var err error
+		if cfg, err = e.src.GetConfig(ctx); err != nil {
+			return err
+		}
+		e.mu.Lock()
+		e.config, e.haveConfig = cfg, true
+		e.mu.Unlock()
+	}
+	status, err := e.src.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	pumps := map[int]protocol.PumpStatus{}
+	var errs []error
+	for _, p := range cfg.IntelliFlo {
+		ps, err := e.src.GetPumpStatus(ctx, p.Index)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pumps[p.Index] = ps
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+	e.pumps = pumps
+	e.lastPoll = time.Now()
+	return errors.Join(errs...)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func bodyLabel(bt protocol.BodyType) string {
+	return strings.ToLower(bt.String())
+}
+
+// WriteMetrics writes the most recently obtained status using the
+// Prometheus text exposition format.
+func (e *Exporter) WriteMetrics(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var m metrics
+	m.gauge("screenlogic_up", "Whether the most recent poll of the controller succeeded.", boolToFloat(e.up))
+	if !e.lastPoll.IsZero() {
+		m.gauge("screenlogic_last_poll_timestamp_seconds", "Time of the most recent successful poll.", float64(e.lastPoll.Unix()))
+		e.statusMetrics(&m)
+	}
+	stats := e.src.Stats()
+	m.counter("screenlogic_poll_errors_total", "Polls of the controller that failed.", float64(e.pollErrors))
+	m.counter("screenlogic_protocol_errors_total", "Errors returned by, or malformed responses from, the controller.", float64(stats.ProtocolErrors))
+	m.counter("screenlogic_transport_errors_total", "Connection failures and timeouts.", float64(stats.TransportErrors))
+	m.counter("screenlogic_reconnects_total", "Reconnections to the controller following a connection failure.", float64(stats.Reconnects))
+	return m.writeTo(w)
+}
+
+func (e *Exporter) statusMetrics(m *metrics) {
+	st := e.status
+	m.gauge("screenlogic_air_temperature", "Air temperature, in the controller's units.", float64(st.AirTemp))
+	for _, b := range st.Bodies {
+		body := bodyLabel(b.Type)
+		m.gauge("screenlogic_water_temperature", "Water temperature, in the controller's units.", float64(b.CurrentTemp), "body", body)
+		m.gauge("screenlogic_heat_set_point", "Heat set point, in the controller's units.", float64(b.HeatSetPoint), "body", body)
+		m.gauge("screenlogic_cool_set_point", "Cool set point, in the controller's units.", float64(b.CoolSetPoint), "body", body)
+		m.gauge("screenlogic_heat_mode", "Heat mode: 0 off, 1 solar, 2 solar preferred, 3 heater.", float64(b.HeatMode), "body", body)
+		m.gauge("screenlogic_heating", "Whether the body is being heated.", boolToFloat(b.HeatStatus != protocol.HeatStatusOff), "body", body)
+	}
+	for _, c := range st.Circuits {
+		m.gauge("screenlogic_circuit_on", "Whether the circuit is on.", boolToFloat(c.State),
+			"id", strconv.Itoa(c.ID), "name", e.config.CircuitName(c.ID))
+	}
+	m.gauge("screenlogic_freeze_mode", "Whether freeze protection is active.", boolToFloat(st.FreezeMode))
+	if e.config.Equipment&protocol.IntelliChem != 0 {
+		m.gauge("screenlogic_ph", "pH.", st.PH)
+		m.gauge("screenlogic_orp", "Oxidation reduction potential, in mV.", float64(st.ORP))
+		m.gauge("screenlogic_salt_ppm", "Salt level, in parts per million.", float64(st.SaltPPM))
+		m.gauge("screenlogic_saturation_index", "Saturation index.", st.Saturation)
+	}
+	for _, p := range e.config.IntelliFlo {
+		ps, ok := e.pumps[p.Index]
+		if !ok {
+			continue
+		}
+		pump := strconv.Itoa(p.Index)
+		m.gauge("screenlogic_pump_running", "Whether the pump is running.", boolToFloat(ps.Running), "pump", pump)
+		m.gauge("screenlogic_pump_watts", "Pump power consumption, in watts.", float64(ps.Watts), "pump", pump)
+		m.gauge("screenlogic_pump_rpm", "Pump speed, in RPM.", float64(ps.RPM), "pump", pump)
+		m.gauge("screenlogic_pump_gpm", "Pump flow rate, in gallons per minute.", float64(ps.GPM), "pump", pump)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.WriteMetrics(w); err != nil {
+		ctxlog.Warn(r.Context(), "screenlogic: exporter: write failed", "err", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package exporter_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/exporter"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+)
+
+func startSimulator(t *testing.T) (*simulator.Gateway, string) {
+	t.Helper()
+	gw, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return gw, ln.Addr().String()
+}
+
+func newAdapter(t *testing.T, addr string) *screenlogic.Adapter {
+	t.Helper()
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress: addr,
+		KeepAlive: time.Minute,
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// See the comment in screenlogic.newAdapter.
+		time.Sleep(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pa.Close(ctx); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return pa
+}
+
+func scrape(t *testing.T, e *exporter.Exporter) string {
+	t.Helper()
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func contains(t *testing.T, metrics string, lines ...string) {
+	t.Helper()
+	for _, l := range lines {
+		if !strings.Contains(metrics, l+"\n") {
+			t.Errorf("missing %q in:\n%s", l, metrics)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	e := exporter.New(newAdapter(t, addr), time.Minute)
+
+	contains(t, scrape(t, e),
+		"screenlogic_up 0",
+		"screenlogic_poll_errors_total 0",
+	)
+
+	if err := e.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	contains(t, scrape(t, e),
+		"# HELP screenlogic_air_temperature Air temperature, in the controller's units.",
+		"# TYPE screenlogic_air_temperature gauge",
+		"screenlogic_up 1",
+		"screenlogic_air_temperature 72",
+		`screenlogic_water_temperature{body="pool"} 78`,
+		`screenlogic_water_temperature{body="spa"} 80`,
+		`screenlogic_heat_set_point{body="pool"} 82`,
+		`screenlogic_heating{body="pool"} 1`,
+		`screenlogic_circuit_on{id="502",name="Pool Light"} 0`,
+		`screenlogic_circuit_on{id="505",name="Pool"} 1`,
+		"screenlogic_ph 7.4",
+		"screenlogic_orp 650",
+		"screenlogic_salt_ppm 3200",
+		`screenlogic_pump_watts{pump="0"} 850`,
+		`screenlogic_pump_rpm{pump="0"} 2450`,
+		"# TYPE screenlogic_reconnects_total counter",
+		"screenlogic_protocol_errors_total 0",
+	)
+
+	if err := gw.SetCircuit(502, true); err != nil {
+		t.Fatal(err)
+	}
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.AirTemp = 65
+	})
+	if err := gw.Inject(simulator.Fault{Request: "GetStatus", Count: 1, Reset: true}); err != nil {
+		t.Fatal(err)
+	}
+	// The reset is retried using a new connection.
+	if err := e.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	contains(t, scrape(t, e),
+		"screenlogic_air_temperature 65",
+		`screenlogic_circuit_on{id="502",name="Pool Light"} 1`,
+		"screenlogic_transport_errors_total 1",
+		"screenlogic_reconnects_total 1",
+	)
+
+	if err := gw.Inject(simulator.Fault{Request: "GetStatus", Count: 1, Reply: "InvalidRequest"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Poll(ctx); err == nil {
+		t.Errorf("expected an error")
+	}
+	contains(t, scrape(t, e),
+		"screenlogic_up 0",
+		"screenlogic_poll_errors_total 1",
+		"screenlogic_protocol_errors_total 1",
+		// The previous status is still reported.
+		"screenlogic_air_temperature 65",
+	)
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricType is the type of a metric family in the Prometheus text
+// exposition format.
+type metricType string
+
+const (
+	gauge   metricType = "gauge"
+	counter metricType = "counter"
+)
+
+type sample struct {
+	labels []string // name, value pairs.
+	value  float64
+}
+
+// family represents a metric family, ie. all of the samples for a
+// single metric name.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	samples []sample
+}
+
+// metrics accumulates metric families in the order in which they are
+// first added.
+type metrics struct {
+	families []*family
+	index    map[string]*family
+}
+
+func (m *metrics) add(name, help string, typ metricType, value float64, labels ...string) {
+	if m.index == nil {
+		m.index = map[string]*family{}
+	}
+	f, ok := m.index[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		m.index[name] = f
+		m.families = append(m.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (m *metrics) gauge(name, help string, value float64, labels ...string) {
+	m.add(name, help, gauge, value, labels...)
+}
+
+func (m *metrics) counter(name, help string, value float64, labels ...string) {
+	m.add(name, help, counter, value, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeTo writes the metrics using the Prometheus text exposition
+// format, with the samples for each family sorted by their labels.
+func (m *metrics) writeTo(w io.Writer) error {
+	var sb strings.Builder
+	for _, f := range m.families {
+		fmt.Fprintf(&sb, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+		fmt.Fprintf(&sb, "# TYPE %s %s\n", f.name, f.typ)
+		lines := make([]string, 0, len(f.samples))
+		for _, s := range f.samples {
+			var line strings.Builder
+			line.WriteString(f.name)
+			if len(s.labels) > 0 {
+				line.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						line.WriteByte(',')
+					}
+					fmt.Fprintf(&line, "%s=\"%s\"", s.labels[i], labelEscaper.Replace(s.labels[i+1]))
+				}
+				line.WriteByte('}')
+			}
+			line.WriteByte(' ')
+			line.WriteString(formatValue(s.value))
+			lines = append(lines, line.String())
+		}
+		sort.Strings(lines)
+		for _, l := range lines {
+			sb.WriteString(l)
+			sb.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,411 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package mqttbridge provides a bridge between a screenlogic controller
+// and an MQTT broker. The controller's status is published to a topic
+// tree, commands are accepted on a set of command topics and Home
+// Assistant MQTT discovery payloads are published for its circuits,
+// bodies and sensors.
+//
+// The topic tree, relative to Options.TopicPrefix, is:
+//
+//	status                         online or offline
+//	air_temperature                air temperature
+//	freeze_mode                    ON or OFF
+//	body/<pool|spa>/temperature    current water temperature
+//	body/<pool|spa>/heat_set_point heat set point
+//	body/<pool|spa>/cool_set_point cool set point
+//	body/<pool|spa>/heat_mode      off, solar, solar preferred or heater
+//	body/<pool|spa>/mode           off or heat, for Home Assistant
+//	body/<pool|spa>/action         off, idle or heating
+//	circuit/<id>/state             ON or OFF
+//	chemistry/{ph,orp,salt_ppm,saturation}
+//	light/state                    the most recent light command
+//
+// and the command topics are:
+//
+//	circuit/<id>/set               ON or OFF
+//	body/<pool|spa>/heat_set_point/set <temperature>
+//	body/<pool|spa>/heat_mode/set  off, heat or a heat mode name
+//	light/set                      a light command, eg. party or all on
+package mqttbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Controller is the interface to the screenlogic controller used by
+// the bridge, it is implemented by screenlogic.Adapter.
+type Controller interface {
+	GetConfig(ctx context.Context) (protocol.ControllerConfig, error)
+	GetStatus(ctx context.Context) (protocol.ControllerStatus, error)
+	SetCircuit(ctx context.Context, id int, on bool) error
+	SetHeatSetPoint(ctx context.Context, body protocol.BodyType, temp int) error
+	SetHeatMode(ctx context.Context, body protocol.BodyType, mode protocol.HeatMode) error
+	SetLightMode(ctx context.Context, mode protocol.ColorMode) error
+}
+
+// Options configures a Bridge.
+type Options struct {
+	Broker   string // eg. tcp://localhost:1883
+	ClientID string
+	Username string
+	Password string
+
+	// TopicPrefix is the prefix for all status and command topics,
+	// the default is "screenlogic".
+	TopicPrefix string
+
+	// DiscoveryPrefix is the prefix for Home Assistant discovery
+	// topics, the default is "homeassistant".
+	DiscoveryPrefix string
+
+	// DisableDiscovery disables publishing Home Assistant discovery
+	// payloads.
+	DisableDiscovery bool
+
+	// PollInterval is the interval at which the controller's status
+	// is polled, the default is 30s.
+	PollInterval time.Duration
+
+	// Timeout is the time to wait for the broker to acknowledge
+	// connections and publications, the default is 10s.
+	Timeout time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if len(o.ClientID) == 0 {
+		o.ClientID = "screenlogic-bridge"
+	}
+	if len(o.TopicPrefix) == 0 {
+		o.TopicPrefix = "screenlogic"
+	}
+	if len(o.DiscoveryPrefix) == 0 {
+		o.DiscoveryPrefix = "homeassistant"
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = 30 * time.Second
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+}
+
+// Bridge publishes the status of a controller to an MQTT broker and
+// forwards commands received from the broker to the controller.
+type Bridge struct {
+	ctrl   Controller
+	opts   Options
+	pollCh chan struct{}
+
+	ctx    context.Context
+	client mqtt.Client
+
+	mu        sync.Mutex
+	config    protocol.ControllerConfig
+	published map[string]string
+}
+
+// New returns a new Bridge for the specified controller.
+func New(ctrl Controller, opts Options) *Bridge {
+	opts.setDefaults()
+	return &Bridge{
+		ctrl:      ctrl,
+		opts:      opts,
+		pollCh:    make(chan struct{}, 1),
+		published: map[string]string{},
+	}
+}
+
+func (b *Bridge) topic(parts ...string) string {
+	return b.opts.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+// Run connects to the broker and then polls the controller, publishing
+// its status, until the context is canceled. The controller's
+// configuration is obtained once, when Run is called.
+func (b *Bridge) Run(ctx context.Context) error {
+	cfg, err := b.ctrl.GetConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("mqttbridge: %w", err)
+	}
+	b.mu.Lock()
+	b.config = cfg
+	b.mu.Unlock()
+	b.ctx = ctx
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.opts.Broker).
+		SetClientID(b.opts.ClientID).
+		SetUsername(b.opts.Username).
+		SetPassword(b.opts.Password).
+		SetWill(b.topic("status"), "offline", 1, true).
+		SetAutoReconnect(true).
+		SetOrderMatters(false).
+		SetConnectTimeout(b.opts.Timeout).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			ctxlog.Warn(ctx, "screenlogic: mqtt: connection lost", "broker", b.opts.Broker, "err", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	if err := b.wait(b.client.Connect()); err != nil {
+		return fmt.Errorf("mqttbridge: connect to %v: %w", b.opts.Broker, err)
+	}
+	defer func() {
+		_ = b.wait(b.client.Publish(b.topic("status"), 1, true, "offline"))
+		b.client.Disconnect(250)
+	}()
+
+	ticker := time.NewTicker(b.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := b.poll(ctx); err != nil {
+			ctxlog.Warn(ctx, "screenlogic: mqtt: poll failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-b.pollCh:
+		}
+	}
+}
+
+var errTimeout = errors.New("timed out")
+
+func (b *Bridge) wait(tok mqtt.Token) error {
+	if !tok.WaitTimeout(b.opts.Timeout) {
+		return errTimeout
+	}
+	return tok.Error()
+}
+
+// pollNow requests that the controller be polled immediately.
+func (b *Bridge) pollNow() {
+	select {
+	case b.pollCh <- struct{}{}:
+	default:
+	}
+}
+
+// onConnect is called whenever a connection to the broker is
+// established, including reconnections.
+func (b *Bridge) onConnect(client mqtt.Client) {
+	ctx := b.ctx
+	ctxlog.Info(ctx, "screenlogic: mqtt: connected", "broker", b.opts.Broker)
+	b.mu.Lock()
+	b.published = map[string]string{}
+	cfg := b.config
+	b.mu.Unlock()
+	for filter, handler := range map[string]mqtt.MessageHandler{
+		b.topic("circuit", "+", "set"):                b.circuitCommand,
+		b.topic("body", "+", "heat_set_point", "set"): b.setPointCommand,
+		b.topic("body", "+", "heat_mode", "set"):      b.heatModeCommand,
+		b.topic("light", "set"):                       b.lightCommand,
+	} {
+		if err := b.wait(client.Subscribe(filter, 1, handler)); err != nil {
+			ctxlog.Error(ctx, "screenlogic: mqtt: subscribe failed", "topic", filter, "err", err)
+		}
+	}
+	b.publish(ctx, b.topic("status"), "online")
+	if !b.opts.DisableDiscovery {
+		for topic, payload := range b.discovery(cfg) {
+			b.publish(ctx, topic, payload)
+		}
+	}
+	b.pollNow()
+}
+
+// publish publishes a retained message.
+func (b *Bridge) publish(ctx context.Context, topic, payload string) {
+	if err := b.wait(b.client.Publish(topic, 1, true, payload)); err != nil {
+		ctxlog.Warn(ctx, "screenlogic: mqtt: publish failed", "topic", topic, "err", err)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published[topic] = payload
+}
+
+// publishChanged publishes those of the supplied topics whose payloads
+// have changed since they were last published.
+func (b *Bridge) publishChanged(ctx context.Context, state map[string]string) {
+	for topic, payload := range state {
+		b.mu.Lock()
+		prev, ok := b.published[topic]
+		b.mu.Unlock()
+		if ok && prev == payload {
+			continue
+		}
+		b.publish(ctx, topic, payload)
+	}
+}
+
+func (b *Bridge) poll(ctx context.Context) error {
+	st, err := b.ctrl.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	cfg := b.config
+	b.mu.Unlock()
+	b.publishChanged(ctx, b.state(cfg, st))
+	return nil
+}
+
+func onOff(state bool) string {
+	if state {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func bodyName(bt protocol.BodyType) string {
+	return strings.ToLower(bt.String())
+}
+
+// climateMode returns the Home Assistant climate mode for hm.
+func climateMode(hm protocol.HeatMode) string {
+	if hm == protocol.HeatModeOff {
+		return "off"
+	}
+	return "heat"
+}
+
+func climateAction(b protocol.BodyStatus) string {
+	switch {
+	case b.HeatMode == protocol.HeatModeOff:
+		return "off"
+	case b.HeatStatus == protocol.HeatStatusOff:
+		return "idle"
+	}
+	return "heating"
+}
+
+// state returns the payloads for all of the status topics.
+func (b *Bridge) state(cfg protocol.ControllerConfig, st protocol.ControllerStatus) map[string]string {
+	state := map[string]string{
+		b.topic("air_temperature"): strconv.Itoa(st.AirTemp),
+		b.topic("freeze_mode"):     onOff(st.FreezeMode),
+	}
+	for _, body := range st.Bodies {
+		name := bodyName(body.Type)
+		state[b.topic("body", name, "temperature")] = strconv.Itoa(body.CurrentTemp)
+		state[b.topic("body", name, "heat_set_point")] = strconv.Itoa(body.HeatSetPoint)
+		state[b.topic("body", name, "cool_set_point")] = strconv.Itoa(body.CoolSetPoint)
+		state[b.topic("body", name, "heat_mode")] = strings.ToLower(body.HeatMode.String())
+		state[b.topic("body", name, "mode")] = climateMode(body.HeatMode)
+		state[b.topic("body", name, "action")] = climateAction(body)
+	}
+	for _, c := range st.Circuits {
+		state[b.topic("circuit", strconv.Itoa(c.ID), "state")] = onOff(c.State)
+	}
+	if cfg.Equipment&protocol.IntelliChem != 0 {
+		state[b.topic("chemistry", "ph")] = strconv.FormatFloat(st.PH, 'f', 2, 64)
+		state[b.topic("chemistry", "orp")] = strconv.Itoa(st.ORP)
+		state[b.topic("chemistry", "salt_ppm")] = strconv.Itoa(st.SaltPPM)
+		state[b.topic("chemistry", "saturation")] = strconv.FormatFloat(st.Saturation, 'f', 1, 64)
+	}
+	return state
+}
+
+// topicParam returns the element of the topic at the specified index
+// relative to the topic prefix.
+func (b *Bridge) topicParam(topic string, idx int) string {
+	parts := strings.Split(strings.TrimPrefix(topic, b.opts.TopicPrefix+"/"), "/")
+	if idx < len(parts) {
+		return parts[idx]
+	}
+	return ""
+}
+
+// command runs a command received on the specified topic and requests
+// an immediate poll so that its effect is published.
+func (b *Bridge) command(msg mqtt.Message, fn func(ctx context.Context) error) {
+	ctx := b.ctx
+	payload := string(msg.Payload())
+	if err := fn(ctx); err != nil {
+		ctxlog.Warn(ctx, "screenlogic: mqtt: command failed", "topic", msg.Topic(), "payload", payload, "err", err)
+		return
+	}
+	ctxlog.Info(ctx, "screenlogic: mqtt: command", "topic", msg.Topic(), "payload", payload)
+	b.pollNow()
+}
+
+func (b *Bridge) circuitCommand(_ mqtt.Client, msg mqtt.Message) {
+	b.command(msg, func(ctx context.Context) error {
+		id, err := strconv.Atoi(b.topicParam(msg.Topic(), 1))
+		if err != nil {
+			return fmt.Errorf("invalid circuit id: %w", err)
+		}
+		var on bool
+		switch payload := strings.ToUpper(string(msg.Payload())); payload {
+		case "ON":
+			on = true
+		case "OFF":
+		default:
+			return fmt.Errorf("invalid payload: %q", payload)
+		}
+		return b.ctrl.SetCircuit(ctx, id, on)
+	})
+}
+
+func (b *Bridge) setPointCommand(_ mqtt.Client, msg mqtt.Message) {
+	b.command(msg, func(ctx context.Context) error {
+		body, err := protocol.ParseBodyType(b.topicParam(msg.Topic(), 1))
+		if err != nil {
+			return err
+		}
+		// Home Assistant sends temperatures as floating point values.
+		temp, err := strconv.ParseFloat(strings.TrimSpace(string(msg.Payload())), 64)
+		if err != nil {
+			return fmt.Errorf("invalid temperature: %w", err)
+		}
+		return b.ctrl.SetHeatSetPoint(ctx, body, int(math.Round(temp)))
+	})
+}
+
+func (b *Bridge) heatModeCommand(_ mqtt.Client, msg mqtt.Message) {
+	b.command(msg, func(ctx context.Context) error {
+		body, err := protocol.ParseBodyType(b.topicParam(msg.Topic(), 1))
+		if err != nil {
+			return err
+		}
+		var mode protocol.HeatMode
+		switch payload := strings.TrimSpace(string(msg.Payload())); payload {
+		case "heat":
+			mode = protocol.HeatModeHeater
+		default:
+			if mode, err = protocol.ParseHeatMode(payload); err != nil {
+				return err
+			}
+		}
+		return b.ctrl.SetHeatMode(ctx, body, mode)
+	})
+}
+
+func (b *Bridge) lightCommand(_ mqtt.Client, msg mqtt.Message) {
+	b.command(msg, func(ctx context.Context) error {
+		mode, err := protocol.ParseColorMode(strings.TrimSpace(string(msg.Payload())))
+		if err != nil {
+			return err
+		}
+		if err := b.ctrl.SetLightMode(ctx, mode); err != nil {
+			return err
+		}
+		b.publish(ctx, b.topic("light", "state"), mode.String())
+		return nil
+	})
+}
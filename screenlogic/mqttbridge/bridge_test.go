@@ -0,0 +1,217 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package mqttbridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/mqttbridge"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func startSimulator(t *testing.T) (*simulator.Gateway, string) {
+	t.Helper()
+	gw, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return gw, ln.Addr().String()
+}
+
+func newAdapter(t *testing.T, addr string) *screenlogic.Adapter {
+	t.Helper()
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress: addr,
+		KeepAlive: time.Minute,
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// See the comment in screenlogic.newAdapter.
+		time.Sleep(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pa.Close(ctx); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return pa
+}
+
+// broker is an in-process MQTT broker that records the most recent
+// message published to each topic.
+type broker struct {
+	*mqtt.Server
+	addr string
+
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func startBroker(t *testing.T) *broker {
+	t.Helper()
+	srv := mqtt.New(&mqtt.Options{InlineClient: true})
+	if err := srv.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := srv.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	b := &broker{Server: srv, addr: tcp.Address(), messages: map[string]string{}}
+	err := srv.Subscribe("#", 1, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.messages[pk.TopicName] = string(pk.Payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (b *broker) waitFor(t *testing.T, topic, payload string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.Lock()
+		got, ok := b.messages[topic]
+		b.mu.Unlock()
+		if ok && (got == payload || len(payload) == 0) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v: got %q (%v), want %q", topic, got, ok, payload)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (b *broker) discovery(t *testing.T, topic string) map[string]any {
+	t.Helper()
+	b.waitFor(t, topic, "")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var cfg map[string]any
+	if err := json.Unmarshal([]byte(b.messages[topic]), &cfg); err != nil {
+		t.Fatalf("%v: %v", topic, err)
+	}
+	return cfg
+}
+
+func (b *broker) publish(t *testing.T, topic, payload string) {
+	t.Helper()
+	if err := b.Publish(topic, []byte(payload), false, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	gw, addr := startSimulator(t)
+	brk := startBroker(t)
+	bridge := mqttbridge.New(newAdapter(t, addr), mqttbridge.Options{
+		Broker:       "tcp://" + brk.addr,
+		PollInterval: time.Minute,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- bridge.Run(ctx)
+	}()
+
+	brk.waitFor(t, "screenlogic/status", "online")
+	brk.waitFor(t, "screenlogic/air_temperature", "72")
+	brk.waitFor(t, "screenlogic/circuit/505/state", "ON")
+	brk.waitFor(t, "screenlogic/circuit/502/state", "OFF")
+	brk.waitFor(t, "screenlogic/body/pool/temperature", "78")
+	brk.waitFor(t, "screenlogic/body/pool/heat_mode", "heater")
+	brk.waitFor(t, "screenlogic/body/pool/action", "heating")
+	brk.waitFor(t, "screenlogic/body/spa/mode", "off")
+	brk.waitFor(t, "screenlogic/chemistry/ph", "7.40")
+
+	light := brk.discovery(t, "homeassistant/light/screenlogic_100/circuit_502/config")
+	if got, want := light["command_topic"], "screenlogic/circuit/502/set"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := light["name"], "Pool Light"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	sw := brk.discovery(t, "homeassistant/switch/screenlogic_100/circuit_505/config")
+	if got, want := sw["state_topic"], "screenlogic/circuit/505/state"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	climate := brk.discovery(t, "homeassistant/climate/screenlogic_100/spa_heater/config")
+	if got, want := climate["temperature_command_topic"], "screenlogic/body/spa/heat_set_point/set"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	brk.discovery(t, "homeassistant/sensor/screenlogic_100/salt_ppm/config")
+
+	brk.publish(t, "screenlogic/circuit/502/set", "ON")
+	brk.waitFor(t, "screenlogic/circuit/502/state", "ON")
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+
+	brk.publish(t, "screenlogic/body/spa/heat_set_point/set", "101.0")
+	brk.waitFor(t, "screenlogic/body/spa/heat_set_point", "101")
+	brk.publish(t, "screenlogic/body/spa/heat_mode/set", "heat")
+	brk.waitFor(t, "screenlogic/body/spa/mode", "heat")
+	brk.waitFor(t, "screenlogic/body/spa/action", "heating")
+
+	brk.publish(t, "screenlogic/light/set", "caribbean")
+	brk.waitFor(t, "screenlogic/light/state", "Caribbean")
+	if got, want := gw.LightMode(), protocol.ColorCaribbean; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Invalid commands are ignored.
+	brk.publish(t, "screenlogic/circuit/502/set", "maybe")
+	brk.publish(t, "screenlogic/circuit/999/set", "ON")
+
+	// Changes made outside of the bridge are published when next polled.
+	if err := gw.SetCircuit(504, true); err != nil {
+		t.Fatal(err)
+	}
+	brk.publish(t, "screenlogic/circuit/502/set", "OFF")
+	brk.waitFor(t, "screenlogic/circuit/504/state", "ON")
+	brk.waitFor(t, "screenlogic/circuit/502/state", "OFF")
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	brk.waitFor(t, "screenlogic/status", "offline")
+}
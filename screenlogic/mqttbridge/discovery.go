@@ -0,0 +1,194 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package mqttbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// haEntity is the union of the Home Assistant MQTT discovery fields used
+// for the entities published by the bridge.
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	Device            haDevice `json:"device"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Icon              string   `json:"icon,omitempty"`
+
+	// switch, light, sensor and select.
+	StateTopic   string `json:"state_topic,omitempty"`
+	CommandTopic string `json:"command_topic,omitempty"`
+	PayloadOn    string `json:"payload_on,omitempty"`
+	PayloadOff   string `json:"payload_off,omitempty"`
+
+	// sensor.
+	DeviceClass       string `json:"device_class,omitempty"`
+	StateClass        string `json:"state_class,omitempty"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+
+	// select.
+	Options []string `json:"options,omitempty"`
+
+	// climate.
+	CurrentTemperatureTopic string   `json:"current_temperature_topic,omitempty"`
+	TemperatureStateTopic   string   `json:"temperature_state_topic,omitempty"`
+	TemperatureCommandTopic string   `json:"temperature_command_topic,omitempty"`
+	ModeStateTopic          string   `json:"mode_state_topic,omitempty"`
+	ModeCommandTopic        string   `json:"mode_command_topic,omitempty"`
+	ActionTopic             string   `json:"action_topic,omitempty"`
+	Modes                   []string `json:"modes,omitempty"`
+	TemperatureUnit         string   `json:"temperature_unit,omitempty"`
+	Precision               float64  `json:"precision,omitempty"`
+}
+
+// isLight returns true if the circuit should be represented as a Home
+// Assistant light rather than a switch.
+func isLight(c protocol.Circuit) bool {
+	if c.Interface == protocol.InterfaceLights {
+		return true
+	}
+	switch c.Function {
+	case protocol.CircuitLight, protocol.CircuitDimmer, protocol.CircuitSAMLight,
+		protocol.CircuitSALLight, protocol.CircuitPhotoNextGen, protocol.CircuitColorWheel,
+		protocol.CircuitIntelliBrite, protocol.CircuitMagicStream, protocol.CircuitDimmer25:
+		return true
+	}
+	return false
+}
+
+func circuitIcon(c protocol.Circuit) string {
+	switch c.Function {
+	case protocol.CircuitPool, protocol.CircuitSecondPool:
+		return "mdi:pool"
+	case protocol.CircuitSpa, protocol.CircuitSecondSpa:
+		return "mdi:hot-tub"
+	case protocol.CircuitCleaner, protocol.CircuitMasterCleaner, protocol.CircuitFloorCleaner:
+		return "mdi:robot-vacuum"
+	case protocol.CircuitSpillway, protocol.CircuitValve:
+		return "mdi:waterfall"
+	}
+	return ""
+}
+
+// discovery returns the Home Assistant discovery payloads, keyed by
+// topic, for the controller's circuits, bodies and sensors.
+func (b *Bridge) discovery(cfg protocol.ControllerConfig) map[string]string {
+	node := fmt.Sprintf("screenlogic_%v", cfg.ID)
+	device := haDevice{
+		Identifiers:  []string{node},
+		Name:         "Pentair ScreenLogic",
+		Manufacturer: "Pentair",
+		Model:        cfg.Model,
+	}
+	units := "F"
+	if cfg.Celsius {
+		units = "C"
+	}
+	entities := map[string]haEntity{}
+	add := func(component, object string, e haEntity) {
+		e.UniqueID = node + "_" + object
+		e.Device = device
+		e.AvailabilityTopic = b.topic("status")
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", b.opts.DiscoveryPrefix, component, node, object)
+		entities[topic] = e
+	}
+
+	for _, c := range cfg.Circuits {
+		if c.Interface == protocol.InterfaceDontShow || c.Interface == protocol.InterfaceInvalid {
+			continue
+		}
+		id := strconv.Itoa(c.ID)
+		component := "switch"
+		if isLight(c) {
+			component = "light"
+		}
+		add(component, "circuit_"+id, haEntity{
+			Name:         c.Name,
+			Icon:         circuitIcon(c),
+			StateTopic:   b.topic("circuit", id, "state"),
+			CommandTopic: b.topic("circuit", id, "set"),
+			PayloadOn:    "ON",
+			PayloadOff:   "OFF",
+		})
+	}
+
+	for _, bt := range []protocol.BodyType{protocol.BodyPool, protocol.BodySpa} {
+		name := bodyName(bt)
+		add("climate", name+"_heater", haEntity{
+			Name:                    bt.String() + " Heater",
+			CurrentTemperatureTopic: b.topic("body", name, "temperature"),
+			TemperatureStateTopic:   b.topic("body", name, "heat_set_point"),
+			TemperatureCommandTopic: b.topic("body", name, "heat_set_point", "set"),
+			ModeStateTopic:          b.topic("body", name, "mode"),
+			ModeCommandTopic:        b.topic("body", name, "heat_mode", "set"),
+			ActionTopic:             b.topic("body", name, "action"),
+			Modes:                   []string{"off", "heat"},
+			TemperatureUnit:         units,
+			Precision:               1,
+		})
+	}
+
+	add("sensor", "air_temperature", haEntity{
+		Name:              "Air Temperature",
+		StateTopic:        b.topic("air_temperature"),
+		DeviceClass:       "temperature",
+		StateClass:        "measurement",
+		UnitOfMeasurement: "°" + units,
+	})
+	add("binary_sensor", "freeze_mode", haEntity{
+		Name:       "Freeze Mode",
+		Icon:       "mdi:snowflake",
+		StateTopic: b.topic("freeze_mode"),
+		PayloadOn:  "ON",
+		PayloadOff: "OFF",
+	})
+	if cfg.Equipment&protocol.IntelliChem != 0 {
+		for _, s := range []struct {
+			object, name, units string
+		}{
+			{"ph", "pH", ""},
+			{"orp", "ORP", "mV"},
+			{"salt_ppm", "Salt", "ppm"},
+			{"saturation", "Saturation Index", ""},
+		} {
+			add("sensor", s.object, haEntity{
+				Name:              s.name,
+				StateTopic:        b.topic("chemistry", s.object),
+				StateClass:        "measurement",
+				UnitOfMeasurement: s.units,
+			})
+		}
+	}
+
+	var modes []string
+	for cm := protocol.ColorAllOff; cm <= protocol.ColorHold; cm++ {
+		modes = append(modes, cm.String())
+	}
+	add("select", "light_mode", haEntity{
+		Name:         "Light Mode",
+		Icon:         "mdi:palette",
+		StateTopic:   b.topic("light", "state"),
+		CommandTopic: b.topic("light", "set"),
+		Options:      modes,
+	})
+
+	payloads := make(map[string]string, len(entities))
+	for topic, e := range entities {
+		buf, _ := json.Marshal(e) // cannot fail for haEntity.
+		payloads[topic] = string(buf)
+	}
+	return payloads
+}
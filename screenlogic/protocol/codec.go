@@ -0,0 +1,351 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Marshal encodes the supplied struct (or pointer to a struct) using the
+// little-endian wire format used by screenlogic messages. Fields are
+// encoded in the order in which they are declared and their wire
+// representation is controlled by an `sl` struct tag as follows:
+//
+//	sl:"uint8", sl:"uint16", sl:"uint32", sl:"int8", sl:"int16", sl:"int32"
+//	    the width and signedness of an integer or bool field, fields
+//	    with a fixed size type (eg. uint16) need not be tagged but int,
+//	    uint and bool fields must be.
+//	sl:"string"
+//	    a string that is encoded as a uint32 length followed by the
+//	    string's bytes padded to a multiple of 4 bytes, this is the
+//	    default for string fields.
+//	sl:"count=uint8|uint16|uint32"
+//	    the width of the element count that prefixes a slice, the
+//	    default is uint32. Any other tag values apply to the elements
+//	    of the slice. Arrays are encoded without a count.
+//	sl:"skip=<n>"
+//	    n bytes that are ignored when decoding and encoded as zeros,
+//	    typically used with a blank field, eg. _ struct{} `sl:"skip=3"`.
+//	sl:"-"
+//	    the field is not part of the wire format.
+func Marshal(v any) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("marshal: %T is not a struct", v)
+	}
+	return encodeValue(nil, rv, wireTag{})
+}
+
+// MarshalMessage returns a new Message with the supplied id and code
+// whose payload is the result of calling Marshal on v.
+func MarshalMessage(id uint16, code MsgCode, v any) (Message, error) {
+	pl, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return NewMessage(id, code, pl), nil
+}
+
+// Unmarshal decodes buf into the struct pointed to by v using the
+// same rules as Marshal. It returns an error that wraps ErrInvalidResponse
+// if buf is too small or contains data beyond that described by v.
+func Unmarshal(buf []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal: %T is not a pointer to a struct", v)
+	}
+	rest, ok, err := decodeValue(buf, true, rv.Elem(), wireTag{})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unmarshal: message too small: %w", ErrInvalidResponse)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("unmarshal: spurious data: %d bytes: %w", len(rest), ErrInvalidResponse)
+	}
+	return nil
+}
+
+type wireTag struct {
+	width  int  // width in bytes of an integer or bool.
+	signed bool // true if the tag specified a signed integer.
+	count  int  // width in bytes of a slice count.
+	skip   int
+	ignore bool
+}
+
+var tagWidths = map[string]int{
+	"uint8": 1, "int8": 1,
+	"uint16": 2, "int16": 2,
+	"uint32": 4, "int32": 4,
+}
+
+func parseTag(tag string) (wireTag, error) {
+	var wt wireTag
+	if tag == "-" {
+		wt.ignore = true
+		return wt, nil
+	}
+	for _, t := range strings.Split(tag, ",") {
+		name, val, _ := strings.Cut(strings.TrimSpace(t), "=")
+		switch name {
+		case "", "string":
+		case "count":
+			w, ok := tagWidths[val]
+			if !ok {
+				return wt, fmt.Errorf("invalid count width: %q", val)
+			}
+			wt.count = w
+		case "skip":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return wt, fmt.Errorf("invalid skip value: %q", val)
+			}
+			wt.skip = n
+		default:
+			w, ok := tagWidths[name]
+			if !ok {
+				return wt, fmt.Errorf("unrecognised tag value: %q", name)
+			}
+			wt.width = w
+			wt.signed = strings.HasPrefix(name, "int")
+		}
+	}
+	return wt, nil
+}
+
+// intWidth returns the wire width for an integer or bool value.
+func intWidth(v reflect.Value, tag wireTag) (int, error) {
+	if tag.width != 0 {
+		return tag.width, nil
+	}
+	switch v.Kind() {
+	case reflect.Int8, reflect.Uint8:
+		return 1, nil
+	case reflect.Int16, reflect.Uint16:
+		return 2, nil
+	case reflect.Int32, reflect.Uint32:
+		return 4, nil
+	}
+	return 0, fmt.Errorf("%v requires an explicit width tag", v.Type())
+}
+
+func countWidth(tag wireTag) int {
+	if tag.count == 0 {
+		return 4
+	}
+	return tag.count
+}
+
+func appendUint(buf []byte, width int, val uint64) []byte {
+	switch width {
+	case 1:
+		return append(buf, uint8(val))
+	case 2:
+		return binary.LittleEndian.AppendUint16(buf, uint16(val))
+	}
+	return binary.LittleEndian.AppendUint32(buf, uint32(val))
+}
+
+func decodeUint(buf []byte, ok bool, width int) ([]byte, bool, uint64) {
+	switch width {
+	case 1:
+		var v uint8
+		buf, ok = DecodeUint8(buf, ok, &v)
+		return buf, ok, uint64(v)
+	case 2:
+		var v uint16
+		buf, ok = DecodeUint16(buf, ok, &v)
+		return buf, ok, uint64(v)
+	}
+	var v uint32
+	buf, ok = DecodeUint32(buf, ok, &v)
+	return buf, ok, uint64(v)
+}
+
+// signExtend interprets the low width bytes of val as a two's complement
+// signed integer.
+func signExtend(val uint64, width int) int64 {
+	shift := 64 - 8*width
+	return int64(val<<shift) >> shift //nolint:gosec // intended conversion.
+}
+
+func encodeFields(buf []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, err := parseTag(f.Tag.Get("sl"))
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", t, f.Name, err)
+		}
+		switch {
+		case tag.ignore:
+			continue
+		case tag.skip > 0:
+			buf = append(buf, make([]byte, tag.skip)...)
+			continue
+		case !f.IsExported():
+			return nil, fmt.Errorf("%v.%v: unexported fields must be tagged with skip or -", t, f.Name)
+		}
+		if buf, err = encodeValue(buf, v.Field(i), tag); err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", t, f.Name, err)
+		}
+	}
+	return buf, nil
+}
+
+func encodeValue(buf []byte, v reflect.Value, tag wireTag) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		return encodeFields(buf, v)
+	case reflect.Bool:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, err
+		}
+		if v.Bool() {
+			return appendUint(buf, w, 1), nil
+		}
+		return appendUint(buf, w, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, err
+		}
+		return appendUint(buf, w, uint64(v.Int())), nil //nolint:gosec // truncated to width.
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, err
+		}
+		return appendUint(buf, w, v.Uint()), nil
+	case reflect.String:
+		s := v.String()
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+		buf = append(buf, s...)
+		return append(buf, make([]byte, roundTo4(len(s))-uint32(len(s)))...), nil
+	case reflect.Slice:
+		buf = appendUint(buf, countWidth(tag), uint64(v.Len()))
+		return encodeElems(buf, v, tag)
+	case reflect.Array:
+		return encodeElems(buf, v, tag)
+	}
+	return nil, fmt.Errorf("unsupported type: %v", v.Type())
+}
+
+func encodeElems(buf []byte, v reflect.Value, tag wireTag) ([]byte, error) {
+	var err error
+	for i := range v.Len() {
+		if buf, err = encodeValue(buf, v.Index(i), tag); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func decodeFields(buf []byte, ok bool, v reflect.Value) ([]byte, bool, error) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, err := parseTag(f.Tag.Get("sl"))
+		if err != nil {
+			return nil, false, fmt.Errorf("%v.%v: %w", t, f.Name, err)
+		}
+		switch {
+		case tag.ignore:
+			continue
+		case tag.skip > 0:
+			buf, ok = DecodeSkip(buf, ok, tag.skip)
+			continue
+		case !f.IsExported():
+			return nil, false, fmt.Errorf("%v.%v: unexported fields must be tagged with skip or -", t, f.Name)
+		}
+		if buf, ok, err = decodeValue(buf, ok, v.Field(i), tag); err != nil {
+			return nil, false, fmt.Errorf("%v.%v: %w", t, f.Name, err)
+		}
+		if !ok {
+			break
+		}
+	}
+	return buf, ok, nil
+}
+
+func decodeValue(buf []byte, ok bool, v reflect.Value, tag wireTag) ([]byte, bool, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		return decodeFields(buf, ok, v)
+	case reflect.Bool:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, false, err
+		}
+		var val uint64
+		buf, ok, val = decodeUint(buf, ok, w)
+		v.SetBool(val != 0)
+		return buf, ok, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, false, err
+		}
+		var val uint64
+		buf, ok, val = decodeUint(buf, ok, w)
+		if tag.width != 0 && !tag.signed {
+			v.SetInt(int64(val)) //nolint:gosec // at most 32 bits.
+		} else {
+			v.SetInt(signExtend(val, w))
+		}
+		return buf, ok, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		w, err := intWidth(v, tag)
+		if err != nil {
+			return nil, false, err
+		}
+		var val uint64
+		buf, ok, val = decodeUint(buf, ok, w)
+		v.SetUint(val)
+		return buf, ok, nil
+	case reflect.String:
+		var s string
+		buf, ok = DecodeString(buf, ok, &s)
+		v.SetString(s)
+		return buf, ok, nil
+	case reflect.Slice:
+		var n uint64
+		buf, ok, n = decodeUint(buf, ok, countWidth(tag))
+		if !ok {
+			return buf, false, nil
+		}
+		// Guard against allocating a large slice for a corrupt count,
+		// every element requires at least one byte.
+		if n > uint64(len(buf)) {
+			return buf, false, nil
+		}
+		if n == 0 {
+			v.SetZero()
+			return buf, ok, nil
+		}
+		v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		return decodeElems(buf, ok, v, tag)
+	case reflect.Array:
+		return decodeElems(buf, ok, v, tag)
+	}
+	return nil, false, fmt.Errorf("unsupported type: %v", v.Type())
+}
+
+func decodeElems(buf []byte, ok bool, v reflect.Value, tag wireTag) ([]byte, bool, error) {
+	var err error
+	for i := range v.Len() {
+		if buf, ok, err = decodeValue(buf, ok, v.Index(i), tag); err != nil || !ok {
+			return buf, ok, err
+		}
+	}
+	return buf, ok, nil
+}
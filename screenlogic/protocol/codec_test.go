@@ -0,0 +1,179 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+type codecElem struct {
+	Name  string
+	Value int `sl:"uint16"`
+}
+
+type codecExample struct {
+	A      uint8
+	B      uint16
+	C      uint32
+	D      int32
+	E      int      `sl:"int8"`
+	F      bool     `sl:"uint32"`
+	_      struct{} `sl:"skip=3"`
+	G      string
+	H      []codecElem `sl:"count=uint8"`
+	I      [3]uint8
+	J      []int16
+	Ignore string `sl:"-"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := codecExample{
+		A: 1, B: 0x203, C: 0x4050607, D: -3, E: -1, F: true,
+		G: "hello",
+		H: []codecElem{{"x", 1}, {"abcd", 0xffff}},
+		I: [3]uint8{7, 8, 9},
+		J: []int16{-1, 2},
+	}
+	buf, err := protocol.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		1,
+		3, 2,
+		7, 6, 5, 4,
+		0xfd, 0xff, 0xff, 0xff,
+		0xff,
+		1, 0, 0, 0,
+		0, 0, 0,
+		5, 0, 0, 0, 'h', 'e', 'l', 'l', 'o', 0, 0, 0,
+		2,
+		1, 0, 0, 0, 'x', 0, 0, 0, 1, 0,
+		4, 0, 0, 0, 'a', 'b', 'c', 'd', 0xff, 0xff,
+		7, 8, 9,
+		2, 0, 0, 0, 0xff, 0xff, 2, 0,
+	}
+	if !bytes.Equal(buf, want) {
+		t.Fatalf("got %v, want %v", buf, want)
+	}
+
+	var out codecExample
+	if err := protocol.Unmarshal(buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out, in; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for i := range len(buf) {
+		err := protocol.Unmarshal(buf[:i], &out)
+		if !errors.Is(err, protocol.ErrInvalidResponse) {
+			t.Errorf("%v: missing or wrong error: %v", i, err)
+		}
+	}
+	err = protocol.Unmarshal(append(buf, 0), &out)
+	if !errors.Is(err, protocol.ErrInvalidResponse) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	type untagged struct{ A int }
+	type badTag struct {
+		A uint8 `sl:"uint64"`
+	}
+	type unsupported struct{ A float32 }
+	for _, tc := range []any{untagged{}, badTag{}, unsupported{}, 3} {
+		if _, err := protocol.Marshal(tc); err == nil {
+			t.Errorf("%T: expected an error", tc)
+		}
+	}
+	if err := protocol.Unmarshal([]byte{1, 2, 3, 4}, untagged{}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestDecodeControllerStatus(t *testing.T) {
+	type body struct {
+		Type, Temp, HeatStatus, HeatSetPoint, CoolSetPoint, HeatMode int32
+	}
+	type circuit struct {
+		ID                                 uint32
+		State                              uint32
+		ColorSet, ColorPos, Stagger, Delay uint8
+	}
+	type status struct {
+		State    uint32
+		Skipped  [8]uint8
+		AirTemp  int32
+		Bodies   []body
+		Circuits []circuit
+		Chem     [7]int32
+	}
+	st := status{
+		State:    uint32(protocol.ControllerReady),
+		Bodies:   []body{{Type: 0}, {Type: 1}},
+		Circuits: []circuit{{ID: 500, State: 1}, {ID: 501}},
+	}
+	st.Chem[6] = 3
+	m, err := protocol.MarshalMessage(1, protocol.MsgGetStatus+1, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := protocol.DecodeControllerStatus(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := protocol.ControllerStatus{
+		State:  protocol.ControllerReady,
+		Bodies: []protocol.BodyStatus{{Type: protocol.BodyPool}, {Type: protocol.BodySpa}},
+		Circuits: []protocol.CircuitStatus{
+			{ID: 500, State: true},
+			{ID: 501, State: false},
+		},
+		Alert: 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	_, err = protocol.DecodeControllerStatus(m[:len(m)-1])
+	if !errors.Is(err, protocol.ErrInvalidResponse) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestPumpStatus(t *testing.T) {
+	ps := protocol.PumpStatus{
+		Type:    1,
+		Running: true,
+		Watts:   850,
+		RPM:     2450,
+		GPM:     45,
+		Circuits: []protocol.PumpCircuit{
+			{CircuitID: 505, Speed: 2450, IsRPM: true},
+			{CircuitID: 500, Speed: 30},
+		},
+	}
+	pl, err := protocol.EncodePumpStatus(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 7 fixed fields and 8 circuits of 3 fields, all uint32.
+	if got, want := len(pl), (7+8*3)*4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got, err := protocol.DecodePumpStatus(protocol.NewMessage(1, protocol.MsgGetPumpStatus+1, pl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ps) {
+		t.Errorf("got %+v, want %+v", got, ps)
+	}
+}
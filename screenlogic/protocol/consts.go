@@ -4,7 +4,10 @@
 
 package protocol
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type MsgID int
 type MsgCode uint16
@@ -14,13 +17,29 @@ const (
 	MsgBadLogin       MsgCode = 13
 	MsgInvalidRequest MsgCode = 30
 	MsgBadParameter   MsgCode = 31
+	MsgChallenge      MsgCode = 14
+	MsgPing           MsgCode = 16
 
 	MsgGetDateTime MsgCode = 8110
 	MsgGetVersion  MsgCode = 8120
 	MsgGetConfig   MsgCode = 12532
 	MsgGetStatus   MsgCode = 12526
 
-	MsgButtonPress MsgCode = 12530
+	MsgButtonPress     MsgCode = 12530
+	MsgSetHeatSetPoint MsgCode = 12528
+	MsgSetHeatMode     MsgCode = 12538
+	MsgLightCommand    MsgCode = 12556
+	MsgGetSchedules    MsgCode = 12542
+	MsgCancelDelay     MsgCode = 12580
+	MsgGetPumpStatus   MsgCode = 12584
+	MsgGetChemData     MsgCode = 12592
+
+	MsgAddClient    MsgCode = 12522
+	MsgRemoveClient MsgCode = 12524
+
+	MsgStatusChanged    MsgCode = 12500
+	MsgChemistryChanged MsgCode = 12505
+	MsgWeatherChanged   MsgCode = 9806
 )
 
 var (
@@ -56,6 +75,114 @@ func (cs ControllerState) String() string {
 	return ""
 }
 
+// ParseControllerState returns the ControllerState for the supplied
+// name, ignoring case.
+func ParseControllerState(name string) (ControllerState, error) {
+	for cs := ControllerUnknownState; cs <= ControllerService; cs++ {
+		if strings.EqualFold(name, cs.String()) {
+			return cs, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown controller state: %q", name)
+}
+
+type BodyType int
+
+const (
+	BodyPool BodyType = iota
+	BodySpa
+)
+
+func (bt BodyType) String() string {
+	switch bt {
+	case BodyPool:
+		return "Pool"
+	case BodySpa:
+		return "Spa"
+	}
+	return ""
+}
+
+// ParseBodyType returns the BodyType for the supplied name, ignoring case.
+func ParseBodyType(name string) (BodyType, error) {
+	for _, bt := range []BodyType{BodyPool, BodySpa} {
+		if strings.EqualFold(name, bt.String()) {
+			return bt, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown body type: %q", name)
+}
+
+type HeatMode int
+
+const (
+	HeatModeOff HeatMode = iota
+	HeatModeSolar
+	HeatModeSolarPreferred
+	HeatModeHeater
+	HeatModeUnchanged
+)
+
+func (hm HeatMode) String() string {
+	switch hm {
+	case HeatModeOff:
+		return "Off"
+	case HeatModeSolar:
+		return "Solar"
+	case HeatModeSolarPreferred:
+		return "Solar Preferred"
+	case HeatModeHeater:
+		return "Heater"
+	case HeatModeUnchanged:
+		return "Unchanged"
+	}
+	return ""
+}
+
+// ParseHeatMode returns the HeatMode for the supplied name, ignoring case.
+func ParseHeatMode(name string) (HeatMode, error) {
+	for hm := HeatModeOff; hm <= HeatModeUnchanged; hm++ {
+		if strings.EqualFold(name, hm.String()) {
+			return hm, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown heat mode: %q", name)
+}
+
+type HeatStatus int
+
+const (
+	HeatStatusOff HeatStatus = iota
+	HeatStatusSolar
+	HeatStatusHeater
+	HeatStatusBoth
+)
+
+func (hs HeatStatus) String() string {
+	switch hs {
+	case HeatStatusOff:
+		return "Off"
+	case HeatStatusSolar:
+		return "Solar"
+	case HeatStatusHeater:
+		return "Heater"
+	case HeatStatusBoth:
+		return "Both"
+	}
+	return ""
+}
+
+// ParseHeatStatus returns the HeatStatus for the supplied name, ignoring
+// case.
+func ParseHeatStatus(name string) (HeatStatus, error) {
+	for hs := HeatStatusOff; hs <= HeatStatusBoth; hs++ {
+		if strings.EqualFold(name, hs.String()) {
+			return hs, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown heat status: %q", name)
+}
+
 type EquipmentFlags int
 
 const (
@@ -108,6 +235,51 @@ const (
 	ColorHold
 )
 
+var colorLookup = []string{
+	"All Off",
+	"All On",
+	"Set",
+	"Sync",
+	"Swim",
+	"Party",
+	"Romance",
+	"Caribbean",
+	"American",
+	"Sunset",
+	"Royal",
+	"Save",
+	"Recall",
+	"Blue",
+	"Green",
+	"Red",
+	"Magenta",
+	"Thumper",
+	"Next Mode",
+	"Reset",
+	"Hold",
+}
+
+func (cm ColorMode) String() string {
+	if cm >= 0 && int(cm) < len(colorLookup) {
+		return colorLookup[cm]
+	}
+	return ""
+}
+
+// ParseColorMode returns the ColorMode for the supplied name, ignoring
+// case and spaces, eg. "all off", "alloff" and "All Off" are equivalent.
+func ParseColorMode(name string) (ColorMode, error) {
+	squash := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	}
+	for i, n := range colorLookup {
+		if squash(name) == squash(n) {
+			return ColorMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown color mode: %q", name)
+}
+
 type CircuitFunction int
 
 const (
@@ -163,6 +335,17 @@ func (cf CircuitFunction) String() string {
 	return ""
 }
 
+// ParseCircuitFunction returns the CircuitFunction for the supplied
+// name, ignoring case.
+func ParseCircuitFunction(name string) (CircuitFunction, error) {
+	for i, n := range cfLookup {
+		if strings.EqualFold(name, n) {
+			return CircuitFunction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown circuit function: %q", name)
+}
+
 type CircuitInterface int
 
 const (
@@ -193,3 +376,14 @@ func (ifc CircuitInterface) String() string {
 	}
 	return ""
 }
+
+// ParseCircuitInterface returns the CircuitInterface for the supplied
+// name, ignoring case.
+func ParseCircuitInterface(name string) (CircuitInterface, error) {
+	for i, n := range ciLookup {
+		if strings.EqualFold(name, n) {
+			return CircuitInterface(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown circuit interface: %q", name)
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+)
+
+// HeatSetPoint is the payload of a MsgSetHeatSetPoint request.
+type HeatSetPoint struct {
+	Controller  uint32
+	Body        BodyType `sl:"uint32"`
+	Temperature int      `sl:"uint32"`
+}
+
+// HeatModeRequest is the payload of a MsgSetHeatMode request.
+type HeatModeRequest struct {
+	Controller uint32
+	Body       BodyType `sl:"uint32"`
+	Mode       HeatMode `sl:"uint32"`
+}
+
+// LightCommand is the payload of a MsgLightCommand request.
+type LightCommand struct {
+	Controller uint32
+	Mode       ColorMode `sl:"uint32"`
+}
+
+// sendCommand sends a request whose response has no payload.
+func sendCommand(ctx context.Context, s *Session, code MsgCode, req any) error {
+	id := s.NextID()
+	m, err := MarshalMessage(id, code, req)
+	if err != nil {
+		return err
+	}
+	rm, err := sendAndValidate(ctx, s, m, id, code)
+	if err != nil {
+		return err
+	}
+	if len(rm.Payload()) != 0 {
+		return fmt.Errorf("unexpected response: %w", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// SetHeatSetPoint sets the temperature that the specified body is
+// heated to.
+func SetHeatSetPoint(ctx context.Context, s *Session, body BodyType, temp int) error {
+	if err := sendCommand(ctx, s, MsgSetHeatSetPoint, HeatSetPoint{Body: body, Temperature: temp}); err != nil {
+		return fmt.Errorf("setHeatSetPoint: %w", err)
+	}
+	return nil
+}
+
+// SetHeatMode sets the heat mode for the specified body.
+func SetHeatMode(ctx context.Context, s *Session, body BodyType, mode HeatMode) error {
+	if err := sendCommand(ctx, s, MsgSetHeatMode, HeatModeRequest{Body: body, Mode: mode}); err != nil {
+		return fmt.Errorf("setHeatMode: %w", err)
+	}
+	return nil
+}
+
+// SendLightCommand sends the specified color mode command to all of
+// the color lights.
+func SendLightCommand(ctx context.Context, s *Session, mode ColorMode) error {
+	if err := sendCommand(ctx, s, MsgLightCommand, LightCommand{Mode: mode}); err != nil {
+		return fmt.Errorf("sendLightCommand: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind identifies the type of a Change.
+type ChangeKind int
+
+const (
+	ChangeCircuitOn ChangeKind = iota
+	ChangeCircuitOff
+	ChangeCircuitAdded
+	ChangeCircuitRemoved
+	ChangeCircuitRenamed
+	ChangeCircuitModified // The circuit's function or interface changed.
+	ChangeTemperature
+	ChangeHeatSetPoint
+	ChangeCoolSetPoint
+	ChangeHeatMode
+	ChangeHeatStatus
+	ChangeAlarmRaised
+	ChangeAlarmCleared
+	ChangeChemistry
+	ChangeControllerState
+)
+
+var ckLookup = []string{
+	"circuit_on",
+	"circuit_off",
+	"circuit_added",
+	"circuit_removed",
+	"circuit_renamed",
+	"circuit_modified",
+	"temperature",
+	"heat_set_point",
+	"cool_set_point",
+	"heat_mode",
+	"heat_status",
+	"alarm_raised",
+	"alarm_cleared",
+	"chemistry",
+	"controller_state",
+}
+
+func (ck ChangeKind) String() string {
+	if ck >= 0 && int(ck) < len(ckLookup) {
+		return ckLookup[ck]
+	}
+	return ""
+}
+
+// ParseChangeKind returns the ChangeKind for the supplied name, ignoring
+// case.
+func ParseChangeKind(name string) (ChangeKind, error) {
+	for i, n := range ckLookup {
+		if strings.EqualFold(name, n) {
+			return ChangeKind(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown change kind: %q", name)
+}
+
+func (ck ChangeKind) MarshalText() ([]byte, error) {
+	return marshalEnum(ck.String(), int(ck))
+}
+
+func (ck *ChangeKind) UnmarshalText(text []byte) (err error) {
+	*ck, err = unmarshalEnum(text, ParseChangeKind)
+	return
+}
+
+// Names used for Change.Name for changes that do not refer to a circuit
+// or body.
+const (
+	ChangeNameAir        = "Air"
+	ChangeNameFreezeMode = "Freeze Mode"
+	ChangeNameAlert      = "Alert"
+	ChangeNamePH         = "pH"
+	ChangeNameORP        = "ORP"
+	ChangeNameSaturation = "Saturation"
+	ChangeNameSaltPPM    = "Salt"
+	ChangeNamePHTank     = "pH Tank"
+	ChangeNameORPTank    = "ORP Tank"
+)
+
+// Change represents a single change between two ControllerStatus or
+// ControllerConfig values.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+
+	// ID is the circuit ID for circuit changes.
+	ID int `json:"id,omitempty"`
+
+	// Name is the circuit's name, if known, for circuit changes, the
+	// body's name, ie. Pool or Spa, for body changes and one of the
+	// ChangeName constants otherwise.
+	Name string `json:"name,omitempty"`
+
+	// Prev and Next are the previous and new values for all changes
+	// other than circuit changes. Heat modes, heat status and controller
+	// state are represented by their numeric values and booleans by 0
+	// and 1.
+	Prev float64 `json:"prev"`
+	Next float64 `json:"next"`
+
+	// PrevName is the previous name of a renamed circuit.
+	PrevName string `json:"prev_name,omitempty"`
+}
+
+// Delta returns the difference between the new and previous values.
+func (c Change) Delta() float64 {
+	return c.Next - c.Prev
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (c Change) circuit() string {
+	if len(c.Name) == 0 {
+		return fmt.Sprintf("circuit %v", c.ID)
+	}
+	return fmt.Sprintf("circuit %v (%v)", c.ID, c.Name)
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeCircuitOn:
+		return c.circuit() + ": on"
+	case ChangeCircuitOff:
+		return c.circuit() + ": off"
+	case ChangeCircuitAdded:
+		return c.circuit() + ": added"
+	case ChangeCircuitRemoved:
+		return c.circuit() + ": removed"
+	case ChangeCircuitRenamed:
+		return fmt.Sprintf("circuit %v: renamed from %q to %q", c.ID, c.PrevName, c.Name)
+	case ChangeCircuitModified:
+		return c.circuit() + ": modified"
+	case ChangeTemperature:
+		delta := formatFloat(c.Delta())
+		if c.Delta() > 0 {
+			delta = "+" + delta
+		}
+		return fmt.Sprintf("%v temperature: %v -> %v (%v)", c.Name, formatFloat(c.Prev), formatFloat(c.Next), delta)
+	case ChangeHeatSetPoint:
+		return fmt.Sprintf("%v heat set point: %v -> %v", c.Name, formatFloat(c.Prev), formatFloat(c.Next))
+	case ChangeCoolSetPoint:
+		return fmt.Sprintf("%v cool set point: %v -> %v", c.Name, formatFloat(c.Prev), formatFloat(c.Next))
+	case ChangeHeatMode:
+		return fmt.Sprintf("%v heat mode: %v -> %v", c.Name, HeatMode(c.Prev), HeatMode(c.Next))
+	case ChangeHeatStatus:
+		return fmt.Sprintf("%v heat status: %v -> %v", c.Name, HeatStatus(c.Prev), HeatStatus(c.Next))
+	case ChangeAlarmRaised:
+		return fmt.Sprintf("alarm raised: %v (%v)", c.Name, formatFloat(c.Next))
+	case ChangeAlarmCleared:
+		return fmt.Sprintf("alarm cleared: %v", c.Name)
+	case ChangeChemistry:
+		return fmt.Sprintf("%v: %v -> %v", c.Name, formatFloat(c.Prev), formatFloat(c.Next))
+	case ChangeControllerState:
+		return fmt.Sprintf("controller state: %v -> %v", ControllerState(c.Prev), ControllerState(c.Next))
+	}
+	return fmt.Sprintf("unknown change: %v", int(c.Kind))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type differ []Change
+
+func (d *differ) value(kind ChangeKind, name string, prev, next float64) {
+	if prev != next {
+		*d = append(*d, Change{Kind: kind, Name: name, Prev: prev, Next: next})
+	}
+}
+
+// alarm records an alarm as being raised when it transitions from zero
+// to non-zero, or between non-zero values, and cleared when it returns
+// to zero.
+func (d *differ) alarm(name string, prev, next float64) {
+	switch {
+	case prev == next:
+	case next == 0:
+		*d = append(*d, Change{Kind: ChangeAlarmCleared, Name: name, Prev: prev, Next: next})
+	default:
+		*d = append(*d, Change{Kind: ChangeAlarmRaised, Name: name, Prev: prev, Next: next})
+	}
+}
+
+// DiffStatus returns the changes between prev and next. Circuit changes
+// are not named since ControllerStatus does not include circuit names,
+// use ControllerConfig.NameChanges to supply them.
+func DiffStatus(prev, next ControllerStatus) []Change {
+	var d differ
+	d.value(ChangeControllerState, "", float64(prev.State), float64(next.State))
+	d.alarm(ChangeNameFreezeMode, boolToFloat(prev.FreezeMode), boolToFloat(next.FreezeMode))
+	d.alarm(ChangeNameAlert, float64(prev.Alert), float64(next.Alert))
+	d.value(ChangeTemperature, ChangeNameAir, float64(prev.AirTemp), float64(next.AirTemp))
+	for _, nb := range next.Bodies {
+		pb, ok := prev.Body(nb.Type)
+		if !ok {
+			continue
+		}
+		name := nb.Type.String()
+		d.value(ChangeTemperature, name, float64(pb.CurrentTemp), float64(nb.CurrentTemp))
+		d.value(ChangeHeatSetPoint, name, float64(pb.HeatSetPoint), float64(nb.HeatSetPoint))
+		d.value(ChangeCoolSetPoint, name, float64(pb.CoolSetPoint), float64(nb.CoolSetPoint))
+		d.value(ChangeHeatMode, name, float64(pb.HeatMode), float64(nb.HeatMode))
+		d.value(ChangeHeatStatus, name, float64(pb.HeatStatus), float64(nb.HeatStatus))
+	}
+	states := make(map[int]bool, len(prev.Circuits))
+	for _, c := range prev.Circuits {
+		states[c.ID] = c.State
+	}
+	for _, c := range next.Circuits {
+		if state, ok := states[c.ID]; !ok || state == c.State {
+			continue
+		}
+		kind := ChangeCircuitOff
+		if c.State {
+			kind = ChangeCircuitOn
+		}
+		d = append(d, Change{Kind: kind, ID: c.ID})
+	}
+	d.value(ChangeChemistry, ChangeNamePH, prev.PH, next.PH)
+	d.value(ChangeChemistry, ChangeNameORP, float64(prev.ORP), float64(next.ORP))
+	d.value(ChangeChemistry, ChangeNameSaturation, prev.Saturation, next.Saturation)
+	d.value(ChangeChemistry, ChangeNameSaltPPM, float64(prev.SaltPPM), float64(next.SaltPPM))
+	d.value(ChangeChemistry, ChangeNamePHTank, float64(prev.PHTank), float64(next.PHTank))
+	d.value(ChangeChemistry, ChangeNameORPTank, float64(prev.ORPTank), float64(next.ORPTank))
+	return d
+}
+
+// DiffConfig returns the circuits that were added, removed, renamed or
+// modified between prev and next.
+func DiffConfig(prev, next ControllerConfig) []Change {
+	var d differ
+	circuits := make(map[int]Circuit, len(prev.Circuits))
+	for _, c := range prev.Circuits {
+		circuits[c.ID] = c
+	}
+	for _, nc := range next.Circuits {
+		pc, ok := circuits[nc.ID]
+		delete(circuits, nc.ID)
+		switch {
+		case !ok:
+			d = append(d, Change{Kind: ChangeCircuitAdded, ID: nc.ID, Name: nc.Name})
+			continue
+		case pc.Name != nc.Name:
+			d = append(d, Change{Kind: ChangeCircuitRenamed, ID: nc.ID, Name: nc.Name, PrevName: pc.Name})
+		}
+		if pc.Function != nc.Function || pc.Interface != nc.Interface {
+			d = append(d, Change{Kind: ChangeCircuitModified, ID: nc.ID, Name: nc.Name})
+		}
+	}
+	for _, pc := range prev.Circuits {
+		if _, ok := circuits[pc.ID]; ok {
+			d = append(d, Change{Kind: ChangeCircuitRemoved, ID: pc.ID, Name: pc.Name})
+		}
+	}
+	return d
+}
+
+// NameChanges sets the names of the circuits referred to by the changes
+// returned by DiffStatus.
+func (c ControllerConfig) NameChanges(changes []Change) {
+	for i, ch := range changes {
+		if ch.Kind != ChangeCircuitOn && ch.Kind != ChangeCircuitOff {
+			continue
+		}
+		if name := c.CircuitName(ch.ID); len(name) > 0 {
+			changes[i].Name = name
+		}
+	}
+}
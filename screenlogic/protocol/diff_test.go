@@ -0,0 +1,109 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+func TestDiffStatus(t *testing.T) {
+	prev := protocol.ControllerStatus{
+		State:   protocol.ControllerReady,
+		AirTemp: 70,
+		Bodies: []protocol.BodyStatus{
+			{Type: protocol.BodyPool, CurrentTemp: 78, HeatSetPoint: 82},
+			{Type: protocol.BodySpa, CurrentTemp: 80, HeatSetPoint: 100},
+		},
+		Circuits: []protocol.CircuitStatus{{ID: 500}, {ID: 501, State: true}},
+		PH:       7.4,
+	}
+	if got := protocol.DiffStatus(prev, prev); len(got) != 0 {
+		t.Errorf("unexpected changes: %v", got)
+	}
+	next := protocol.ControllerStatus{
+		State:      protocol.ControllerReady,
+		FreezeMode: true,
+		AirTemp:    68,
+		Bodies: []protocol.BodyStatus{
+			{Type: protocol.BodyPool, CurrentTemp: 79, HeatSetPoint: 82, HeatMode: protocol.HeatModeHeater},
+			{Type: protocol.BodySpa, CurrentTemp: 80, HeatSetPoint: 102},
+		},
+		Circuits: []protocol.CircuitStatus{{ID: 500, State: true}, {ID: 501}, {ID: 502}},
+		PH:       7.5,
+	}
+	changes := protocol.DiffStatus(prev, next)
+	protocol.ControllerConfig{
+		Circuits: []protocol.Circuit{{ID: 500, Name: "Spa"}},
+	}.NameChanges(changes)
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"alarm raised: Freeze Mode (1)",
+		"Air temperature: 70 -> 68 (-2)",
+		"Pool temperature: 78 -> 79 (+1)",
+		"Pool heat mode: Off -> Heater",
+		"Spa heat set point: 100 -> 102",
+		"circuit 500 (Spa): on",
+		"circuit 501: off",
+		"pH: 7.4 -> 7.5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := changes[1].Delta(), -2.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	prev.Alert, next.Alert = 2, 0
+	prev.FreezeMode = true
+	changes = protocol.DiffStatus(prev, next)
+	if got, want := changes[0], (protocol.Change{Kind: protocol.ChangeAlarmCleared, Name: protocol.ChangeNameAlert, Prev: 2}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	prev := protocol.ControllerConfig{
+		Circuits: []protocol.Circuit{
+			{ID: 500, Name: "Spa", Function: protocol.CircuitSpa},
+			{ID: 501, Name: "Cleaner", Function: protocol.CircuitCleaner},
+			{ID: 502, Name: "Aux 1"},
+		},
+	}
+	next := protocol.ControllerConfig{
+		Circuits: []protocol.Circuit{
+			{ID: 500, Name: "Spa", Function: protocol.CircuitSpa},
+			{ID: 502, Name: "Pool Light", Function: protocol.CircuitIntelliBrite},
+			{ID: 503, Name: "Waterfall"},
+		},
+	}
+	want := []protocol.Change{
+		{Kind: protocol.ChangeCircuitRenamed, ID: 502, Name: "Pool Light", PrevName: "Aux 1"},
+		{Kind: protocol.ChangeCircuitModified, ID: 502, Name: "Pool Light"},
+		{Kind: protocol.ChangeCircuitAdded, ID: 503, Name: "Waterfall"},
+		{Kind: protocol.ChangeCircuitRemoved, ID: 501, Name: "Cleaner"},
+	}
+	got := protocol.DiffConfig(prev, next)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	buf, err := json.Marshal(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf), `{"kind":"circuit_renamed","id":502,"name":"Pool Light","prev":0,"next":0,"prev_name":"Aux 1"}`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var c protocol.Change
+	if err := json.Unmarshal(buf, &c); err != nil || c != want[0] {
+		t.Errorf("got %+v, %v", c, err)
+	}
+}
@@ -7,6 +7,8 @@ package protocol
 import (
 	"context"
 	"fmt"
+	"math"
+	"slices"
 )
 
 type hardwareType struct {
@@ -53,6 +55,18 @@ func DecodeControllerHardware(controller, hardware uint8) (string, error) {
 	return controllerTypes[controller][hardware].name, nil
 }
 
+// EncodeControllerHardware is the inverse of DecodeControllerHardware.
+func EncodeControllerHardware(model string) (controller, hardware uint8, err error) {
+	for c, hws := range controllerTypes {
+		for h, hw := range hws {
+			if len(hw.name) > 0 && hw.name == model {
+				return uint8(c), uint8(h), nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown controller model %q", model)
+}
+
 func GetControllerConfig(ctx context.Context, s *Session) (ControllerConfig, error) {
 	id := s.NextID()
 	m := NewEmptyMessage(id, MsgGetConfig, 8) // 2 INTs value 0.
@@ -63,126 +77,137 @@ func GetControllerConfig(ctx context.Context, s *Session) (ControllerConfig, err
 	return DecodeControllerConfig(rm)
 }
 
+// circuitWire is the wire representation of a single circuit's
+// configuration.
+type circuitWire struct {
+	ID           uint32
+	Name         string
+	Index        uint8
+	Function     uint8
+	Interface    uint8
+	Flags        uint8
+	ColorSet     uint8
+	ColorPos     uint8
+	ColorStagger uint8
+	DeviceID     uint8
+	Runtime      uint16
+	_            struct{} `sl:"skip=2"`
+}
+
+type colorWire struct {
+	Name    string
+	R, G, B uint32
+}
+
+// controllerConfigWire is the wire representation of the response to
+// a MsgGetConfig request.
+type controllerConfigWire struct {
+	ControllerID   uint32
+	MinSetPoint    [2]uint8
+	MaxSetPoint    [2]uint8
+	DegreesC       uint8
+	ControllerType uint8
+	HardwareType   uint8
+	ControllerData uint8
+	Equipment      uint32
+	GenCircuitName string
+	Circuits       []circuitWire
+	Colors         []colorWire
+	Pumps          [8]uint8
+	InterfaceTabs  uint32
+	ShowAlarms     uint32
+}
+
 func DecodeControllerConfig(rm Message) (ControllerConfig, error) {
-	var cfg ControllerConfig
-	pl := rm.Payload()
-
-	ok := true
-	var id uint32
-	pl, ok = DecodeUint32(pl, ok, &id)
-	cfg.ID = int(id)
-	pl, ok = DecodeSkip(pl, ok, 4) // Skip setpoint data.
-	pl, ok = DecodeSkip(pl, ok, 1) // Skip celsius/faherenheit data.
-	var cv, hw uint8
-	pl, ok = DecodeUint8s(pl, ok, &cv, &hw)
-	model, err := DecodeControllerHardware(cv, hw)
+	var wire controllerConfigWire
+	if err := Unmarshal(rm.Payload(), &wire); err != nil {
+		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: %w", err)
+	}
+	model, err := DecodeControllerHardware(wire.ControllerType, wire.HardwareType)
 	if err != nil {
 		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: %w", err)
 	}
-	cfg.Model = model
-	pl, ok = DecodeSkip(pl, ok, 1) // Skip controller data byte
-
-	var flags uint32
-	pl, ok = DecodeUint32(pl, ok, &flags)
-	cfg.Equipment = EquipmentFlags(flags)
-
-	var circuitName string
-	pl, ok = DecodeString(pl, ok, &circuitName)
-	var circuitCount uint32
-
-	// Circuits
-	pl, ok = DecodeUint32(pl, ok, &circuitCount)
-	for range int(circuitCount) {
-		var c Circuit
-		var id uint32
-		pl, ok = DecodeUint32(pl, ok, &id)
-		c.ID = int(id)
-		pl, ok = DecodeString(pl, ok, &c.Name)
-		pl, ok = DecodeUint8(pl, ok, &c.Index)
-		var fn, ifc, flags, colorSet, colorPos, colorStagger uint8
-		pl, ok = DecodeUint8s(pl, ok, &fn, &ifc, &flags, &colorSet, &colorPos, &colorStagger)
-		c.Function = CircuitFunction(fn)
-		c.Interface = CircuitInterface(ifc)
-
-		pl, ok = DecodeUint8(pl, ok, &c.DeviceID)
-
-		cfg.Circuits = append(cfg.Circuits, c)
-
-		var runtime uint16
-		pl, ok = DecodeUint16(pl, ok, &runtime)
-		pl, ok = DecodeSkip(pl, ok, 2)
-
-		if !ok {
-			break
-		}
+	cfg := ControllerConfig{
+		Model:     model,
+		ID:        int(wire.ControllerID),
+		Celsius:   wire.DegreesC != 0,
+		Equipment: EquipmentFlags(wire.Equipment),
 	}
-	if !ok {
-		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: message too small: %w", ErrInvalidResponse)
+	for _, c := range wire.Circuits {
+		cfg.Circuits = append(cfg.Circuits, Circuit{
+			ID:        int(c.ID),
+			Name:      c.Name,
+			Function:  CircuitFunction(c.Function),
+			Interface: CircuitInterface(c.Interface),
+			Index:     c.Index,
+			DeviceID:  c.DeviceID,
+		})
 	}
-
-	// Colors
-	var colorCount uint32
-	pl, ok = DecodeUint32(pl, ok, &colorCount)
-	for range int(colorCount) {
-		var color string
-		pl, ok = DecodeString(pl, ok, &color)
-		var R, G, B uint32
-		pl, ok = DecodeUint32s(pl, ok, &R, &G, &B)
-		if !ok {
-			break
+	for i, val := range wire.Pumps {
+		if cfg.Equipment.hasIntelliFlo(i) {
+			cfg.IntelliFlo = append(cfg.IntelliFlo, IntelliFlo{Index: i, Value: val})
 		}
 	}
+	return cfg, nil
+}
 
-	if !ok {
-		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: message too small: %w", ErrInvalidResponse)
+// EncodeControllerConfig encodes cfg as the payload of a response
+// to a MsgGetConfig request.
+func EncodeControllerConfig(cfg ControllerConfig) ([]byte, error) {
+	ct, hw, err := EncodeControllerHardware(cfg.Model)
+	if err != nil {
+		return nil, fmt.Errorf("encodeControllerConfig: %w", err)
 	}
-
-	pumpCount := 8
-	for i := 0; i < pumpCount; i++ {
-		var val uint8
-		pl, ok = DecodeUint8(pl, ok, &val)
-		if cfg.Equipment.hasIntelliFlo(i) {
-			cfg.IntelliFlo = append(cfg.IntelliFlo, IntelliFlo{Value: val})
-		}
+	wire := controllerConfigWire{
+		ControllerID:   uint32(cfg.ID),
+		ControllerType: ct,
+		HardwareType:   hw,
+		Equipment:      uint32(cfg.Equipment),
 	}
-
-	if !ok {
-		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: message too small: %w", ErrInvalidResponse)
+	if cfg.Celsius {
+		wire.DegreesC = 1
 	}
-
-	var flags2, alarms uint32
-	pl, ok = DecodeUint32s(pl, ok, &flags2, &alarms)
-
-	if !ok {
-		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: message too small: %w", ErrInvalidResponse)
+	for _, c := range cfg.Circuits {
+		wire.Circuits = append(wire.Circuits, circuitWire{
+			ID:        uint32(c.ID),
+			Name:      c.Name,
+			Index:     c.Index,
+			Function:  uint8(c.Function),
+			Interface: uint8(c.Interface),
+			DeviceID:  c.DeviceID,
+		})
 	}
-
-	if len(pl) > 0 {
-		return ControllerConfig{}, fmt.Errorf("decodeControllerConfig: spurious data: %w", ErrInvalidResponse)
+	pumps := cfg.IntelliFlo
+	for i := range wire.Pumps {
+		if cfg.Equipment.hasIntelliFlo(i) && len(pumps) > 0 {
+			wire.Pumps[i] = pumps[0].Value
+			pumps = pumps[1:]
+		}
 	}
-
-	return cfg, nil
+	return Marshal(wire)
 }
 
 type Circuit struct {
-	ID        int
-	Name      string
-	Function  CircuitFunction
-	Interface CircuitInterface
-	Index     uint8
-	DeviceID  uint8
+	ID        int              `json:"id"`
+	Name      string           `json:"name"`
+	Function  CircuitFunction  `json:"function"`
+	Interface CircuitInterface `json:"interface"`
+	Index     uint8            `json:"index"`
+	DeviceID  uint8            `json:"device_id"`
 }
 
 type IntelliFlo struct {
-	Value uint8
+	Index int   `json:"index"` // The pump's index, 0-7, as used by GetPumpStatus.
+	Value uint8 `json:"value"`
 }
 
 type ControllerConfig struct {
-	Model      string
-	ID         int
-	Equipment  EquipmentFlags
-	Circuits   []Circuit
-	IntelliFlo []IntelliFlo
+	Model      string         `json:"model"`
+	ID         int            `json:"id"`
+	Celsius    bool           `json:"celsius"`
+	Equipment  EquipmentFlags `json:"equipment"`
+	Circuits   []Circuit      `json:"circuits"`
+	IntelliFlo []IntelliFlo   `json:"intelliflo"`
 }
 
 func GetControllerStatus(ctx context.Context, s *Session) (ControllerStatus, error) {
@@ -195,67 +220,188 @@ func GetControllerStatus(ctx context.Context, s *Session) (ControllerStatus, err
 	return DecodeControllerStatus(rm)
 }
 
-func DecodeControllerStatus(rm Message) (ControllerStatus, error) {
-	var status ControllerStatus
-	pl := rm.Payload()
-	var state uint32
-	ok := true
-	pl, ok = DecodeUint32(pl, ok, &state)
-	status.State = ControllerState(state)
+// bodyStatusWire is the wire representation of the status of a
+// body of water, ie. pool or spa.
+type bodyStatusWire struct {
+	Type         int32
+	CurrentTemp  int32
+	HeatStatus   int32
+	HeatSetPoint int32
+	CoolSetPoint int32
+	HeatMode     int32
+}
 
-	// Skip freeze mode, remotes, pool delay, spa delay and cleaner delay, + 3
-	// unknown + air temp
-	pl, ok = DecodeSkip(pl, ok, 5+3+4)
+// circuitStatusWire is the wire representation of a single circuit's status.
+type circuitStatusWire struct {
+	ID           uint32
+	State        bool `sl:"uint32"`
+	ColorSet     uint8
+	ColorPos     uint8
+	ColorStagger uint8
+	Delay        uint8
+}
 
-	var nBodies uint32
-	pl, ok = DecodeUint32(pl, ok, &nBodies)
-	for range int(nBodies) {
-		// Skip body data, type (uint32)+ last temp, heat, heat set point, cool set point, heat mode (int32),
-		pl, ok = DecodeSkip(pl, ok, 4+(5*4))
-	}
+// controllerStatusWire is the wire representation of the response to
+// a MsgGetStatus request.
+type controllerStatusWire struct {
+	State        uint32
+	FreezeMode   uint8
+	Remotes      uint8
+	PoolDelay    uint8
+	SpaDelay     uint8
+	CleanerDelay uint8
+	_            struct{} `sl:"skip=3"`
+	AirTemp      int32
+	Bodies       []bodyStatusWire
+	Circuits     []circuitStatusWire
+	PH           int32
+	ORP          int32
+	Saturation   int32
+	SaltPPM      int32
+	PHTank       int32
+	ORPTank      int32
+	Alarms       int32
+}
 
-	if !ok {
-		return ControllerStatus{}, fmt.Errorf("decodeControllerStatus: message too small: %w", ErrInvalidResponse)
-	}
+// freezeModeActive is the bit in the freeze mode byte that indicates
+// that freeze protection is active.
+const freezeModeActive = 0x08
 
-	var circuitCount uint32
-	pl, ok = DecodeUint32(pl, ok, &circuitCount)
-	for range int(circuitCount) {
-		var c CircuitStatus
-		var id, val uint32
-		pl, ok = DecodeUint32(pl, ok, &id)
-		pl, ok = DecodeUint32(pl, ok, &val)
-		c.ID = int(id)
-		c.State = val != 0
-		var colorSet, colorPos, colorStagger, delay uint8
-		pl, ok = DecodeUint8s(pl, ok, &colorSet, &colorPos, &colorStagger, &delay)
-		status.Circuits = append(status.Circuits, c)
+func DecodeControllerStatus(rm Message) (ControllerStatus, error) {
+	var wire controllerStatusWire
+	if err := Unmarshal(rm.Payload(), &wire); err != nil {
+		return ControllerStatus{}, fmt.Errorf("decodeControllerStatus: %w", err)
 	}
+	status := ControllerStatus{
+		State:        ControllerState(wire.State),
+		FreezeMode:   wire.FreezeMode&freezeModeActive != 0,
+		PoolDelay:    wire.PoolDelay != 0,
+		SpaDelay:     wire.SpaDelay != 0,
+		CleanerDelay: wire.CleanerDelay != 0,
+		AirTemp:      int(wire.AirTemp),
+		PH:           float64(wire.PH) / 100,
+		ORP:          int(wire.ORP),
+		Saturation:   float64(wire.Saturation) / 10,
+		SaltPPM:      int(wire.SaltPPM) * 50,
+		PHTank:       int(wire.PHTank),
+		ORPTank:      int(wire.ORPTank),
+		Alert:        int(wire.Alarms),
+	}
+	for _, b := range wire.Bodies {
+		status.Bodies = append(status.Bodies, BodyStatus{
+			Type:         BodyType(b.Type),
+			CurrentTemp:  int(b.CurrentTemp),
+			HeatStatus:   HeatStatus(b.HeatStatus),
+			HeatSetPoint: int(b.HeatSetPoint),
+			CoolSetPoint: int(b.CoolSetPoint),
+			HeatMode:     HeatMode(b.HeatMode),
+		})
+	}
+	for _, c := range wire.Circuits {
+		status.Circuits = append(status.Circuits, CircuitStatus{
+			ID:    int(c.ID),
+			State: c.State,
+			Delay: c.Delay != 0,
+		})
+	}
+	return status, nil
+}
 
-	var pH, orp, saturation, saltPPM, pHTank, orpTank, alert int32
-	pl, ok = DecodeInt32s(pl, ok, &pH, &orp, &saturation, &saltPPM, &pHTank, &orpTank, &alert)
-	status.Alert = int(alert)
-
-	if !ok {
-		return ControllerStatus{}, fmt.Errorf("decodeControllerStatus: message too small: %w", ErrInvalidResponse)
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
 	}
+	return 0
+}
 
-	if len(pl) > 0 {
-		return ControllerStatus{}, fmt.Errorf("decodeControllerStatus: spurious data: %w", ErrInvalidResponse)
+// EncodeControllerStatus encodes st as the payload of a response to
+// a MsgGetStatus request or of a MsgStatusChanged push message.
+func EncodeControllerStatus(st ControllerStatus) ([]byte, error) {
+	wire := controllerStatusWire{
+		State:        uint32(st.State),
+		PoolDelay:    boolToUint8(st.PoolDelay),
+		SpaDelay:     boolToUint8(st.SpaDelay),
+		CleanerDelay: boolToUint8(st.CleanerDelay),
+		AirTemp:      int32(st.AirTemp),
+		PH:           int32(math.Round(st.PH * 100)),
+		ORP:          int32(st.ORP),
+		Saturation:   int32(math.Round(st.Saturation * 10)),
+		SaltPPM:      int32(st.SaltPPM / 50),
+		PHTank:       int32(st.PHTank),
+		ORPTank:      int32(st.ORPTank),
+		Alarms:       int32(st.Alert),
+	}
+	if st.FreezeMode {
+		wire.FreezeMode = freezeModeActive
 	}
+	for _, b := range st.Bodies {
+		wire.Bodies = append(wire.Bodies, bodyStatusWire{
+			Type:         int32(b.Type),
+			CurrentTemp:  int32(b.CurrentTemp),
+			HeatStatus:   int32(b.HeatStatus),
+			HeatSetPoint: int32(b.HeatSetPoint),
+			CoolSetPoint: int32(b.CoolSetPoint),
+			HeatMode:     int32(b.HeatMode),
+		})
+	}
+	for _, c := range st.Circuits {
+		wire.Circuits = append(wire.Circuits, circuitStatusWire{
+			ID:    uint32(c.ID),
+			State: c.State,
+			Delay: boolToUint8(c.Delay),
+		})
+	}
+	return Marshal(wire)
+}
 
-	return status, nil
+type BodyStatus struct {
+	Type         BodyType   `json:"type"`
+	CurrentTemp  int        `json:"current_temp"`
+	HeatStatus   HeatStatus `json:"heat_status"`
+	HeatSetPoint int        `json:"heat_set_point"`
+	CoolSetPoint int        `json:"cool_set_point"`
+	HeatMode     HeatMode   `json:"heat_mode"`
 }
 
 type CircuitStatus struct {
-	ID    int
-	State bool
+	ID    int  `json:"id"`
+	State bool `json:"state"`
+	Delay bool `json:"delay"`
 }
 
 type ControllerStatus struct {
-	State    ControllerState
-	Circuits []CircuitStatus
-	Alert    int
+	State        ControllerState `json:"state"`
+	FreezeMode   bool            `json:"freeze_mode"`
+	PoolDelay    bool            `json:"pool_delay"`
+	SpaDelay     bool            `json:"spa_delay"`
+	CleanerDelay bool            `json:"cleaner_delay"`
+	AirTemp      int             `json:"air_temp"`
+	Bodies       []BodyStatus    `json:"bodies"`
+	Circuits     []CircuitStatus `json:"circuits"`
+	PH           float64         `json:"ph"`
+	ORP          int             `json:"orp"`
+	Saturation   float64         `json:"saturation"`
+	SaltPPM      int             `json:"salt_ppm"`
+	PHTank       int             `json:"ph_tank"`
+	ORPTank      int             `json:"orp_tank"`
+	Alert        int             `json:"alert"`
+}
+
+// Clone returns a copy of cs that shares no memory with it.
+func (cs ControllerStatus) Clone() ControllerStatus {
+	cs.Bodies = slices.Clone(cs.Bodies)
+	cs.Circuits = slices.Clone(cs.Circuits)
+	return cs
+}
+
+// Body returns the status of the specified body, if present.
+func (cs ControllerStatus) Body(bt BodyType) (BodyStatus, bool) {
+	for _, b := range cs.Bodies {
+		if b.Type == bt {
+			return b, true
+		}
+	}
+	return BodyStatus{}, false
 }
 
 func (cs ControllerStatus) StatusForID(id int) bool {
@@ -267,6 +413,13 @@ func (cs ControllerStatus) StatusForID(id int) bool {
 	return false
 }
 
+// Clone returns a copy of c that shares no memory with it.
+func (c ControllerConfig) Clone() ControllerConfig {
+	c.Circuits = slices.Clone(c.Circuits)
+	c.IntelliFlo = slices.Clone(c.IntelliFlo)
+	return c
+}
+
 func (c ControllerConfig) CircuitName(id int) string {
 	for _, c := range c.Circuits {
 		if c.ID == id {
@@ -294,17 +447,19 @@ func (c ControllerConfig) CircuitBytName(name string) Circuit {
 	return Circuit{}
 }
 
+// ButtonPress is the payload of a MsgButtonPress request.
+type ButtonPress struct {
+	Controller uint32
+	CircuitID  int  `sl:"uint32"`
+	State      bool `sl:"uint32"`
+}
+
 func SetCircuitState(ctx context.Context, s *Session, circuitID int, state bool) error {
-	m := NewEmptyMessage(0, MsgButtonPress, 3*4)
-	pl := m.Payload()
-	pl = AppendUint32(pl, 0)
-	pl = AppendUint32(pl, uint32(circuitID))
-	if state {
-		AppendUint32(pl, 1)
-	} else {
-		AppendUint32(pl, 0)
-	}
 	id := s.NextID()
+	m, err := MarshalMessage(id, MsgButtonPress, ButtonPress{CircuitID: circuitID, State: state})
+	if err != nil {
+		return fmt.Errorf("setCircuitState: %w", err)
+	}
 	rm, err := sendAndValidate(ctx, s, m, id, MsgButtonPress)
 	if err != nil {
 		return fmt.Errorf("setCircuitState: %w", err)
@@ -10,19 +10,20 @@ import (
 	"time"
 )
 
+// ConnectString is sent, unframed, by a client to initiate a session.
+const ConnectString = "CONNECTSERVERHOST\r\n\r\n"
+
 var (
-	connectMsg  = []byte("CONNECTSERVERHOST\r\n\r\n")
+	connectMsg  = []byte(ConnectString)
 	loginClient = "automation"
 	loginPasswd = "0000000000000000" // <= 16 bytes
 
 )
 
-func Login(ctx context.Context, s *Session) error {
-	id := s.NextID()
-
-	// Build the login message which consists of:
-	// int, int, client, password, int for which none of the
-	// values seem to matter.
+// newLoginMessage returns the login message which consists of:
+// int, int, client, password, int for which none of the values seem
+// to matter.
+func newLoginMessage(id uint16) Message {
 	size := StringSize(loginClient) + StringSize(loginPasswd) + 12
 	loginMsg := NewEmptyMessage(id, MsgLocalLogin, size)
 	pl := loginMsg.Payload()
@@ -31,6 +32,12 @@ func Login(ctx context.Context, s *Session) error {
 	pl = AppendString(pl, loginClient)
 	pl = AppendString(pl, loginPasswd)
 	AppendUint32(pl, 0)
+	return loginMsg
+}
+
+func Login(ctx context.Context, s *Session) error {
+	id := s.NextID()
+	loginMsg := newLoginMessage(id)
 
 	// Send the raw connect string to kick start the session
 	// and then the login message.
@@ -75,3 +82,14 @@ func GetVersionInfo(ctx context.Context, s *Session) (string, error) {
 	}
 	return DecodeVersion(rm), nil
 }
+
+// Ping sends a ping to the adapter and waits for its reply, it is
+// used to check that a connection is still alive.
+func Ping(ctx context.Context, s *Session) error {
+	id := s.NextID()
+	m := NewEmptyMessage(id, MsgPing, 0)
+	if _, err := sendAndValidate(ctx, s, m, id, MsgPing); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
+}
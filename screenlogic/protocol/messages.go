@@ -80,23 +80,25 @@ func StringSize(s string) uint32 {
 }
 
 // AppendBytes appends the message to the buffer and returns the remaining buffer.
-// It rounds to the size of the message to the nearest multiple of 4 and
-// prepends the size as a uint32.
+// It prepends the size of the message as a uint32 and pads the message
+// with zeros to the nearest multiple of 4.
 func AppendBytes(buf, msg []byte) []byte {
-	size := roundTo4(len(msg))
-	binary.LittleEndian.PutUint32(buf, size)
+	binary.LittleEndian.PutUint32(buf, uint32(len(msg)))
 	copy(buf[4:], msg)
-	return buf[size+4:]
+	return buf[roundTo4(len(msg))+4:]
 }
 
 // AppendString appends the message to the buffer and returns the remaining buffer.
-// It rounds to the size of the message to the nearest multiple of 4 and
-// prepends the size as a uint32.
+// It prepends the size of the message as a uint32 and pads the message
+// with zeros to the nearest multiple of 4. The size is that of the
+// message itself, excluding the padding, as expected by DecodeString
+// and the adapter; prior versions sent the padded size, so that the
+// adapter saw the padding as trailing NULs, eg. "automation\x00\x00"
+// for the client name sent by Login.
 func AppendString(buf []byte, msg string) []byte {
-	size := roundTo4(len(msg))
-	binary.LittleEndian.PutUint32(buf, size)
+	binary.LittleEndian.PutUint32(buf, uint32(len(msg)))
 	copy(buf[4:], msg)
-	return buf[size+4:]
+	return buf[roundTo4(len(msg))+4:]
 }
 
 func AppendUint32(buf []byte, val uint32) []byte {
@@ -195,12 +197,18 @@ func DecodeSkip(buf []byte, ok bool, n int) ([]byte, bool) {
 	return buf[n:], true
 }
 
+// DecodeString decodes a string prefixed by its size as a uint32 and
+// padded with zeros to the nearest multiple of 4. The top bit of the
+// size is set for UTF-16 strings, in which case the size is the number
+// of bytes, rather than characters, in the string.
 func DecodeString(buf []byte, ok bool, val *string) ([]byte, bool) {
 	if !ok || len(buf) < 4 {
 		return buf, false
 	}
 	size := binary.LittleEndian.Uint32(buf)
-	if len(buf) < int(size) {
+	utf16Encoded := size&0x80000000 != 0
+	size &= 0x7fffffff
+	if len(buf)-4 < int(size) {
 		return buf, false
 	}
 	pad := size % 4
@@ -208,21 +216,17 @@ func DecodeString(buf []byte, ok bool, val *string) ([]byte, bool) {
 		pad = 4 - pad
 	}
 	buf = buf[4:]
-	if size&0x80000000 == 0 {
-		// UTF-8/ASCII
+	if !utf16Encoded {
 		*val = string(buf[:size])
-		return buf[size+pad:], true
-	}
-	// UTF-16
-	size &= 0x7fffffff
-	size16 := size / 2
-	buf16 := make([]uint16, size16)
-	for i := 0; i < int(size16); i++ {
-		buf16[i] = binary.LittleEndian.Uint16(buf)
-		buf = buf[2:]
+	} else {
+		buf16 := make([]uint16, size/2)
+		for i := range buf16 {
+			buf16[i] = binary.LittleEndian.Uint16(buf[i*2:])
+		}
+		*val = string(utf16.Decode(buf16))
 	}
-	*val = string(utf16.Decode(buf16))
-	return buf, true
+	// Tolerate a missing pad at the end of a message.
+	return buf[min(int(size+pad), len(buf)):], true
 }
 
 func IsError(mcode MsgCode) error {
@@ -242,7 +246,7 @@ func ValidateResponse(m Message, id uint16, code MsgCode) error {
 		return fmt.Errorf("message too small: (%v < %v): %w", len(m), slnet.MessageHeaderSize, ErrInvalidResponse)
 	}
 	mcode := m.Code()
-	if mcode == code+1 {
+	if mcode == code.Response() {
 		return nil
 	}
 	if m.ID() != id {
@@ -251,7 +255,7 @@ func ValidateResponse(m Message, id uint16, code MsgCode) error {
 	if err := IsError(mcode); err != nil {
 		return err
 	}
-	return fmt.Errorf("unexpected msg code (%v != %v): %w", mcode, code, ErrUnexpectedResponseCode)
+	return fmt.Errorf("unexpected msg code (%v != %v): %w", mcode, code.Response(), ErrUnexpectedResponseCode)
 }
 
 func IsResponse(m Message, id uint16, code MsgCode) (bool, error) {
@@ -262,7 +266,7 @@ func IsResponse(m Message, id uint16, code MsgCode) (bool, error) {
 	if err := IsError(mcode); err != nil {
 		return false, err
 	}
-	return (mcode == code+1) && (m.ID() == id), nil
+	return (mcode == code.Response()) && (m.ID() == id), nil
 }
 
 func DecodeDateTime(m Message) (time.Time, error) {
@@ -281,14 +285,44 @@ func DecodeDateTime(m Message) (time.Time, error) {
 	return time.Date(int(year), time.Month(month), int(day), int(hour), int(minute), int(second), int(millisecond)*1_000_000, time.UTC), nil
 }
 
+// dateTimeWire is the wire representation of the response to a
+// MsgGetDateTime request.
+type dateTimeWire struct {
+	Year, Month, DayOfWeek, Day, Hour, Minute, Second, Millisecond, AutoDST uint16
+}
+
+// EncodeDateTime encodes t as the payload of a response to a
+// MsgGetDateTime request.
+func EncodeDateTime(t time.Time) []byte {
+	buf, _ := Marshal(dateTimeWire{
+		Year:        uint16(t.Year()),
+		Month:       uint16(t.Month()),
+		DayOfWeek:   uint16(t.Weekday()),
+		Day:         uint16(t.Day()),
+		Hour:        uint16(t.Hour()),
+		Minute:      uint16(t.Minute()),
+		Second:      uint16(t.Second()),
+		Millisecond: uint16(t.Nanosecond() / 1_000_000),
+	})
+	return buf
+}
+
 func DecodeVersion(m Message) string {
 	var v string
 	DecodeString(m.Payload(), true, &v)
 	return v
 }
 
+// EncodeVersion encodes v as the payload of a response to a
+// MsgGetVersion request.
+func EncodeVersion(v string) []byte {
+	buf := make([]byte, StringSize(v))
+	AppendString(buf, v)
+	return buf
+}
+
 func sendAndValidate(ctx context.Context, s *Session, m Message, id uint16, code MsgCode) (Message, error) {
-	ctxlog.Info(ctx, "screenlogic: sendAndValidate", "code", m.Code(), "id", m.ID())
+	ctxlog.Info(ctx, "screenlogic: sendAndValidate", "code", m.Code().String(), "id", m.ID())
 	s.Send(ctx, m)
 	for range 3 {
 		msg, err := s.ReadUntil(ctx)
@@ -302,7 +336,10 @@ func sendAndValidate(ctx context.Context, s *Session, m Message, id uint16, code
 			return rm, err
 		}
 		if !ok {
-			ctxlog.Info(ctx, "screenlogic: waiting for response", "expected_code", code, "expected_id", id, "actual_code", rm.Code(), "actual_id", rm.ID())
+			if !rm.Code().Known() {
+				ctxlog.Warn(ctx, "screenlogic: unknown message code", "code", rm.Code().String(), "id", rm.ID(), "size", rm.Size())
+			}
+			ctxlog.Info(ctx, "screenlogic: waiting for response", "expected_code", code.Response().String(), "expected_id", id, "actual_code", rm.Code().String(), "actual_id", rm.ID())
 			continue
 		}
 		if err := ValidateResponse(rm, id, code); err != nil {
@@ -4,8 +4,72 @@
 
 package protocol
 
-import "testing"
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
 
 func TestDecodeString(t *testing.T) {
-	t.Skip("utf16 decode not implemented")
+	for i, tc := range []struct {
+		buf  []byte
+		want string
+		rest []byte
+	}{
+		{[]byte{0, 0, 0, 0}, "", []byte{}},
+		{[]byte{3, 0, 0, 0, 'a', 'b', 'c', 0, 9}, "abc", []byte{9}},
+		{[]byte{4, 0, 0, 0, 'a', 'b', 'c', 'd', 9}, "abcd", []byte{9}},
+		// A missing pad at the end of a message is tolerated.
+		{[]byte{3, 0, 0, 0, 'a', 'b', 'c'}, "abc", []byte{}},
+		// UTF-16, the size is the number of bytes.
+		{[]byte{4, 0, 0, 0x80, 'h', 0, 'i', 0, 9}, "hi", []byte{9}},
+		{[]byte{6, 0, 0, 0x80, 'h', 0, 0xe9, 0, '!', 0, 0, 0, 9}, "hé!", []byte{9}},
+		{[]byte{2, 0, 0, 0x80, 'h', 0}, "h", []byte{}},
+	} {
+		var got string
+		rest, ok := DecodeString(tc.buf, true, &got)
+		if !ok {
+			t.Errorf("%v: failed to decode %v", i, tc.buf)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", i, got, tc.want)
+		}
+		if !bytes.Equal(rest, tc.rest) {
+			t.Errorf("%v: got %v, want %v", i, rest, tc.rest)
+		}
+	}
+
+	for i, buf := range [][]byte{
+		nil,
+		{1, 0, 0},
+		{4, 0, 0, 0, 'a', 'b', 'c'},
+		{0x10, 0, 0, 0x80, 'a', 0},
+		{0xff, 0xff, 0xff, 0xff},
+		{0xff, 0xff, 0xff, 0x7f, 'a'},
+	} {
+		var got string
+		if _, ok := DecodeString(buf, true, &got); ok {
+			t.Errorf("%v: %v: expected decode to fail, got %q", i, buf, got)
+		}
+	}
+
+	var got string
+	if _, ok := DecodeString([]byte{0, 0, 0, 0}, false, &got); ok {
+		t.Errorf("expected decode to fail when ok is false")
+	}
+}
+
+func TestLoginMessage(t *testing.T) {
+	// Sizes of strings exclude their padding, ie. "automation" is sent
+	// as a size of 10 followed by 10 bytes and 2 bytes of padding.
+	want := "" +
+		"07001b00" + "30000000" + // id 7, MsgLocalLogin, payload size 48.
+		"00000000" + "00000000" +
+		"0a000000" + hex.EncodeToString([]byte("automation")) + "0000" +
+		"10000000" + hex.EncodeToString([]byte("0000000000000000")) +
+		"00000000"
+	if got := hex.EncodeToString(newLoginMessage(7)); got != want {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
 }
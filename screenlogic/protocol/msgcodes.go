@@ -0,0 +1,180 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+// MsgKind describes the role that a message code plays in the protocol.
+type MsgKind int
+
+const (
+	MsgKindUnknown MsgKind = iota
+	MsgKindRequest
+	MsgKindResponse
+	MsgKindPush
+	MsgKindError
+)
+
+func (mk MsgKind) String() string {
+	switch mk {
+	case MsgKindRequest:
+		return "request"
+	case MsgKindResponse:
+		return "response"
+	case MsgKindPush:
+		return "push"
+	case MsgKindError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// MsgInfo describes a known message code.
+type MsgInfo struct {
+	Code MsgCode
+	Name string
+	Kind MsgKind
+	// Paired is the response code for a request and the request
+	// code for a response.
+	Paired MsgCode
+	// Decode, if non-nil, decodes the payload of a message with this code.
+	Decode func(Message) (any, error)
+}
+
+var msgRegistry = map[MsgCode]MsgInfo{}
+
+func registerMsg(info MsgInfo) {
+	if _, ok := msgRegistry[info.Code]; ok {
+		panic(fmt.Sprintf("message code %d registered twice", info.Code))
+	}
+	msgRegistry[info.Code] = info
+}
+
+// registerRequest registers a request and its response, where the response
+// code is, by convention, the request code plus one.
+func registerRequest(code MsgCode, name string, decode func(Message) (any, error)) {
+	registerMsg(MsgInfo{Code: code, Name: name, Kind: MsgKindRequest, Paired: code + 1})
+	registerMsg(MsgInfo{Code: code + 1, Name: name + "Response", Kind: MsgKindResponse, Paired: code, Decode: decode})
+}
+
+// decodeAs returns a decoder that unmarshals a message's payload into
+// a value of type T.
+func decodeAs[T any]() func(Message) (any, error) {
+	return func(m Message) (any, error) {
+		var v T
+		err := Unmarshal(m.Payload(), &v)
+		return v, err
+	}
+}
+
+func setRequestDecoder(code MsgCode, decode func(Message) (any, error)) {
+	info := msgRegistry[code]
+	info.Decode = decode
+	msgRegistry[code] = info
+}
+
+func init() {
+	registerRequest(MsgChallenge, "Challenge", nil)
+	registerRequest(MsgPing, "Ping", nil)
+	registerRequest(MsgLocalLogin, "LocalLogin", nil)
+	registerRequest(MsgGetDateTime, "GetDateTime", func(m Message) (any, error) {
+		return DecodeDateTime(m)
+	})
+	registerRequest(MsgGetVersion, "GetVersion", func(m Message) (any, error) {
+		return DecodeVersion(m), nil
+	})
+	registerRequest(MsgGetConfig, "GetConfig", func(m Message) (any, error) {
+		return DecodeControllerConfig(m)
+	})
+	registerRequest(MsgGetStatus, "GetStatus", func(m Message) (any, error) {
+		return DecodeControllerStatus(m)
+	})
+	registerRequest(MsgButtonPress, "ButtonPress", nil)
+	setRequestDecoder(MsgButtonPress, decodeAs[ButtonPress]())
+	registerRequest(MsgSetHeatSetPoint, "SetHeatSetPoint", nil)
+	setRequestDecoder(MsgSetHeatSetPoint, decodeAs[HeatSetPoint]())
+	registerRequest(MsgSetHeatMode, "SetHeatMode", nil)
+	setRequestDecoder(MsgSetHeatMode, decodeAs[HeatModeRequest]())
+	registerRequest(MsgLightCommand, "LightCommand", nil)
+	setRequestDecoder(MsgLightCommand, decodeAs[LightCommand]())
+	registerRequest(MsgGetSchedules, "GetSchedules", func(m Message) (any, error) {
+		return DecodeSchedules(m)
+	})
+	setRequestDecoder(MsgGetSchedules, decodeAs[ScheduleRequest]())
+	registerRequest(MsgCancelDelay, "CancelDelay", nil)
+	registerRequest(MsgGetPumpStatus, "GetPumpStatus", func(m Message) (any, error) {
+		return DecodePumpStatus(m)
+	})
+	setRequestDecoder(MsgGetPumpStatus, decodeAs[PumpStatusRequest]())
+	registerRequest(MsgGetChemData, "GetChemData", nil)
+	registerRequest(MsgAddClient, "AddClient", nil)
+	registerRequest(MsgRemoveClient, "RemoveClient", nil)
+
+	registerMsg(MsgInfo{Code: MsgStatusChanged, Name: "StatusChanged", Kind: MsgKindPush,
+		Decode: func(m Message) (any, error) {
+			return DecodeControllerStatus(m)
+		}})
+	registerMsg(MsgInfo{Code: MsgChemistryChanged, Name: "ChemistryChanged", Kind: MsgKindPush})
+	registerMsg(MsgInfo{Code: MsgWeatherChanged, Name: "WeatherChanged", Kind: MsgKindPush})
+
+	registerMsg(MsgInfo{Code: MsgBadLogin, Name: "BadLogin", Kind: MsgKindError})
+	registerMsg(MsgInfo{Code: MsgInvalidRequest, Name: "InvalidRequest", Kind: MsgKindError})
+	registerMsg(MsgInfo{Code: MsgBadParameter, Name: "BadParameter", Kind: MsgKindError})
+
+	slnet.SetCodeNamer(func(code uint16) string {
+		return MsgCode(code).String()
+	})
+}
+
+// LookupMsg returns the MsgInfo for the specified code, if it is known.
+func LookupMsg(code MsgCode) (MsgInfo, bool) {
+	info, ok := msgRegistry[code]
+	return info, ok
+}
+
+// KnownMsgs returns all known message codes in ascending order.
+func KnownMsgs() []MsgInfo {
+	infos := make([]MsgInfo, 0, len(msgRegistry))
+	for _, info := range msgRegistry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Code < infos[j].Code })
+	return infos
+}
+
+// String returns the name of the message code, or Unknown(<code>) for
+// codes that are not known.
+func (mc MsgCode) String() string {
+	if info, ok := msgRegistry[mc]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("Unknown(%d)", uint16(mc))
+}
+
+// Known returns true if the message code is known.
+func (mc MsgCode) Known() bool {
+	_, ok := msgRegistry[mc]
+	return ok
+}
+
+// Kind returns the kind of the message code.
+func (mc MsgCode) Kind() MsgKind {
+	return msgRegistry[mc].Kind
+}
+
+// Response returns the response code for a request. Requests that are not
+// known are assumed to follow the protocol's convention of the response
+// code being the request code plus one.
+func (mc MsgCode) Response() MsgCode {
+	if info, ok := msgRegistry[mc]; ok && info.Kind == MsgKindRequest {
+		return info.Paired
+	}
+	return mc + 1
+}
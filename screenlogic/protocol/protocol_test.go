@@ -41,3 +41,39 @@ func TestMessage(t *testing.T) {
 	}
 
 }
+
+func TestMsgCodes(t *testing.T) {
+	for _, tc := range []struct {
+		code     protocol.MsgCode
+		name     string
+		kind     protocol.MsgKind
+		response protocol.MsgCode
+	}{
+		{protocol.MsgGetConfig, "GetConfig", protocol.MsgKindRequest, protocol.MsgGetConfig + 1},
+		{protocol.MsgGetConfig + 1, "GetConfigResponse", protocol.MsgKindResponse, protocol.MsgGetConfig + 2},
+		{protocol.MsgBadParameter, "BadParameter", protocol.MsgKindError, protocol.MsgBadParameter + 1},
+		{protocol.MsgStatusChanged, "StatusChanged", protocol.MsgKindPush, protocol.MsgStatusChanged + 1},
+		{12345, "Unknown(12345)", protocol.MsgKindUnknown, 12346},
+	} {
+		if got, want := tc.code.String(), tc.name; got != want {
+			t.Errorf("%d: got %v, want %v", tc.code, got, want)
+		}
+		if got, want := tc.code.Kind(), tc.kind; got != want {
+			t.Errorf("%d: got %v, want %v", tc.code, got, want)
+		}
+		if got, want := tc.code.Response(), tc.response; got != want {
+			t.Errorf("%d: got %v, want %v", tc.code, got, want)
+		}
+	}
+	info, ok := protocol.LookupMsg(protocol.MsgGetStatus + 1)
+	if !ok || info.Paired != protocol.MsgGetStatus || info.Decode == nil {
+		t.Errorf("unexpected info: %+v, %v", info, ok)
+	}
+	for _, info := range protocol.KnownMsgs() {
+		if info.Kind == protocol.MsgKindRequest {
+			if rinfo, ok := protocol.LookupMsg(info.Paired); !ok || rinfo.Paired != info.Code {
+				t.Errorf("%v: missing or mismatched response: %+v", info.Name, rinfo)
+			}
+		}
+	}
+}
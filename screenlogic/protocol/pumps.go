@@ -0,0 +1,114 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+)
+
+// PumpStatusRequest is the payload of a MsgGetPumpStatus request.
+type PumpStatusRequest struct {
+	Controller uint32
+	Pump       int `sl:"uint32"`
+}
+
+// PumpCircuit represents the speed at which a pump runs when the
+// associated circuit is on.
+type PumpCircuit struct {
+	CircuitID int
+	Speed     int
+	IsRPM     bool // Speed is in RPM rather than GPM.
+}
+
+// PumpStatus represents the status of a single IntelliFlo pump.
+type PumpStatus struct {
+	Type     int
+	Running  bool
+	Watts    int
+	RPM      int
+	GPM      int
+	Circuits []PumpCircuit
+}
+
+type pumpCircuitWire struct {
+	CircuitID uint32
+	Speed     uint32
+	IsRPM     uint32
+}
+
+// pumpStatusWire is the wire representation of the response to a
+// MsgGetPumpStatus request.
+type pumpStatusWire struct {
+	Type     uint32
+	Running  uint32
+	Watts    uint32
+	RPM      uint32
+	_        struct{} `sl:"skip=4"`
+	GPM      uint32
+	_        struct{} `sl:"skip=4"`
+	Circuits [8]pumpCircuitWire
+}
+
+func GetPumpStatus(ctx context.Context, s *Session, pump int) (PumpStatus, error) {
+	id := s.NextID()
+	m, err := MarshalMessage(id, MsgGetPumpStatus, PumpStatusRequest{Pump: pump})
+	if err != nil {
+		return PumpStatus{}, fmt.Errorf("getPumpStatus: %w", err)
+	}
+	rm, err := sendAndValidate(ctx, s, m, id, MsgGetPumpStatus)
+	if err != nil {
+		return PumpStatus{}, fmt.Errorf("getPumpStatus: %w", err)
+	}
+	return DecodePumpStatus(rm)
+}
+
+func DecodePumpStatus(rm Message) (PumpStatus, error) {
+	var wire pumpStatusWire
+	if err := Unmarshal(rm.Payload(), &wire); err != nil {
+		return PumpStatus{}, fmt.Errorf("decodePumpStatus: %w", err)
+	}
+	ps := PumpStatus{
+		Type:    int(wire.Type),
+		Running: wire.Running != 0,
+		Watts:   int(wire.Watts),
+		RPM:     int(wire.RPM),
+		GPM:     int(wire.GPM),
+	}
+	for _, c := range wire.Circuits {
+		if c.CircuitID == 0 {
+			continue
+		}
+		ps.Circuits = append(ps.Circuits, PumpCircuit{
+			CircuitID: int(c.CircuitID),
+			Speed:     int(c.Speed),
+			IsRPM:     c.IsRPM != 0,
+		})
+	}
+	return ps, nil
+}
+
+// EncodePumpStatus encodes ps as the payload of a response to a
+// MsgGetPumpStatus request, at most 8 circuits are encoded.
+func EncodePumpStatus(ps PumpStatus) ([]byte, error) {
+	wire := pumpStatusWire{
+		Type:    uint32(ps.Type),
+		Running: uint32(boolToUint8(ps.Running)),
+		Watts:   uint32(ps.Watts),
+		RPM:     uint32(ps.RPM),
+		GPM:     uint32(ps.GPM),
+	}
+	for i, c := range ps.Circuits {
+		if i >= len(wire.Circuits) {
+			break
+		}
+		wire.Circuits[i] = pumpCircuitWire{
+			CircuitID: uint32(c.CircuitID),
+			Speed:     uint32(c.Speed),
+			IsRPM:     uint32(boolToUint8(c.IsRPM)),
+		}
+	}
+	return Marshal(wire)
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ScheduleType int
+
+const (
+	ScheduleRecurring ScheduleType = iota
+	ScheduleRunOnce
+)
+
+func (st ScheduleType) String() string {
+	switch st {
+	case ScheduleRecurring:
+		return "Recurring"
+	case ScheduleRunOnce:
+		return "Run Once"
+	}
+	return ""
+}
+
+// DayMask represents the days of the week on which a schedule runs,
+// Monday is the least significant bit.
+type DayMask uint8
+
+var dayNames = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+func (dm DayMask) String() string {
+	var days []string
+	for i, d := range dayNames {
+		if dm&(1<<i) != 0 {
+			days = append(days, d)
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+// ParseDayMask parses a comma separated list of day names, eg.
+// "Mon,Wed,Fri", ignoring case. "daily" includes every day.
+func ParseDayMask(days string) (DayMask, error) {
+	if strings.EqualFold(days, "daily") {
+		return 0x7f, nil
+	}
+	var dm DayMask
+	for _, d := range strings.Split(days, ",") {
+		d = strings.TrimSpace(d)
+		found := false
+		for i, n := range dayNames {
+			if strings.EqualFold(d, n) {
+				dm |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown day: %q", d)
+		}
+	}
+	return dm, nil
+}
+
+// Has returns true if the mask includes the specified day.
+func (dm DayMask) Has(day time.Weekday) bool {
+	return dm&(1<<((int(day)+6)%7)) != 0
+}
+
+// Schedule represents a single scheduled event.
+type Schedule struct {
+	ID           int
+	CircuitID    int
+	Start        time.Duration // Since midnight.
+	Stop         time.Duration // Since midnight.
+	Days         DayMask
+	Flags        int
+	HeatCmd      int
+	HeatSetPoint int
+}
+
+// ScheduleRequest is the payload of a MsgGetSchedules request.
+type ScheduleRequest struct {
+	Controller uint32
+	Type       ScheduleType `sl:"uint32"`
+}
+
+// scheduleWire is the wire representation of a single scheduled event,
+// times are in minutes since midnight.
+type scheduleWire struct {
+	ID           uint32
+	CircuitID    uint32
+	Start        uint32
+	Stop         uint32
+	Days         uint32
+	Flags        uint32
+	HeatCmd      uint32
+	HeatSetPoint uint32
+}
+
+// schedulesWire is the wire representation of the response to a
+// MsgGetSchedules request.
+type schedulesWire struct {
+	Schedules []scheduleWire
+}
+
+func GetSchedules(ctx context.Context, s *Session, st ScheduleType) ([]Schedule, error) {
+	id := s.NextID()
+	m, err := MarshalMessage(id, MsgGetSchedules, ScheduleRequest{Type: st})
+	if err != nil {
+		return nil, fmt.Errorf("getSchedules: %w", err)
+	}
+	rm, err := sendAndValidate(ctx, s, m, id, MsgGetSchedules)
+	if err != nil {
+		return nil, fmt.Errorf("getSchedules: %w", err)
+	}
+	return DecodeSchedules(rm)
+}
+
+func DecodeSchedules(rm Message) ([]Schedule, error) {
+	var wire schedulesWire
+	if err := Unmarshal(rm.Payload(), &wire); err != nil {
+		return nil, fmt.Errorf("decodeSchedules: %w", err)
+	}
+	schedules := make([]Schedule, 0, len(wire.Schedules))
+	for _, w := range wire.Schedules {
+		schedules = append(schedules, Schedule{
+			ID:           int(w.ID),
+			CircuitID:    int(w.CircuitID),
+			Start:        time.Duration(w.Start) * time.Minute,
+			Stop:         time.Duration(w.Stop) * time.Minute,
+			Days:         DayMask(w.Days),
+			Flags:        int(w.Flags),
+			HeatCmd:      int(w.HeatCmd),
+			HeatSetPoint: int(w.HeatSetPoint),
+		})
+	}
+	return schedules, nil
+}
+
+// EncodeSchedules encodes schedules as the payload of a response to
+// a MsgGetSchedules request.
+func EncodeSchedules(schedules []Schedule) ([]byte, error) {
+	var wire schedulesWire
+	for _, s := range schedules {
+		wire.Schedules = append(wire.Schedules, scheduleWire{
+			ID:           uint32(s.ID),
+			CircuitID:    uint32(s.CircuitID),
+			Start:        uint32(s.Start / time.Minute),
+			Stop:         uint32(s.Stop / time.Minute),
+			Days:         uint32(s.Days),
+			Flags:        uint32(s.Flags),
+			HeatCmd:      uint32(s.HeatCmd),
+			HeatSetPoint: uint32(s.HeatSetPoint),
+		})
+	}
+	return Marshal(wire)
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import "strconv"
+
+// The enumerated types used in ControllerConfig and ControllerStatus
+// implement encoding.TextMarshaler and encoding.TextUnmarshaler so that
+// they are represented by their names when encoded as JSON. Values that
+// have no name are represented by their decimal value.
+
+func marshalEnum(name string, v int) ([]byte, error) {
+	if len(name) == 0 {
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	}
+	return []byte(name), nil
+}
+
+func unmarshalEnum[T ~int](text []byte, parse func(string) (T, error)) (T, error) {
+	v, err := parse(string(text))
+	if err == nil {
+		return v, nil
+	}
+	if n, nerr := strconv.Atoi(string(text)); nerr == nil {
+		return T(n), nil
+	}
+	return 0, err
+}
+
+func (cs ControllerState) MarshalText() ([]byte, error) {
+	return marshalEnum(cs.String(), int(cs))
+}
+
+func (cs *ControllerState) UnmarshalText(text []byte) (err error) {
+	*cs, err = unmarshalEnum(text, ParseControllerState)
+	return
+}
+
+func (bt BodyType) MarshalText() ([]byte, error) {
+	return marshalEnum(bt.String(), int(bt))
+}
+
+func (bt *BodyType) UnmarshalText(text []byte) (err error) {
+	*bt, err = unmarshalEnum(text, ParseBodyType)
+	return
+}
+
+func (hm HeatMode) MarshalText() ([]byte, error) {
+	return marshalEnum(hm.String(), int(hm))
+}
+
+func (hm *HeatMode) UnmarshalText(text []byte) (err error) {
+	*hm, err = unmarshalEnum(text, ParseHeatMode)
+	return
+}
+
+func (hs HeatStatus) MarshalText() ([]byte, error) {
+	return marshalEnum(hs.String(), int(hs))
+}
+
+func (hs *HeatStatus) UnmarshalText(text []byte) (err error) {
+	*hs, err = unmarshalEnum(text, ParseHeatStatus)
+	return
+}
+
+func (cm ColorMode) MarshalText() ([]byte, error) {
+	return marshalEnum(cm.String(), int(cm))
+}
+
+func (cm *ColorMode) UnmarshalText(text []byte) (err error) {
+	*cm, err = unmarshalEnum(text, ParseColorMode)
+	return
+}
+
+func (cf CircuitFunction) MarshalText() ([]byte, error) {
+	return marshalEnum(cf.String(), int(cf))
+}
+
+func (cf *CircuitFunction) UnmarshalText(text []byte) (err error) {
+	*cf, err = unmarshalEnum(text, ParseCircuitFunction)
+	return
+}
+
+func (ifc CircuitInterface) MarshalText() ([]byte, error) {
+	return marshalEnum(ifc.String(), int(ifc))
+}
+
+func (ifc *CircuitInterface) UnmarshalText(text []byte) (err error) {
+	*ifc, err = unmarshalEnum(text, ParseCircuitInterface)
+	return
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package protocol_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+func TestJSON(t *testing.T) {
+	st := protocol.ControllerStatus{
+		State: protocol.ControllerReady,
+		Bodies: []protocol.BodyStatus{
+			{Type: protocol.BodySpa, HeatStatus: protocol.HeatStatusHeater, HeatMode: protocol.HeatModeSolarPreferred, HeatSetPoint: 101},
+		},
+		Circuits: []protocol.CircuitStatus{{ID: 500, State: true}},
+		PH:       7.4,
+	}
+	buf, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"state":"Ready"`,
+		`"type":"Spa"`,
+		`"heat_status":"Heater"`,
+		`"heat_mode":"Solar Preferred"`,
+		`"heat_set_point":101`,
+		`"circuits":[{"id":500,"state":true,"delay":false}]`,
+		`"ph":7.4`,
+	} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("missing %v in %s", want, buf)
+		}
+	}
+	var got protocol.ControllerStatus
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Errorf("got %+v, want %+v", got, st)
+	}
+
+	cfg := protocol.ControllerConfig{
+		Circuits: []protocol.Circuit{
+			{ID: 502, Name: "Pool Light", Function: protocol.CircuitIntelliBrite, Interface: protocol.InterfaceLights},
+			{ID: 503, Function: protocol.CircuitFunction(99), Interface: protocol.InterfaceDontShow},
+		},
+	}
+	buf, err = json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"function":"IntelliBrite","interface":"Lights"`,
+		`"function":"99","interface":"Don't Show"`,
+	} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("missing %v in %s", want, buf)
+		}
+	}
+	var gotCfg protocol.ControllerConfig
+	if err := json.Unmarshal(buf, &gotCfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotCfg, cfg) {
+		t.Errorf("got %+v, want %+v", gotCfg, cfg)
+	}
+
+	var cm protocol.ColorMode
+	if err := json.Unmarshal([]byte(`"all on"`), &cm); err != nil || cm != protocol.ColorAllOn {
+		t.Errorf("got %v, %v", cm, err)
+	}
+	if err := json.Unmarshal([]byte(`"disco"`), &cm); err == nil {
+		t.Errorf("expected an error")
+	}
+}
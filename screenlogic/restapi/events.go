@@ -0,0 +1,220 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// StatusSource is the source of the status streamed by Events, it is
+// implemented by screenlogic.Adapter.
+type StatusSource interface {
+	GetStatus(ctx context.Context) (protocol.ControllerStatus, error)
+}
+
+// Events streams the controller's status as server-sent events. The
+// status is obtained by polling and the following events are sent:
+//
+//	status  the complete status, as a ControllerStatus, sent when a
+//	        client first connects
+//	update  the fields that changed since the previous event, as a
+//	        StatusUpdate
+//	error   {"error": "..."} when polling the controller fails
+//
+// The controller is only polled whilst there are connected clients.
+// Clients that do not keep up with the stream are disconnected and
+// will receive a complete status when they reconnect.
+type Events struct {
+	src      StatusSource
+	interval time.Duration
+	pollCh   chan struct{}
+
+	mu          sync.Mutex
+	status      protocol.ControllerStatus
+	haveStatus  bool
+	id          int
+	subscribers map[chan event]struct{}
+}
+
+type event struct {
+	id   int
+	name string
+	data []byte
+}
+
+// subscriberQueue is the number of events that may be queued for a
+// client before it is disconnected.
+const subscriberQueue = 32
+
+// NewEvents returns a new Events that polls src at the specified
+// interval once Run is called.
+func NewEvents(src StatusSource, interval time.Duration) *Events {
+	return &Events{
+		src:         src,
+		interval:    interval,
+		pollCh:      make(chan struct{}, 1),
+		subscribers: map[chan event]struct{}{},
+	}
+}
+
+// Run polls the source, whilst there are connected clients, until the
+// context is canceled.
+func (e *Events) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-e.pollCh:
+		}
+		e.mu.Lock()
+		n := len(e.subscribers)
+		e.mu.Unlock()
+		if n == 0 {
+			continue
+		}
+		e.poll(ctx)
+	}
+}
+
+func (e *Events) pollNow() {
+	select {
+	case e.pollCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Events) poll(ctx context.Context) {
+	st, err := e.src.GetStatus(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		ctxlog.Warn(ctx, "screenlogic: restapi: poll failed", "err", err)
+		e.broadcast(ctx, "error", struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		return
+	}
+	if !e.haveStatus {
+		e.status, e.haveStatus = st, true
+		e.broadcast(ctx, "status", st)
+		return
+	}
+	su, changed := NewStatusUpdate(e.status, st)
+	e.status = st
+	if changed {
+		e.broadcast(ctx, "update", su)
+	}
+}
+
+// broadcast sends an event to all subscribers, it must be called with
+// e.mu held.
+func (e *Events) broadcast(ctx context.Context, name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		ctxlog.Warn(ctx, "screenlogic: restapi: marshal failed", "event", name, "err", err)
+		return
+	}
+	e.id++
+	ev := event{id: e.id, name: name, data: data}
+	for ch := range e.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			ctxlog.Info(ctx, "screenlogic: restapi: dropping slow client")
+			e.unsubscribeLocked(ch)
+		}
+	}
+}
+
+// subscribe registers a new subscriber and returns the complete status
+// to be sent to it, if available.
+func (e *Events) subscribe(ctx context.Context) (chan event, *event) {
+	ch := make(chan event, subscriberQueue)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers[ch] = struct{}{}
+	if !e.haveStatus {
+		e.pollNow()
+		return ch, nil
+	}
+	data, err := json.Marshal(e.status)
+	if err != nil {
+		ctxlog.Warn(ctx, "screenlogic: restapi: marshal failed", "event", "status", "err", err)
+		return ch, nil
+	}
+	return ch, &event{id: e.id, name: "status", data: data}
+}
+
+func (e *Events) unsubscribe(ch chan event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.unsubscribeLocked(ch)
+}
+
+func (e *Events) unsubscribeLocked(ch chan event) {
+	if _, ok := e.subscribers[ch]; !ok {
+		return
+	}
+	delete(e.subscribers, ch)
+	close(ch)
+	if len(e.subscribers) == 0 {
+		// The status will be stale by the time the next client connects.
+		e.haveStatus = false
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.id, ev.name, ev.data)
+	if err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Events) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+	ch, initial := e.subscribe(ctx)
+	defer e.unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	if initial != nil {
+		if err := writeEvent(w, *initial); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, ev); err != nil {
+				ctxlog.Info(ctx, "screenlogic: restapi: write failed", "err", err)
+				return
+			}
+		}
+	}
+}
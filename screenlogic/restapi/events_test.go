@@ -0,0 +1,163 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package restapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/restapi"
+)
+
+func TestStatusUpdate(t *testing.T) {
+	prev := protocol.ControllerStatus{
+		AirTemp: 70,
+		Bodies: []protocol.BodyStatus{
+			{Type: protocol.BodyPool, CurrentTemp: 78, HeatSetPoint: 82},
+			{Type: protocol.BodySpa, CurrentTemp: 80},
+		},
+		Circuits: []protocol.CircuitStatus{{ID: 500}, {ID: 501, State: true}},
+		PH:       7.4,
+	}
+	if _, ok := restapi.NewStatusUpdate(prev, prev); ok {
+		t.Errorf("expected no changes")
+	}
+	next := protocol.ControllerStatus{
+		AirTemp: 71,
+		Bodies: []protocol.BodyStatus{
+			{Type: protocol.BodyPool, CurrentTemp: 78, HeatSetPoint: 84, HeatMode: protocol.HeatModeHeater},
+			{Type: protocol.BodySpa, CurrentTemp: 80},
+		},
+		Circuits: []protocol.CircuitStatus{{ID: 500, State: true}, {ID: 501, State: true}, {ID: 502}},
+		PH:       7.4,
+		Alert:    1,
+	}
+	su, ok := restapi.NewStatusUpdate(prev, next)
+	if !ok {
+		t.Fatalf("expected changes")
+	}
+	buf, err := json.Marshal(su)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"air_temp":71,"bodies":[{"type":"Pool","heat_set_point":84,"heat_mode":"Heater"}],"circuits":[{"id":500,"state":true,"delay":false},{"id":502,"state":false,"delay":false}],"alert":1}`
+	if got := string(buf); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := su.Apply(prev); !reflect.DeepEqual(got, next) {
+		t.Errorf("got %+v, want %+v", got, next)
+	}
+	if prev.Circuits[0].State || prev.Bodies[0].HeatSetPoint != 82 {
+		t.Errorf("apply modified its argument: %+v", prev)
+	}
+}
+
+type sseEvent struct {
+	id, name, data string
+}
+
+func readEvent(t *testing.T, sc *bufio.Scanner) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for sc.Scan() {
+		line := sc.Text()
+		if len(line) == 0 {
+			return ev
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.name = value
+		case "data":
+			ev.data = value
+		}
+	}
+	t.Fatalf("stream ended: %v", sc.Err())
+	return ev
+}
+
+func TestEvents(t *testing.T) {
+	gw, addr := startSimulator(t)
+	events := restapi.NewEvents(newAdapter(t, addr), 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = events.Run(ctx)
+	}()
+	srv := httptest.NewServer(events)
+	defer srv.Close()
+
+	connect := func() (*bufio.Scanner, func()) {
+		rctx, rcancel := context.WithCancel(ctx)
+		req, _ := http.NewRequestWithContext(rctx, "GET", srv.URL, nil)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.Header.Get("Content-Type"), "text/event-stream"; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		return bufio.NewScanner(resp.Body), func() {
+			rcancel()
+			resp.Body.Close()
+		}
+	}
+
+	sc, done := connect()
+	ev := readEvent(t, sc)
+	if got, want := ev.name, "status"; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var st protocol.ControllerStatus
+	if err := json.Unmarshal([]byte(ev.data), &st); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.AirTemp, 72; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := gw.SetCircuit(502, true); err != nil {
+		t.Fatal(err)
+	}
+	ev = readEvent(t, sc)
+	if got, want := ev.name, "update"; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := ev.data, `{"circuits":[{"id":502,"state":true,"delay":false}]}`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.AirTemp = 75
+		st.Bodies[0].CurrentTemp = 79
+	})
+	ev = readEvent(t, sc)
+	if got, want := ev.data, `{"air_temp":75,"bodies":[{"type":"Pool","current_temp":79}]}`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A second client receives the complete, current, status.
+	sc2, done2 := connect()
+	ev = readEvent(t, sc2)
+	var st2 protocol.ControllerStatus
+	if err := json.Unmarshal([]byte(ev.data), &st2); err != nil {
+		t.Fatal(err)
+	}
+	if ev.name != "status" || st2.AirTemp != 75 || !st2.StatusForID(502) {
+		t.Errorf("unexpected event: %v: %+v", ev.name, st2)
+	}
+	done2()
+	done()
+}
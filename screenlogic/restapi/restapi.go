@@ -0,0 +1,386 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package restapi provides an http.Handler that exposes a screenlogic
+// controller as a REST/JSON API. The endpoints are:
+//
+//	GET /config          the controller's configuration
+//	GET /status          the controller's status
+//	GET /circuits        the configuration and state of all circuits
+//	GET /circuits/{name} the configuration and state of a circuit
+//	PUT /circuits/{name} turn a circuit on or off
+//	GET /bodies          the status of the pool and spa
+//	GET /bodies/{name}   the status of the pool or spa
+//	PUT /bodies/{name}   set the heat set point and/or heat mode
+//	GET /lights          the configuration and state of all lights
+//	PUT /lights          send a command to all color lights
+//
+// Circuits may be named by their name, ignoring case, or their ID.
+// The body for PUT /circuits/{name} is either one of "on" or "off"
+// or a JSON object of the form {"state": true}. The body for
+// PUT /bodies/{name} is a JSON object with either or both of
+// "heat_set_point" and "heat_mode" and that for PUT /lights is a JSON
+// object of the form {"mode": "party"}.
+//
+// Errors are returned as a JSON object of the form {"error": "..."}.
+//
+// Events provides a stream of status changes as server-sent events and
+// is typically served as GET /events alongside the above.
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// Controller is the interface to the screenlogic controller used by
+// the API, it is implemented by screenlogic.Adapter.
+type Controller interface {
+	GetConfig(ctx context.Context) (protocol.ControllerConfig, error)
+	GetStatus(ctx context.Context) (protocol.ControllerStatus, error)
+	SetCircuit(ctx context.Context, id int, on bool) error
+	SetLightMode(ctx context.Context, mode protocol.ColorMode) error
+	Do(ctx context.Context, ops ...screenlogic.Op) ([]screenlogic.OpResult, error)
+}
+
+// CircuitState represents the configuration and state of a circuit.
+type CircuitState struct {
+	protocol.Circuit
+	State bool `json:"state"`
+}
+
+// BodyRequest is the body of a PUT /bodies/{name} request.
+type BodyRequest struct {
+	HeatSetPoint *int               `json:"heat_set_point,omitempty"`
+	HeatMode     *protocol.HeatMode `json:"heat_mode,omitempty"`
+}
+
+// LightRequest is the body of a PUT /lights request and its response.
+type LightRequest struct {
+	Mode protocol.ColorMode `json:"mode"`
+}
+
+// Handler implements http.Handler for the REST API.
+type Handler struct {
+	ctrl Controller
+	mux  *http.ServeMux
+}
+
+// New returns a new Handler for the supplied controller.
+func New(ctrl Controller) *Handler {
+	h := &Handler{ctrl: ctrl, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /config", h.getConfig)
+	h.mux.HandleFunc("GET /status", h.getStatus)
+	h.mux.HandleFunc("GET /circuits", h.getCircuits)
+	h.mux.HandleFunc("GET /circuits/{name}", h.getCircuit)
+	h.mux.HandleFunc("PUT /circuits/{name}", h.putCircuit)
+	h.mux.HandleFunc("GET /bodies", h.getBodies)
+	h.mux.HandleFunc("GET /bodies/{name}", h.getBody)
+	h.mux.HandleFunc("PUT /bodies/{name}", h.putBody)
+	h.mux.HandleFunc("GET /lights", h.getLights)
+	h.mux.HandleFunc("PUT /lights", h.putLights)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// statusError is an error with an associated HTTP status code.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(format string, args ...any) error {
+	return &statusError{code: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &statusError{code: http.StatusNotFound, err: fmt.Errorf(format, args...)}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		ctxlog.Warn(ctx, "screenlogic: restapi: write failed", "err", err)
+	}
+}
+
+// respond writes v as the response, or err as an error response. Errors
+// that are not a statusError are assumed to have been returned by the
+// controller, which rejects invalid parameters with
+// protocol.ErrBadParameter. Commands refused because the controller is
+// in service mode, or syncing, result in a 503 and those that would
+// violate an interlock in a 409.
+func respond(w http.ResponseWriter, r *http.Request, v any, err error) {
+	ctx := r.Context()
+	if err == nil {
+		writeJSON(ctx, w, http.StatusOK, v)
+		return
+	}
+	code := http.StatusBadGateway
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		code = se.code
+	case errors.Is(err, protocol.ErrBadParameter):
+		code = http.StatusBadRequest
+	case errors.Is(err, screenlogic.ErrControllerInService),
+		errors.Is(err, screenlogic.ErrControllerSyncing),
+		errors.Is(err, screenlogic.ErrGatewayUnavailable):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, screenlogic.ErrInterlock):
+		code = http.StatusConflict
+	case errors.Is(err, screenlogic.ErrRateLimited):
+		code = http.StatusTooManyRequests
+	}
+	ctxlog.Info(ctx, "screenlogic: restapi: request failed", "method", r.Method, "path", r.URL.Path, "code", code, "err", err)
+	writeJSON(ctx, w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.ctrl.GetConfig(r.Context())
+	respond(w, r, cfg, err)
+}
+
+func (h *Handler) getStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := h.ctrl.GetStatus(r.Context())
+	respond(w, r, st, err)
+}
+
+func (h *Handler) configAndStatus(ctx context.Context) (protocol.ControllerConfig, protocol.ControllerStatus, error) {
+	cfg, err := h.ctrl.GetConfig(ctx)
+	if err != nil {
+		return cfg, protocol.ControllerStatus{}, err
+	}
+	st, err := h.ctrl.GetStatus(ctx)
+	return cfg, st, err
+}
+
+// findCircuit returns the circuit with the specified name, ignoring
+// case, or ID.
+func findCircuit(cfg protocol.ControllerConfig, name string) (protocol.Circuit, error) {
+	id, idErr := strconv.Atoi(name)
+	for _, c := range cfg.Circuits {
+		if strings.EqualFold(c.Name, name) || (idErr == nil && c.ID == id) {
+			return c, nil
+		}
+	}
+	return protocol.Circuit{}, notFound("unknown circuit: %q", name)
+}
+
+func circuitStates(cfg protocol.ControllerConfig, st protocol.ControllerStatus, include func(protocol.Circuit) bool) []CircuitState {
+	circuits := []CircuitState{}
+	for _, c := range cfg.Circuits {
+		if include(c) {
+			circuits = append(circuits, CircuitState{Circuit: c, State: st.StatusForID(c.ID)})
+		}
+	}
+	return circuits
+}
+
+func (h *Handler) getCircuits(w http.ResponseWriter, r *http.Request) {
+	cfg, st, err := h.configAndStatus(r.Context())
+	if err != nil {
+		respond(w, r, nil, err)
+		return
+	}
+	respond(w, r, circuitStates(cfg, st, func(protocol.Circuit) bool { return true }), nil)
+}
+
+func (h *Handler) circuit(ctx context.Context, name string) (CircuitState, error) {
+	cfg, st, err := h.configAndStatus(ctx)
+	if err != nil {
+		return CircuitState{}, err
+	}
+	c, err := findCircuit(cfg, name)
+	if err != nil {
+		return CircuitState{}, err
+	}
+	return CircuitState{Circuit: c, State: st.StatusForID(c.ID)}, nil
+}
+
+func (h *Handler) getCircuit(w http.ResponseWriter, r *http.Request) {
+	cs, err := h.circuit(r.Context(), r.PathValue("name"))
+	respond(w, r, cs, err)
+}
+
+// parseOnOff parses the body of a PUT /circuits/{name} request.
+func parseOnOff(body []byte) (bool, error) {
+	text := strings.Trim(strings.TrimSpace(string(body)), `"`)
+	switch strings.ToLower(text) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	var req struct {
+		State *bool `json:"state"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.State == nil {
+		return false, badRequest("invalid request body, expected on, off or {\"state\": true|false}: %q", text)
+	}
+	return *req.State, nil
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		return nil, badRequest("failed to read request body: %v", err)
+	}
+	return body, nil
+}
+
+func (h *Handler) putCircuit(w http.ResponseWriter, r *http.Request) {
+	cs, err := h.putCircuitState(r.Context(), r)
+	respond(w, r, cs, err)
+}
+
+func (h *Handler) putCircuitState(ctx context.Context, r *http.Request) (CircuitState, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return CircuitState{}, err
+	}
+	on, err := parseOnOff(body)
+	if err != nil {
+		return CircuitState{}, err
+	}
+	cfg, err := h.ctrl.GetConfig(ctx)
+	if err != nil {
+		return CircuitState{}, err
+	}
+	c, err := findCircuit(cfg, r.PathValue("name"))
+	if err != nil {
+		return CircuitState{}, err
+	}
+	if err := h.ctrl.SetCircuit(ctx, c.ID, on); err != nil {
+		return CircuitState{}, err
+	}
+	return h.circuit(ctx, strconv.Itoa(c.ID))
+}
+
+func (h *Handler) getBodies(w http.ResponseWriter, r *http.Request) {
+	st, err := h.ctrl.GetStatus(r.Context())
+	if st.Bodies == nil {
+		st.Bodies = []protocol.BodyStatus{}
+	}
+	respond(w, r, st.Bodies, err)
+}
+
+func (h *Handler) body(ctx context.Context, bt protocol.BodyType) (protocol.BodyStatus, error) {
+	st, err := h.ctrl.GetStatus(ctx)
+	if err != nil {
+		return protocol.BodyStatus{}, err
+	}
+	bs, ok := st.Body(bt)
+	if !ok {
+		return protocol.BodyStatus{}, notFound("no status for body: %v", bt)
+	}
+	return bs, nil
+}
+
+func parseBody(name string) (protocol.BodyType, error) {
+	bt, err := protocol.ParseBodyType(name)
+	if err != nil {
+		return 0, notFound("%v", err)
+	}
+	return bt, nil
+}
+
+func (h *Handler) getBody(w http.ResponseWriter, r *http.Request) {
+	bt, err := parseBody(r.PathValue("name"))
+	if err != nil {
+		respond(w, r, nil, err)
+		return
+	}
+	bs, err := h.body(r.Context(), bt)
+	respond(w, r, bs, err)
+}
+
+func (h *Handler) putBody(w http.ResponseWriter, r *http.Request) {
+	bs, err := h.putBodyState(r.Context(), r)
+	respond(w, r, bs, err)
+}
+
+func (h *Handler) putBodyState(ctx context.Context, r *http.Request) (protocol.BodyStatus, error) {
+	bt, err := parseBody(r.PathValue("name"))
+	if err != nil {
+		return protocol.BodyStatus{}, err
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return protocol.BodyStatus{}, err
+	}
+	var req BodyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return protocol.BodyStatus{}, badRequest("invalid request body: %v", err)
+	}
+	if req.HeatSetPoint == nil && req.HeatMode == nil {
+		return protocol.BodyStatus{}, badRequest("one of heat_set_point or heat_mode must be specified")
+	}
+	var ops []screenlogic.Op
+	if req.HeatSetPoint != nil {
+		ops = append(ops, screenlogic.HeatSetPointOp(bt, *req.HeatSetPoint))
+	}
+	if req.HeatMode != nil {
+		ops = append(ops, screenlogic.HeatModeOp(bt, *req.HeatMode))
+	}
+	if _, err := h.ctrl.Do(ctx, ops...); err != nil {
+		return protocol.BodyStatus{}, err
+	}
+	return h.body(ctx, bt)
+}
+
+func (h *Handler) getLights(w http.ResponseWriter, r *http.Request) {
+	cfg, st, err := h.configAndStatus(r.Context())
+	if err != nil {
+		respond(w, r, nil, err)
+		return
+	}
+	respond(w, r, circuitStates(cfg, st, func(c protocol.Circuit) bool {
+		return c.Interface == protocol.InterfaceLights
+	}), nil)
+}
+
+func (h *Handler) putLights(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		respond(w, r, nil, err)
+		return
+	}
+	var req struct {
+		Mode *protocol.ColorMode `json:"mode"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Mode == nil {
+		respond(w, r, nil, badRequest("invalid request body, expected {\"mode\": <light command>}: %q", body))
+		return
+	}
+	err = h.ctrl.SetLightMode(r.Context(), *req.Mode)
+	respond(w, r, LightRequest{Mode: *req.Mode}, err)
+}
@@ -0,0 +1,195 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package restapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/restapi"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+)
+
+func startSimulator(t *testing.T) (*simulator.Gateway, string) {
+	t.Helper()
+	gw, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return gw, ln.Addr().String()
+}
+
+func newAdapter(t *testing.T, addr string) *screenlogic.Adapter {
+	t.Helper()
+	pa, err := screenlogic.NewStandaloneAdapter(screenlogic.AdapterConfig{
+		IPAddress: addr,
+		KeepAlive: time.Minute,
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// See the comment in screenlogic.newAdapter.
+		time.Sleep(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pa.Close(ctx); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return pa
+}
+
+func request(t *testing.T, srv *httptest.Server, method, path, body string, code int, result any) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.StatusCode, code; got != want {
+		t.Fatalf("%v %v: got %v, want %v: %s", method, path, got, want, buf)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("%v %v: got %v, want %v", method, path, got, want)
+	}
+	if result == nil {
+		return
+	}
+	if err := json.Unmarshal(buf, result); err != nil {
+		t.Fatalf("%v %v: %v: %s", method, path, err, buf)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	gw, addr := startSimulator(t)
+	srv := httptest.NewServer(restapi.New(newAdapter(t, addr)))
+	defer srv.Close()
+
+	var cfg protocol.ControllerConfig
+	request(t, srv, "GET", "/config", "", http.StatusOK, &cfg)
+	if got, want := len(cfg.Circuits), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cfg.Circuits[2].Function, protocol.CircuitIntelliBrite; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var st protocol.ControllerStatus
+	request(t, srv, "GET", "/status", "", http.StatusOK, &st)
+	if got, want := st.AirTemp, 72; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var circuits []restapi.CircuitState
+	request(t, srv, "GET", "/circuits", "", http.StatusOK, &circuits)
+	if got, want := len(circuits), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var cs restapi.CircuitState
+	request(t, srv, "GET", "/circuits/pool%20light", "", http.StatusOK, &cs)
+	if got, want := cs.ID, 502; got != want || cs.State {
+		t.Errorf("got %v (%v), want %v", got, cs.State, want)
+	}
+	request(t, srv, "PUT", "/circuits/Pool%20Light", "on", http.StatusOK, &cs)
+	if !cs.State || !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+	request(t, srv, "PUT", "/circuits/502", `{"state": false}`, http.StatusOK, &cs)
+	if cs.State || gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+	request(t, srv, "PUT", "/circuits/waterfall", `"ON"`, http.StatusOK, &cs)
+	if !cs.State || cs.ID != 504 {
+		t.Errorf("circuit 504 should be on: %+v", cs)
+	}
+
+	var bodies []protocol.BodyStatus
+	request(t, srv, "GET", "/bodies", "", http.StatusOK, &bodies)
+	if got, want := len(bodies), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var bs protocol.BodyStatus
+	request(t, srv, "GET", "/bodies/spa", "", http.StatusOK, &bs)
+	if got, want := bs.HeatSetPoint, 100; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	request(t, srv, "PUT", "/bodies/spa", `{"heat_set_point": 102, "heat_mode": "heater"}`, http.StatusOK, &bs)
+	if bs.HeatSetPoint != 102 || bs.HeatMode != protocol.HeatModeHeater {
+		t.Errorf("unexpected body status: %+v", bs)
+	}
+
+	var lights []restapi.CircuitState
+	request(t, srv, "GET", "/lights", "", http.StatusOK, &lights)
+	if got, want := len(lights), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var lr restapi.LightRequest
+	request(t, srv, "PUT", "/lights", `{"mode": "party"}`, http.StatusOK, &lr)
+	if got, want := gw.LightMode(), protocol.ColorParty; got != want || lr.Mode != want {
+		t.Errorf("got %v (%v), want %v", got, lr.Mode, want)
+	}
+
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/circuits/jacuzzi", "", http.StatusNotFound},
+		{"PUT", "/circuits/jacuzzi", "on", http.StatusNotFound},
+		{"PUT", "/circuits/502", "maybe", http.StatusBadRequest},
+		{"GET", "/bodies/lake", "", http.StatusNotFound},
+		{"PUT", "/bodies/pool", `{}`, http.StatusBadRequest},
+		{"PUT", "/bodies/pool", `{"heat_mode": "boil"}`, http.StatusBadRequest},
+		{"PUT", "/bodies/pool", `{"heat_mode": "9"}`, http.StatusBadRequest},
+		{"PUT", "/lights", `{"mode": "disco"}`, http.StatusBadRequest},
+	} {
+		errResp.Error = ""
+		request(t, srv, tc.method, tc.path, tc.body, tc.code, &errResp)
+		if len(errResp.Error) == 0 {
+			t.Errorf("%v %v: missing error", tc.method, tc.path)
+		}
+	}
+
+	if err := gw.Inject(simulator.Fault{Request: "GetStatus", Count: 1, Reply: "InvalidRequest"}); err != nil {
+		t.Fatal(err)
+	}
+	request(t, srv, "GET", "/status", "", http.StatusBadGateway, &errResp)
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package restapi
+
+import (
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// StatusUpdate contains only those fields of a ControllerStatus that
+// changed between two successive polls, fields that did not change are
+// nil or empty and are omitted from its JSON encoding.
+type StatusUpdate struct {
+	State        *protocol.ControllerState `json:"state,omitempty"`
+	FreezeMode   *bool                     `json:"freeze_mode,omitempty"`
+	PoolDelay    *bool                     `json:"pool_delay,omitempty"`
+	SpaDelay     *bool                     `json:"spa_delay,omitempty"`
+	CleanerDelay *bool                     `json:"cleaner_delay,omitempty"`
+	AirTemp      *int                      `json:"air_temp,omitempty"`
+	Bodies       []BodyUpdate              `json:"bodies,omitempty"`
+	Circuits     []protocol.CircuitStatus  `json:"circuits,omitempty"`
+	PH           *float64                  `json:"ph,omitempty"`
+	ORP          *int                      `json:"orp,omitempty"`
+	Saturation   *float64                  `json:"saturation,omitempty"`
+	SaltPPM      *int                      `json:"salt_ppm,omitempty"`
+	PHTank       *int                      `json:"ph_tank,omitempty"`
+	ORPTank      *int                      `json:"orp_tank,omitempty"`
+	Alert        *int                      `json:"alert,omitempty"`
+}
+
+// BodyUpdate contains the fields of a BodyStatus that changed, the Type
+// is always present.
+type BodyUpdate struct {
+	Type         protocol.BodyType    `json:"type"`
+	CurrentTemp  *int                 `json:"current_temp,omitempty"`
+	HeatStatus   *protocol.HeatStatus `json:"heat_status,omitempty"`
+	HeatSetPoint *int                 `json:"heat_set_point,omitempty"`
+	CoolSetPoint *int                 `json:"cool_set_point,omitempty"`
+	HeatMode     *protocol.HeatMode   `json:"heat_mode,omitempty"`
+}
+
+func changed[T comparable](prev, next T, field **T, diff *bool) {
+	if prev != next {
+		*field = &next
+		*diff = true
+	}
+}
+
+func set[T any](field *T, v *T) {
+	if v != nil {
+		*field = *v
+	}
+}
+
+func diffBody(prev, next protocol.BodyStatus) (BodyUpdate, bool) {
+	bu := BodyUpdate{Type: next.Type}
+	var ok bool
+	changed(prev.CurrentTemp, next.CurrentTemp, &bu.CurrentTemp, &ok)
+	changed(prev.HeatStatus, next.HeatStatus, &bu.HeatStatus, &ok)
+	changed(prev.HeatSetPoint, next.HeatSetPoint, &bu.HeatSetPoint, &ok)
+	changed(prev.CoolSetPoint, next.CoolSetPoint, &bu.CoolSetPoint, &ok)
+	changed(prev.HeatMode, next.HeatMode, &bu.HeatMode, &ok)
+	return bu, ok
+}
+
+// NewStatusUpdate returns the fields that differ between prev and next
+// and true if there are any such fields. Bodies and circuits that
+// are present in next but not in prev are included in their entirety.
+func NewStatusUpdate(prev, next protocol.ControllerStatus) (StatusUpdate, bool) {
+	var su StatusUpdate
+	var ok bool
+	changed(prev.State, next.State, &su.State, &ok)
+	changed(prev.FreezeMode, next.FreezeMode, &su.FreezeMode, &ok)
+	changed(prev.PoolDelay, next.PoolDelay, &su.PoolDelay, &ok)
+	changed(prev.SpaDelay, next.SpaDelay, &su.SpaDelay, &ok)
+	changed(prev.CleanerDelay, next.CleanerDelay, &su.CleanerDelay, &ok)
+	changed(prev.AirTemp, next.AirTemp, &su.AirTemp, &ok)
+	for _, b := range next.Bodies {
+		pb, _ := prev.Body(b.Type)
+		if bu, bok := diffBody(pb, b); bok {
+			su.Bodies = append(su.Bodies, bu)
+			ok = true
+		}
+	}
+	circuits := make(map[int]protocol.CircuitStatus, len(prev.Circuits))
+	for _, c := range prev.Circuits {
+		circuits[c.ID] = c
+	}
+	for _, c := range next.Circuits {
+		if pc, present := circuits[c.ID]; !present || pc != c {
+			su.Circuits = append(su.Circuits, c)
+			ok = true
+		}
+	}
+	changed(prev.PH, next.PH, &su.PH, &ok)
+	changed(prev.ORP, next.ORP, &su.ORP, &ok)
+	changed(prev.Saturation, next.Saturation, &su.Saturation, &ok)
+	changed(prev.SaltPPM, next.SaltPPM, &su.SaltPPM, &ok)
+	changed(prev.PHTank, next.PHTank, &su.PHTank, &ok)
+	changed(prev.ORPTank, next.ORPTank, &su.ORPTank, &ok)
+	changed(prev.Alert, next.Alert, &su.Alert, &ok)
+	return su, ok
+}
+
+// Apply returns the result of applying the update to st, ie. for
+// su, _ := NewStatusUpdate(prev, next), su.Apply(prev) is equivalent
+// to next.
+func (su StatusUpdate) Apply(st protocol.ControllerStatus) protocol.ControllerStatus {
+	set(&st.State, su.State)
+	set(&st.FreezeMode, su.FreezeMode)
+	set(&st.PoolDelay, su.PoolDelay)
+	set(&st.SpaDelay, su.SpaDelay)
+	set(&st.CleanerDelay, su.CleanerDelay)
+	set(&st.AirTemp, su.AirTemp)
+	if len(su.Bodies) > 0 {
+		st.Bodies = append([]protocol.BodyStatus(nil), st.Bodies...)
+	}
+	for _, bu := range su.Bodies {
+		idx := -1
+		for i, b := range st.Bodies {
+			if b.Type == bu.Type {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			st.Bodies = append(st.Bodies, protocol.BodyStatus{Type: bu.Type})
+			idx = len(st.Bodies) - 1
+		}
+		b := &st.Bodies[idx]
+		set(&b.CurrentTemp, bu.CurrentTemp)
+		set(&b.HeatStatus, bu.HeatStatus)
+		set(&b.HeatSetPoint, bu.HeatSetPoint)
+		set(&b.CoolSetPoint, bu.CoolSetPoint)
+		set(&b.HeatMode, bu.HeatMode)
+	}
+	if len(su.Circuits) > 0 {
+		st.Circuits = append([]protocol.CircuitStatus(nil), st.Circuits...)
+	}
+	for _, cu := range su.Circuits {
+		found := false
+		for i, c := range st.Circuits {
+			if c.ID == cu.ID {
+				st.Circuits[i] = cu
+				found = true
+			}
+		}
+		if !found {
+			st.Circuits = append(st.Circuits, cu)
+		}
+	}
+	set(&st.PH, su.PH)
+	set(&st.ORP, su.ORP)
+	set(&st.Saturation, su.Saturation)
+	set(&st.SaltPPM, su.SaltPPM)
+	set(&st.PHTank, su.PHTank)
+	set(&st.ORPTank, su.ORPTank)
+	set(&st.Alert, su.Alert)
+	return st
+}
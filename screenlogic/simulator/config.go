@@ -0,0 +1,290 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// CircuitConfig represents the configuration of a simulated circuit.
+// Function and Interface are specified using the names returned by
+// protocol.CircuitFunction.String and protocol.CircuitInterface.String.
+type CircuitConfig struct {
+	ID        int    `yaml:"id"`
+	Name      string `yaml:"name"`
+	Function  string `yaml:"function"`
+	Interface string `yaml:"interface"`
+	State     bool   `yaml:"state"`
+}
+
+// BodyConfig represents the configuration of a simulated body of water.
+type BodyConfig struct {
+	Type         string `yaml:"type"` // pool or spa
+	Temp         int    `yaml:"temp"`
+	HeatSetPoint int    `yaml:"heat_set_point"`
+	CoolSetPoint int    `yaml:"cool_set_point"`
+	HeatMode     string `yaml:"heat_mode"`
+}
+
+// PumpConfig represents the configuration of a simulated IntelliFlo pump,
+// the pump is reported as running if Watts is non-zero.
+type PumpConfig struct {
+	Index int   `yaml:"index"` // 0-7
+	Value uint8 `yaml:"value"`
+	Watts int   `yaml:"watts"`
+	RPM   int   `yaml:"rpm"`
+	GPM   int   `yaml:"gpm"`
+}
+
+// ChemistryConfig represents the simulated water chemistry.
+type ChemistryConfig struct {
+	PH         float64 `yaml:"ph"`
+	ORP        int     `yaml:"orp"`
+	Saturation float64 `yaml:"saturation"`
+	SaltPPM    int     `yaml:"salt_ppm"`
+}
+
+// ScheduleConfig represents a simulated scheduled event. Start and
+// Stop are specified as HH:MM and Days as a comma separated list of
+// day names, eg. Mon,Wed,Fri, or daily.
+type ScheduleConfig struct {
+	ID           int    `yaml:"id"`
+	Circuit      int    `yaml:"circuit"`
+	Start        string `yaml:"start"`
+	Stop         string `yaml:"stop"`
+	Days         string `yaml:"days"`
+	RunOnce      bool   `yaml:"run_once"`
+	HeatSetPoint int    `yaml:"heat_set_point"`
+}
+
+// Config represents the configuration of a simulated gateway.
+type Config struct {
+	// Name is the name returned in response to discovery requests.
+	Name         string           `yaml:"name"`
+	Version      string           `yaml:"version"`
+	Model        string           `yaml:"model"`
+	ControllerID int              `yaml:"controller_id"`
+	Celsius      bool             `yaml:"celsius"`
+	AirTemp      int              `yaml:"air_temp"`
+	Circuits     []CircuitConfig  `yaml:"circuits"`
+	Bodies       []BodyConfig     `yaml:"bodies"`
+	Pumps        []PumpConfig     `yaml:"pumps"`
+	Chemistry    ChemistryConfig  `yaml:"chemistry"`
+	Schedules    []ScheduleConfig `yaml:"schedules"`
+	// PushInterval, if non-zero, is the interval at which status updates
+	// are pushed to clients that have registered for them, in addition
+	// to those pushed whenever the status changes.
+	PushInterval time.Duration `yaml:"push_interval"`
+}
+
+// DefaultConfig returns a configuration for a typical pool and spa
+// installation.
+func DefaultConfig() Config {
+	return Config{
+		Name:         "Pentair: 00-00-01",
+		Version:      "POOL: 5.2 Build 736.0 Rel",
+		Model:        "EasyTouch2 8",
+		ControllerID: 100,
+		AirTemp:      72,
+		Circuits: []CircuitConfig{
+			{ID: 500, Name: "Spa", Function: "Spa", Interface: "Spa"},
+			{ID: 501, Name: "Cleaner", Function: "Cleaner", Interface: "Pool"},
+			{ID: 502, Name: "Pool Light", Function: "IntelliBrite", Interface: "Lights"},
+			{ID: 503, Name: "Spa Light", Function: "IntelliBrite", Interface: "Lights"},
+			{ID: 504, Name: "Waterfall", Function: "Generic", Interface: "Features"},
+			{ID: 505, Name: "Pool", Function: "Pool", Interface: "Pool", State: true},
+		},
+		Bodies: []BodyConfig{
+			{Type: "pool", Temp: 78, HeatSetPoint: 82, CoolSetPoint: 90, HeatMode: "heater"},
+			{Type: "spa", Temp: 80, HeatSetPoint: 100, CoolSetPoint: 104, HeatMode: "off"},
+		},
+		Pumps: []PumpConfig{{Index: 0, Value: 1, Watts: 850, RPM: 2450, GPM: 45}},
+		Schedules: []ScheduleConfig{
+			{ID: 700, Circuit: 505, Start: "08:00", Stop: "16:00", Days: "daily"},
+			{ID: 701, Circuit: 501, Start: "10:00", Stop: "12:00", Days: "Mon,Wed,Fri"},
+		},
+		Chemistry: ChemistryConfig{
+			PH:         7.4,
+			ORP:        650,
+			Saturation: 0.1,
+			SaltPPM:    3200,
+		},
+	}
+}
+
+// ParseConfig parses a YAML configuration. Fields that are not specified
+// are left at their zero values.
+func ParseConfig(buf []byte) (Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(buf, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// ReadConfig reads a YAML configuration from the specified file.
+func ReadConfig(filename string) (Config, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := ParseConfig(buf)
+	if err != nil {
+		return Config{}, fmt.Errorf("%v: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// controllerState returns the controller config and initial status
+// described by cfg.
+func (cfg Config) controllerState() (protocol.ControllerConfig, protocol.ControllerStatus, error) {
+	if _, _, err := protocol.EncodeControllerHardware(cfg.Model); err != nil {
+		return protocol.ControllerConfig{}, protocol.ControllerStatus{}, err
+	}
+	ccfg := protocol.ControllerConfig{
+		Model:   cfg.Model,
+		ID:      cfg.ControllerID,
+		Celsius: cfg.Celsius,
+	}
+	status := protocol.ControllerStatus{
+		State:      protocol.ControllerReady,
+		AirTemp:    cfg.AirTemp,
+		PH:         cfg.Chemistry.PH,
+		ORP:        cfg.Chemistry.ORP,
+		Saturation: cfg.Chemistry.Saturation,
+		SaltPPM:    cfg.Chemistry.SaltPPM,
+	}
+	if cfg.Chemistry != (ChemistryConfig{}) {
+		ccfg.Equipment |= protocol.IntelliChem
+	}
+	ids := map[int]bool{}
+	for i, c := range cfg.Circuits {
+		if ids[c.ID] {
+			return ccfg, status, fmt.Errorf("circuit %v: duplicate id", c.ID)
+		}
+		ids[c.ID] = true
+		fn, err := protocol.ParseCircuitFunction(c.Function)
+		if err != nil {
+			return ccfg, status, fmt.Errorf("circuit %v: %w", c.ID, err)
+		}
+		ifc, err := protocol.ParseCircuitInterface(c.Interface)
+		if err != nil {
+			return ccfg, status, fmt.Errorf("circuit %v: %w", c.ID, err)
+		}
+		ccfg.Circuits = append(ccfg.Circuits, protocol.Circuit{
+			ID:        c.ID,
+			Name:      c.Name,
+			Function:  fn,
+			Interface: ifc,
+			Index:     uint8(i), //nolint:gosec // circuit index.
+		})
+		status.Circuits = append(status.Circuits, protocol.CircuitStatus{ID: c.ID, State: c.State})
+	}
+	for _, b := range cfg.Bodies {
+		bt, err := protocol.ParseBodyType(b.Type)
+		if err != nil {
+			return ccfg, status, err
+		}
+		hm := protocol.HeatModeOff
+		if len(b.HeatMode) > 0 {
+			if hm, err = protocol.ParseHeatMode(b.HeatMode); err != nil {
+				return ccfg, status, fmt.Errorf("body %v: %w", bt, err)
+			}
+		}
+		status.Bodies = append(status.Bodies, protocol.BodyStatus{
+			Type:         bt,
+			CurrentTemp:  b.Temp,
+			HeatSetPoint: b.HeatSetPoint,
+			CoolSetPoint: b.CoolSetPoint,
+			HeatMode:     hm,
+			HeatStatus:   heatStatus(hm, b.Temp, b.HeatSetPoint),
+		})
+	}
+	pumps := map[int]uint8{}
+	for _, p := range cfg.Pumps {
+		if p.Index < 0 || p.Index > 7 {
+			return ccfg, status, fmt.Errorf("pump index %v out of range", p.Index)
+		}
+		pumps[p.Index] = p.Value
+	}
+	for i := range 8 {
+		if v, ok := pumps[i]; ok {
+			ccfg.Equipment |= protocol.IntelliFlo0 << i
+			ccfg.IntelliFlo = append(ccfg.IntelliFlo, protocol.IntelliFlo{Index: i, Value: v})
+		}
+	}
+	return ccfg, status, nil
+}
+
+// heatStatus returns the heat status implied by the heat mode and the
+// current and desired temperatures.
+func heatStatus(hm protocol.HeatMode, temp, setPoint int) protocol.HeatStatus {
+	if temp >= setPoint {
+		return protocol.HeatStatusOff
+	}
+	switch hm {
+	case protocol.HeatModeSolar, protocol.HeatModeSolarPreferred:
+		return protocol.HeatStatusSolar
+	case protocol.HeatModeHeater:
+		return protocol.HeatStatusHeater
+	}
+	return protocol.HeatStatusOff
+}
+
+func parseTimeOfDay(tod string) (time.Duration, error) {
+	t, err := time.Parse("15:04", tod)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// schedules returns the recurring and run once schedules described
+// by cfg.
+func (cfg Config) schedules() (recurring, runOnce []protocol.Schedule, err error) {
+	for _, sc := range cfg.Schedules {
+		s := protocol.Schedule{
+			ID:           sc.ID,
+			CircuitID:    sc.Circuit,
+			HeatSetPoint: sc.HeatSetPoint,
+		}
+		if s.Start, err = parseTimeOfDay(sc.Start); err != nil {
+			return nil, nil, fmt.Errorf("schedule %v: %w", sc.ID, err)
+		}
+		if s.Stop, err = parseTimeOfDay(sc.Stop); err != nil {
+			return nil, nil, fmt.Errorf("schedule %v: %w", sc.ID, err)
+		}
+		if s.Days, err = protocol.ParseDayMask(sc.Days); err != nil {
+			return nil, nil, fmt.Errorf("schedule %v: %w", sc.ID, err)
+		}
+		if sc.RunOnce {
+			runOnce = append(runOnce, s)
+		} else {
+			recurring = append(recurring, s)
+		}
+	}
+	return
+}
+
+// pumps returns the status of each of the pumps described by cfg,
+// indexed by the pump's index.
+func (cfg Config) pumps() map[int]protocol.PumpStatus {
+	pumps := map[int]protocol.PumpStatus{}
+	for _, p := range cfg.Pumps {
+		pumps[p.Index] = protocol.PumpStatus{
+			Type:    int(p.Value),
+			Running: p.Watts > 0,
+			Watts:   p.Watts,
+			RPM:     p.RPM,
+			GPM:     p.GPM,
+		}
+	}
+	return pumps
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+// ListenAndServeDiscovery listens on the specified UDP address and then
+// calls ServeDiscovery.
+func (g *Gateway) ListenAndServeDiscovery(ctx context.Context, addr string, gwAddr netip.AddrPort) error {
+	pc, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	return g.ServeDiscovery(ctx, pc, gwAddr)
+}
+
+// ServeDiscovery responds to discovery requests received on pc with
+// the gateway's name and its TCP address, gwAddr, until the context is
+// canceled, in which case it returns nil, or pc returns an error. pc is
+// closed when ServeDiscovery returns.
+func (g *Gateway) ServeDiscovery(ctx context.Context, pc net.PacketConn, gwAddr netip.AddrPort) error {
+	sctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		pc.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		<-sctx.Done()
+		pc.Close()
+	}()
+	resp := slnet.EncodeDiscoveryResponse(slnet.Gateway{
+		Addr: gwAddr,
+		Type: 2,
+		Name: g.cfg.Name,
+	})
+	ctxlog.Info(ctx, "screenlogic: simulator: discovery listening", "addr", pc.LocalAddr().String())
+	buf := make([]byte, 64)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !slnet.IsDiscoveryRequest(buf[:n]) {
+			ctxlog.Debug(ctx, "screenlogic: simulator: ignoring discovery packet", "from", from.String(), "size", n)
+			continue
+		}
+		ctxlog.Debug(ctx, "screenlogic: simulator: discovery request", "from", from.String())
+		if _, err := pc.WriteTo(resp, from); err != nil {
+			ctxlog.Warn(ctx, "screenlogic: simulator: discovery response failed", "from", from.String(), "err", err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+	"gopkg.in/yaml.v3"
+)
+
+// Fault describes a fault to be injected into the replies to requests.
+// The first fault, in the order in which they were injected, that
+// matches a request is applied to its reply. All of the specified
+// behaviours are applied, in the order in which they are listed below,
+// except that only the first of Drop, Truncate, Reset and Split
+// is applied.
+type Fault struct {
+	// Request is the name (eg. GetStatus) or number of the request
+	// code that the fault applies to, an empty string matches all
+	// requests.
+	Request string `yaml:"request"`
+	// After is the number of matching requests to ignore before the
+	// fault is applied.
+	After int `yaml:"after"`
+	// Count is the number of matching requests that the fault is applied
+	// to, zero means all subsequent matching requests.
+	Count int `yaml:"count"`
+
+	// Reply, if set, is the name or number of the message code to reply
+	// with, with an empty payload, instead of handling the request,
+	// eg. BadParameter.
+	Reply string `yaml:"reply"`
+	// Delay delays the reply.
+	Delay time.Duration `yaml:"delay"`
+	// Push is the number of status updates to push before the reply.
+	Push int `yaml:"push"`
+	// WrongID replies with a message ID that differs from the request's.
+	WrongID bool `yaml:"wrong_id"`
+	// Short is the number of bytes to remove from the end of the reply's
+	// payload, the message size is adjusted to match.
+	Short int `yaml:"short"`
+	// Drop discards the reply.
+	Drop bool `yaml:"drop"`
+	// Truncate writes only this many bytes of the reply and then closes
+	// the connection.
+	Truncate int `yaml:"truncate"`
+	// Reset resets the connection instead of replying.
+	Reset bool `yaml:"reset"`
+	// Split writes the reply in pieces of this many bytes, separated
+	// by SplitDelay.
+	Split      int           `yaml:"split"`
+	SplitDelay time.Duration `yaml:"split_delay"`
+}
+
+// Scenario represents a set of faults to be injected.
+type Scenario struct {
+	Faults []Fault `yaml:"faults"`
+}
+
+// ParseScenario parses a YAML scenario.
+func ParseScenario(buf []byte) (Scenario, error) {
+	var sc Scenario
+	if err := yaml.Unmarshal(buf, &sc); err != nil {
+		return Scenario{}, err
+	}
+	return sc, nil
+}
+
+// ReadScenario reads a YAML scenario from the specified file.
+func ReadScenario(filename string) (Scenario, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return Scenario{}, err
+	}
+	sc, err := ParseScenario(buf)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("%v: %w", filename, err)
+	}
+	return sc, nil
+}
+
+// errTruncated and errReset are returned by conn.serve when
+// a connection is closed by a fault.
+var (
+	errTruncated = errors.New("connection closed after a truncated reply")
+	errReset     = errors.New("connection reset by fault")
+)
+
+// fault is an injected Fault and its state.
+type fault struct {
+	Fault
+	code    protocol.MsgCode // zero if all requests match.
+	reply   protocol.MsgCode
+	seen    int
+	applied int
+}
+
+// parseMsgCode parses a message code specified as either a number or
+// the name of a known message.
+func parseMsgCode(name string) (protocol.MsgCode, error) {
+	if n, err := strconv.ParseUint(name, 10, 16); err == nil {
+		return protocol.MsgCode(n), nil
+	}
+	for _, info := range protocol.KnownMsgs() {
+		if strings.EqualFold(info.Name, name) {
+			return info.Code, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown message code: %q", name)
+}
+
+// Inject adds the supplied faults to those already injected.
+func (g *Gateway) Inject(faults ...Fault) error {
+	var parsed []*fault
+	for _, f := range faults {
+		pf := &fault{Fault: f}
+		var err error
+		if len(f.Request) > 0 {
+			if pf.code, err = parseMsgCode(f.Request); err != nil {
+				return fmt.Errorf("request: %w", err)
+			}
+		}
+		if len(f.Reply) > 0 {
+			if pf.reply, err = parseMsgCode(f.Reply); err != nil {
+				return fmt.Errorf("reply: %w", err)
+			}
+		}
+		parsed = append(parsed, pf)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.faults = append(g.faults, parsed...)
+	return nil
+}
+
+// ClearFaults removes all injected faults.
+func (g *Gateway) ClearFaults() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.faults = nil
+}
+
+// fault returns a copy of the first fault to be applied to a request
+// with the specified code, if any.
+func (g *Gateway) fault(code protocol.MsgCode) (fault, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, f := range g.faults {
+		if f.code != 0 && f.code != code {
+			continue
+		}
+		f.seen++
+		if f.seen <= f.After || (f.Count > 0 && f.applied >= f.Count) {
+			continue
+		}
+		f.applied++
+		return *f, true
+	}
+	return fault{}, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// writeFaulty writes m subject to the supplied fault.
+func (c *conn) writeFaulty(ctx context.Context, m protocol.Message, f fault) error {
+	if err := sleep(ctx, f.Delay); err != nil {
+		return err
+	}
+	if f.Push > 0 {
+		push, err := c.g.statusMessage()
+		if err != nil {
+			return err
+		}
+		for range f.Push {
+			if err := c.write(push); err != nil {
+				return err
+			}
+		}
+	}
+	if f.WrongID {
+		m.SetID(m.ID() + 1)
+	}
+	if f.Short > 0 {
+		n := max(0, len(m.Payload())-f.Short)
+		m = m[:slnet.MessageHeaderSize+n]
+		m.SetSize(uint32(n)) //nolint:gosec // n is bounded by the payload size.
+	}
+	switch {
+	case f.Drop:
+		return nil
+	case f.Truncate > 0:
+		if err := c.write(m[:min(f.Truncate, len(m))]); err != nil {
+			return err
+		}
+		return errTruncated
+	case f.Reset:
+		if tc, ok := c.nc.(*net.TCPConn); ok {
+			// Send a RST rather than a FIN.
+			tc.SetLinger(0) //nolint:errcheck // best effort.
+		}
+		return errReset
+	case f.Split > 0:
+		c.wmu.Lock()
+		defer c.wmu.Unlock()
+		for len(m) > 0 {
+			n := min(f.Split, len(m))
+			if _, err := c.nc.Write(m[:n]); err != nil {
+				return err
+			}
+			m = m[n:]
+			if len(m) > 0 {
+				if err := sleep(ctx, f.SplitDelay); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return c.write(m)
+}
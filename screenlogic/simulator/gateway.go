@@ -0,0 +1,509 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package simulator provides a simulated screenlogic gateway that
+// implements enough of the protocol, over TCP, to be used for testing
+// and demonstrations. Its configuration and state (circuits, bodies,
+// pumps and water chemistry) are kept in memory and button presses
+// are applied to that state. Faults, such as delayed, split or
+// truncated replies, may be injected to exercise error handling.
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+// maxRequestSize is the largest request payload that will be accepted.
+const maxRequestSize = 1 << 16
+
+// ErrBadConnectString is returned when a client does not start a
+// connection with protocol.ConnectString.
+var ErrBadConnectString = errors.New("bad connect string")
+
+// Gateway represents a simulated screenlogic gateway.
+type Gateway struct {
+	cfg Config
+	now func() time.Time
+
+	mu          sync.Mutex
+	config      protocol.ControllerConfig
+	status      protocol.ControllerStatus
+	conns       map[*conn]struct{}
+	connections int
+	faults      []*fault
+	schedules   map[protocol.ScheduleType][]protocol.Schedule
+	pumps       map[int]protocol.PumpStatus
+	lightMode   protocol.ColorMode
+}
+
+// New returns a new Gateway for the supplied configuration.
+func New(cfg Config) (*Gateway, error) {
+	ccfg, status, err := cfg.controllerState()
+	if err != nil {
+		return nil, fmt.Errorf("simulator: %w", err)
+	}
+	recurring, runOnce, err := cfg.schedules()
+	if err != nil {
+		return nil, fmt.Errorf("simulator: %w", err)
+	}
+	return &Gateway{
+		cfg:    cfg,
+		now:    time.Now,
+		config: ccfg,
+		status: status,
+		conns:  map[*conn]struct{}{},
+		schedules: map[protocol.ScheduleType][]protocol.Schedule{
+			protocol.ScheduleRecurring: recurring,
+			protocol.ScheduleRunOnce:   runOnce,
+		},
+		pumps: cfg.pumps(),
+	}, nil
+}
+
+// Config returns the gateway's controller configuration.
+func (g *Gateway) Config() protocol.ControllerConfig {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cfg := g.config
+	cfg.Circuits = slices.Clone(cfg.Circuits)
+	cfg.IntelliFlo = slices.Clone(cfg.IntelliFlo)
+	return cfg
+}
+
+// Connections returns the number of connections accepted so far.
+func (g *Gateway) Connections() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.connections
+}
+
+// Status returns the gateway's current status.
+func (g *Gateway) Status() protocol.ControllerStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.statusLocked()
+}
+
+func (g *Gateway) statusLocked() protocol.ControllerStatus {
+	st := g.status
+	st.Bodies = slices.Clone(st.Bodies)
+	st.Circuits = slices.Clone(st.Circuits)
+	return st
+}
+
+// SetCircuit sets the state of the specified circuit as if a button
+// press had been received.
+func (g *Gateway) SetCircuit(id int, state bool) error {
+	g.mu.Lock()
+	err := g.setCircuitLocked(id, state)
+	g.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	g.pushStatus()
+	return nil
+}
+
+func (g *Gateway) setCircuitLocked(id int, state bool) error {
+	for i, c := range g.status.Circuits {
+		if c.ID == id {
+			g.status.Circuits[i].State = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown circuit: %v: %w", id, protocol.ErrBadParameter)
+}
+
+// SetPump sets the status of the specified pump.
+func (g *Gateway) SetPump(index int, ps protocol.PumpStatus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pumps[index] = ps
+}
+
+// LightMode returns the most recent light command received.
+func (g *Gateway) LightMode() protocol.ColorMode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lightMode
+}
+
+func (g *Gateway) bodyLocked(bt protocol.BodyType) (*protocol.BodyStatus, error) {
+	for i := range g.status.Bodies {
+		if g.status.Bodies[i].Type == bt {
+			return &g.status.Bodies[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown body: %v: %w", bt, protocol.ErrBadParameter)
+}
+
+func (g *Gateway) setHeatSetPointLocked(bt protocol.BodyType, temp int) error {
+	body, err := g.bodyLocked(bt)
+	if err != nil {
+		return err
+	}
+	body.HeatSetPoint = temp
+	body.HeatStatus = heatStatus(body.HeatMode, body.CurrentTemp, body.HeatSetPoint)
+	return nil
+}
+
+func (g *Gateway) setHeatModeLocked(bt protocol.BodyType, mode protocol.HeatMode) error {
+	body, err := g.bodyLocked(bt)
+	if err != nil {
+		return err
+	}
+	switch {
+	case mode == protocol.HeatModeUnchanged:
+		return nil
+	case mode < protocol.HeatModeOff || mode > protocol.HeatModeUnchanged:
+		return fmt.Errorf("invalid heat mode: %v: %w", int(mode), protocol.ErrBadParameter)
+	}
+	body.HeatMode = mode
+	body.HeatStatus = heatStatus(body.HeatMode, body.CurrentTemp, body.HeatSetPoint)
+	return nil
+}
+
+// lightCommandLocked records the light command and turns all of the
+// lights on or off for the AllOn and AllOff commands.
+func (g *Gateway) lightCommandLocked(mode protocol.ColorMode) error {
+	if mode < protocol.ColorAllOff || mode > protocol.ColorHold {
+		return fmt.Errorf("invalid light command: %v: %w", int(mode), protocol.ErrBadParameter)
+	}
+	g.lightMode = mode
+	if mode != protocol.ColorAllOff && mode != protocol.ColorAllOn {
+		return nil
+	}
+	for _, c := range g.config.Circuits {
+		if c.Interface == protocol.InterfaceLights {
+			_ = g.setCircuitLocked(c.ID, mode == protocol.ColorAllOn)
+		}
+	}
+	return nil
+}
+
+// UpdateStatus calls fn to modify the gateway's status, for example to
+// simulate a change in temperature, and then pushes the new status to
+// all clients that have registered for updates.
+func (g *Gateway) UpdateStatus(fn func(*protocol.ControllerStatus)) {
+	g.mu.Lock()
+	fn(&g.status)
+	g.mu.Unlock()
+	g.pushStatus()
+}
+
+// ListenAndServe listens on the specified TCP address and then calls
+// Serve.
+func (g *Gateway) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(ctx, ln)
+}
+
+// Serve accepts and serves connections on ln until the context is
+// canceled, in which case it returns nil, or ln returns an error. The
+// listener and all connections are closed when Serve returns.
+func (g *Gateway) Serve(ctx context.Context, ln net.Listener) error {
+	sctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		ln.Close()
+		g.closeAll()
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-sctx.Done()
+		ln.Close()
+	}()
+	if g.cfg.PushInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.pushPeriodically(sctx, g.cfg.PushInterval)
+		}()
+	}
+	ctxlog.Info(ctx, "screenlogic: simulator: listening", "addr", ln.Addr().String())
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		c := g.newConn(nc)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer g.closeConn(c)
+			err := c.serve(sctx)
+			ctxlog.Info(ctx, "screenlogic: simulator: connection closed", "remote", nc.RemoteAddr().String(), "err", err)
+		}()
+	}
+}
+
+func (g *Gateway) newConn(nc net.Conn) *conn {
+	c := &conn{g: g, nc: nc}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.conns[c] = struct{}{}
+	g.connections++
+	return c
+}
+
+func (g *Gateway) closeConn(c *conn) {
+	g.mu.Lock()
+	delete(g.conns, c)
+	g.mu.Unlock()
+	c.nc.Close()
+}
+
+func (g *Gateway) closeAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for c := range g.conns {
+		c.nc.Close()
+	}
+}
+
+func (g *Gateway) pushPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.pushStatus()
+		}
+	}
+}
+
+// statusMessage returns a MsgStatusChanged message for the current status.
+func (g *Gateway) statusMessage() (protocol.Message, error) {
+	payload, err := protocol.EncodeControllerStatus(g.Status())
+	if err != nil {
+		return nil, err
+	}
+	return protocol.NewMessage(0, protocol.MsgStatusChanged, payload), nil
+}
+
+// pushStatus sends the current status to all clients that have
+// registered for updates.
+func (g *Gateway) pushStatus() {
+	msg, err := g.statusMessage()
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	var clients []*conn
+	for c := range g.conns {
+		if c.pushes {
+			clients = append(clients, c)
+		}
+	}
+	g.mu.Unlock()
+	for _, c := range clients {
+		c.write(msg) //nolint:errcheck // the read loop will notice a failed connection.
+	}
+}
+
+// conn represents a single client connection.
+type conn struct {
+	g        *Gateway
+	nc       net.Conn
+	wmu      sync.Mutex // serializes responses and pushed messages.
+	loggedIn bool
+	pushes   bool // guarded by g.mu
+}
+
+func (c *conn) write(m protocol.Message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.nc.Write(m)
+	return err
+}
+
+func (c *conn) serve(ctx context.Context) error {
+	connect := make([]byte, len(protocol.ConnectString))
+	if _, err := io.ReadFull(c.nc, connect); err != nil {
+		return err
+	}
+	if string(connect) != protocol.ConnectString {
+		return fmt.Errorf("%q: %w", connect, ErrBadConnectString)
+	}
+	for {
+		m, err := readMessage(c.nc)
+		if err != nil {
+			return err
+		}
+		ctxlog.Debug(ctx, "screenlogic: simulator: received", "id", m.ID(), "code", m.Code().String(), "size", m.Size())
+		f, faulty := c.g.fault(m.Code())
+		var resp protocol.Message
+		var changed bool
+		if faulty && f.reply != 0 {
+			resp = protocol.NewMessage(m.ID(), f.reply, nil)
+		} else {
+			resp, changed = c.g.handle(c, m)
+		}
+		if faulty {
+			err = c.writeFaulty(ctx, resp, f)
+		} else {
+			err = c.write(resp)
+		}
+		if err != nil {
+			return err
+		}
+		if changed {
+			c.g.pushStatus()
+		}
+	}
+}
+
+func readMessage(rd io.Reader) (protocol.Message, error) {
+	hdr := make([]byte, slnet.MessageHeaderSize)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return nil, err
+	}
+	size := slnet.MessageHeader(hdr).Size()
+	if size > maxRequestSize {
+		return nil, fmt.Errorf("request too large: %v", size)
+	}
+	m := make(protocol.Message, slnet.MessageHeaderSize+int(size))
+	copy(m, hdr)
+	if _, err := io.ReadFull(rd, m.Payload()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func reply(m protocol.Message, payload []byte) protocol.Message {
+	return protocol.NewMessage(m.ID(), m.Code().Response(), payload)
+}
+
+func replyError(m protocol.Message, code protocol.MsgCode) protocol.Message {
+	return protocol.NewMessage(m.ID(), code, nil)
+}
+
+// handle returns the response to the supplied request and whether the
+// request changed the gateway's status.
+func (g *Gateway) handle(c *conn, m protocol.Message) (protocol.Message, bool) {
+	code := m.Code()
+	if !c.loggedIn && code != protocol.MsgLocalLogin && code != protocol.MsgChallenge {
+		return replyError(m, protocol.MsgBadLogin), false
+	}
+	switch code {
+	case protocol.MsgChallenge:
+		return reply(m, protocol.EncodeVersion("00-60-6E-00-00-01")), false
+	case protocol.MsgLocalLogin:
+		c.loggedIn = true
+		return reply(m, nil), false
+	case protocol.MsgPing:
+		return reply(m, nil), false
+	case protocol.MsgGetVersion:
+		return reply(m, protocol.EncodeVersion(g.cfg.Version)), false
+	case protocol.MsgGetDateTime:
+		return reply(m, protocol.EncodeDateTime(g.now())), false
+	case protocol.MsgGetConfig:
+		payload, err := protocol.EncodeControllerConfig(g.Config())
+		if err != nil {
+			return replyError(m, protocol.MsgInvalidRequest), false
+		}
+		return reply(m, payload), false
+	case protocol.MsgGetStatus:
+		payload, err := protocol.EncodeControllerStatus(g.Status())
+		if err != nil {
+			return replyError(m, protocol.MsgInvalidRequest), false
+		}
+		return reply(m, payload), false
+	case protocol.MsgButtonPress:
+		var req protocol.ButtonPress
+		return g.update(m, &req, func() error {
+			return g.setCircuitLocked(req.CircuitID, req.State)
+		})
+	case protocol.MsgSetHeatSetPoint:
+		var req protocol.HeatSetPoint
+		return g.update(m, &req, func() error {
+			return g.setHeatSetPointLocked(req.Body, req.Temperature)
+		})
+	case protocol.MsgSetHeatMode:
+		var req protocol.HeatModeRequest
+		return g.update(m, &req, func() error {
+			return g.setHeatModeLocked(req.Body, req.Mode)
+		})
+	case protocol.MsgLightCommand:
+		var req protocol.LightCommand
+		return g.update(m, &req, func() error {
+			return g.lightCommandLocked(req.Mode)
+		})
+	case protocol.MsgGetSchedules:
+		var req protocol.ScheduleRequest
+		if err := protocol.Unmarshal(m.Payload(), &req); err != nil {
+			return replyError(m, protocol.MsgBadParameter), false
+		}
+		g.mu.Lock()
+		schedules, ok := g.schedules[req.Type]
+		g.mu.Unlock()
+		if !ok {
+			return replyError(m, protocol.MsgBadParameter), false
+		}
+		payload, err := protocol.EncodeSchedules(schedules)
+		if err != nil {
+			return replyError(m, protocol.MsgInvalidRequest), false
+		}
+		return reply(m, payload), false
+	case protocol.MsgGetPumpStatus:
+		var req protocol.PumpStatusRequest
+		if err := protocol.Unmarshal(m.Payload(), &req); err != nil {
+			return replyError(m, protocol.MsgBadParameter), false
+		}
+		g.mu.Lock()
+		ps, ok := g.pumps[req.Pump]
+		g.mu.Unlock()
+		if !ok {
+			return replyError(m, protocol.MsgBadParameter), false
+		}
+		payload, err := protocol.EncodePumpStatus(ps)
+		if err != nil {
+			return replyError(m, protocol.MsgInvalidRequest), false
+		}
+		return reply(m, payload), false
+	case protocol.MsgAddClient, protocol.MsgRemoveClient:
+		g.mu.Lock()
+		c.pushes = code == protocol.MsgAddClient
+		g.mu.Unlock()
+		return reply(m, nil), false
+	}
+	return replyError(m, protocol.MsgInvalidRequest), false
+}
+
+// update decodes the request into req and then calls fn, with the
+// gateway's lock held, to apply it.
+func (g *Gateway) update(m protocol.Message, req any, fn func() error) (protocol.Message, bool) {
+	if err := protocol.Unmarshal(m.Payload(), req); err != nil {
+		return replyError(m, protocol.MsgBadParameter), false
+	}
+	g.mu.Lock()
+	err := fn()
+	g.mu.Unlock()
+	if err != nil {
+		return replyError(m, protocol.MsgBadParameter), false
+	}
+	return reply(m, nil), true
+}
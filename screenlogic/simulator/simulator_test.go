@@ -0,0 +1,539 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package simulator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/automation/net/streamconn"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+	"github.com/cosnicolaou/pentair/screenlogic/slnet"
+)
+
+func startGateway(t *testing.T, cfg simulator.Config) (*simulator.Gateway, string) {
+	t.Helper()
+	gw, err := simulator.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return gw, ln.Addr().String()
+}
+
+type noIdle struct{}
+
+func (noIdle) Reset(context.Context) {}
+
+func newSession(ctx context.Context, t *testing.T, addr string, timeout time.Duration) *protocol.Session {
+	t.Helper()
+	conn, err := slnet.Dial(ctx, addr, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(ctx) })
+	var mgr streamconn.SessionManager
+	return protocol.NewSession(mgr.New(conn, noIdle{}))
+}
+
+func login(ctx context.Context, t *testing.T, addr string) *protocol.Session {
+	t.Helper()
+	sess := newSession(ctx, t, addr, time.Second)
+	if err := protocol.Login(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestGateway(t *testing.T) {
+	ctx := context.Background()
+	cfg := simulator.DefaultConfig()
+	gw, addr := startGateway(t, cfg)
+	sess := login(ctx, t, addr)
+
+	version, err := protocol.GetVersionInfo(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := version, cfg.Version; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := protocol.Ping(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	when, err := protocol.GetTimeAndDate(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := when.Year(), now.Year(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	ccfg, err := protocol.GetControllerConfig(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ccfg, gw.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got, want := len(ccfg.Circuits), len(cfg.Circuits); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(ccfg.IntelliFlo), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if c := ccfg.CircuitByID(502); c.Function != protocol.CircuitIntelliBrite || c.Interface != protocol.InterfaceLights {
+		t.Errorf("unexpected circuit: %+v", c)
+	}
+
+	status, err := protocol.GetControllerStatus(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := status, gw.Status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	pool, ok := status.Body(protocol.BodyPool)
+	if !ok || pool.CurrentTemp != 78 || pool.HeatSetPoint != 82 || pool.HeatStatus != protocol.HeatStatusHeater {
+		t.Errorf("unexpected pool status: %+v, %v", pool, ok)
+	}
+	if got, want := status.PH, 7.4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := status.SaltPPM, 3200; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := protocol.SetCircuitState(ctx, sess, 500, true); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(500) {
+		t.Errorf("circuit 500 should be on")
+	}
+	status, err = protocol.GetControllerStatus(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.StatusForID(500) {
+		t.Errorf("circuit 500 should be on")
+	}
+
+	err = protocol.SetCircuitState(ctx, sess, 999, true)
+	if !errors.Is(err, protocol.ErrBadParameter) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestGatewayControl(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startGateway(t, simulator.DefaultConfig())
+	sess := login(ctx, t, addr)
+
+	if err := protocol.SetHeatSetPoint(ctx, sess, protocol.BodySpa, 102); err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.SetHeatMode(ctx, sess, protocol.BodySpa, protocol.HeatModeHeater); err != nil {
+		t.Fatal(err)
+	}
+	status, err := protocol.GetControllerStatus(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spa, _ := status.Body(protocol.BodySpa)
+	if got, want := spa, (protocol.BodyStatus{
+		Type:         protocol.BodySpa,
+		CurrentTemp:  80,
+		HeatStatus:   protocol.HeatStatusHeater,
+		HeatSetPoint: 102,
+		CoolSetPoint: 104,
+		HeatMode:     protocol.HeatModeHeater,
+	}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if err := protocol.SetHeatMode(ctx, sess, protocol.BodySpa, protocol.HeatModeUnchanged); err != nil {
+		t.Fatal(err)
+	}
+	if spa, _ := gw.Status().Body(protocol.BodySpa); spa.HeatMode != protocol.HeatModeHeater {
+		t.Errorf("heat mode should be unchanged: %v", spa.HeatMode)
+	}
+	err = protocol.SetHeatMode(ctx, sess, protocol.BodySpa, protocol.HeatMode(99))
+	if !errors.Is(err, protocol.ErrBadParameter) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+
+	if err := protocol.SendLightCommand(ctx, sess, protocol.ColorAllOn); err != nil {
+		t.Fatal(err)
+	}
+	status = gw.Status()
+	if !status.StatusForID(502) || !status.StatusForID(503) || status.StatusForID(504) {
+		t.Errorf("only the lights should be on: %+v", status.Circuits)
+	}
+	if err := protocol.SendLightCommand(ctx, sess, protocol.ColorCaribbean); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gw.LightMode(), protocol.ColorCaribbean; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	schedules, err := protocol.GetSchedules(ctx, sess, protocol.ScheduleRecurring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schedules, []protocol.Schedule{
+		{ID: 700, CircuitID: 505, Start: 8 * time.Hour, Stop: 16 * time.Hour, Days: 0x7f},
+		{ID: 701, CircuitID: 501, Start: 10 * time.Hour, Stop: 12 * time.Hour, Days: 0x15},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	schedules, err = protocol.GetSchedules(ctx, sess, protocol.ScheduleRunOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(schedules), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	ps, err := protocol.GetPumpStatus(ctx, sess, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ps, (protocol.PumpStatus{Type: 1, Running: true, Watts: 850, RPM: 2450, GPM: 45}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	_, err = protocol.GetPumpStatus(ctx, sess, 1)
+	if !errors.Is(err, protocol.ErrBadParameter) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gw, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gwAddr := netip.MustParseAddrPort("127.0.0.1:8080")
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.ServeDiscovery(ctx, pc, gwAddr)
+	}()
+	found, err := slnet.Discover(ctx, pc.LocalAddr().String(), 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := found, []slnet.Gateway{{Addr: gwAddr, Type: 2, Name: "Pentair: 00-00-01"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Errorf("serve discovery: %v", err)
+	}
+}
+
+func readMessage(t *testing.T, conn net.Conn) protocol.Message {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	hdr := make([]byte, slnet.MessageHeaderSize)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		t.Fatal(err)
+	}
+	m := make(protocol.Message, slnet.MessageHeaderSize+int(slnet.MessageHeader(hdr).Size()))
+	copy(m, hdr)
+	if _, err := io.ReadFull(conn, m.Payload()); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func writeMessage(t *testing.T, conn net.Conn, m []byte) {
+	t.Helper()
+	if _, err := conn.Write(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGatewayRaw(t *testing.T) {
+	gw, addr := startGateway(t, simulator.DefaultConfig())
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writeMessage(t, conn, []byte(protocol.ConnectString))
+
+	// Requests are rejected until logged in.
+	writeMessage(t, conn, protocol.NewEmptyMessage(1, protocol.MsgGetStatus, 4))
+	if m := readMessage(t, conn); m.Code() != protocol.MsgBadLogin || m.ID() != 1 {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+	writeMessage(t, conn, protocol.NewEmptyMessage(2, protocol.MsgLocalLogin, 0))
+	if m := readMessage(t, conn); m.Code() != protocol.MsgLocalLogin+1 || m.ID() != 2 {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+
+	// Unknown requests.
+	writeMessage(t, conn, protocol.NewEmptyMessage(3, 1234, 0))
+	if m := readMessage(t, conn); m.Code() != protocol.MsgInvalidRequest || m.ID() != 3 {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+
+	// Push updates.
+	writeMessage(t, conn, protocol.NewEmptyMessage(4, protocol.MsgAddClient, 8))
+	if m := readMessage(t, conn); m.Code() != protocol.MsgAddClient+1 || m.ID() != 4 {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+	if err := gw.SetCircuit(501, true); err != nil {
+		t.Fatal(err)
+	}
+	m := readMessage(t, conn)
+	if got, want := m.Code(), protocol.MsgStatusChanged; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	st, err := protocol.DecodeControllerStatus(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.StatusForID(501) {
+		t.Errorf("circuit 501 should be on")
+	}
+
+	// Button presses are pushed after the response.
+	bp, err := protocol.MarshalMessage(5, protocol.MsgButtonPress, protocol.ButtonPress{CircuitID: 501})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMessage(t, conn, bp)
+	if m := readMessage(t, conn); m.Code() != protocol.MsgButtonPress+1 || m.ID() != 5 {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+	if m := readMessage(t, conn); m.Code() != protocol.MsgStatusChanged {
+		t.Errorf("unexpected response: %v %v", m.Code(), m.ID())
+	}
+
+	if err := gw.SetCircuit(999, true); !errors.Is(err, protocol.ErrBadParameter) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg, err := simulator.ParseConfig([]byte(`
+version: "test"
+model: "IntelliTouch i7+3"
+circuits:
+  - id: 10
+    name: Lights
+    function: light
+    interface: lights
+bodies:
+  - type: spa
+    temp: 90
+    heat_set_point: 100
+    heat_mode: solar preferred
+pumps:
+  - index: 2
+    value: 3
+push_interval: 1s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw, err := simulator.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccfg := gw.Config()
+	if got, want := ccfg.Equipment, protocol.IntelliFlo2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if c := ccfg.CircuitByID(10); c.Function != protocol.CircuitLight {
+		t.Errorf("unexpected circuit: %+v", c)
+	}
+	spa, ok := gw.Status().Body(protocol.BodySpa)
+	if !ok || spa.HeatMode != protocol.HeatModeSolarPreferred || spa.HeatStatus != protocol.HeatStatusSolar {
+		t.Errorf("unexpected spa status: %+v, %v", spa, ok)
+	}
+
+	for _, bad := range []string{
+		"model: unknown",
+		"model: SunTouch\ncircuits: [{id: 1, function: nope, interface: pool}]",
+		"model: SunTouch\ncircuits: [{id: 1, function: pool, interface: pool}, {id: 1, function: pool, interface: pool}]",
+		"model: SunTouch\nbodies: [{type: lake}]",
+		"model: SunTouch\npumps: [{index: 8}]",
+	} {
+		cfg, err := simulator.ParseConfig([]byte(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := simulator.New(cfg); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func inject(t *testing.T, gw *simulator.Gateway, faults ...simulator.Fault) {
+	t.Helper()
+	gw.ClearFaults()
+	if err := gw.Inject(faults...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startGateway(t, simulator.DefaultConfig())
+	sess := login(ctx, t, addr)
+
+	getStatus := func() error {
+		_, err := protocol.GetControllerStatus(ctx, sess)
+		return err
+	}
+
+	// Replies that are split, delayed, preceded by pushes or that have
+	// the wrong ID are all handled.
+	for _, f := range []simulator.Fault{
+		{Request: "GetStatus", Split: 3, SplitDelay: time.Millisecond},
+		{Request: "GetStatus", Delay: 10 * time.Millisecond},
+		{Request: "GetStatus", Push: 2},
+		{Request: "GetStatus", WrongID: true},
+	} {
+		inject(t, gw, f)
+		if err := getStatus(); err != nil {
+			t.Errorf("%+v: %v", f, err)
+		}
+	}
+
+	inject(t, gw, simulator.Fault{Request: "GetStatus", Push: 3})
+	if err := getStatus(); !errors.Is(err, protocol.ErrNoValidResponse) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	// Consume the reply that followed the pushes.
+	if _, err := sess.ReadUntil(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	inject(t, gw, simulator.Fault{Request: "GetStatus", Short: 4})
+	if err := getStatus(); !errors.Is(err, protocol.ErrInvalidResponse) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+
+	inject(t, gw, simulator.Fault{Request: "ButtonPress", Reply: "BadParameter"})
+	err := protocol.SetCircuitState(ctx, sess, 500, true)
+	if !errors.Is(err, protocol.ErrBadParameter) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if gw.Status().StatusForID(500) {
+		t.Errorf("circuit 500 should be off")
+	}
+
+	// After and Count.
+	inject(t, gw, simulator.Fault{Request: "12526", After: 1, Count: 1, Reply: "InvalidRequest"})
+	for i, want := range []error{nil, protocol.ErrInvalidRequest, nil} {
+		if err := getStatus(); !errors.Is(err, want) {
+			t.Errorf("%v: got %v, want %v", i, err, want)
+		}
+	}
+	gw.ClearFaults()
+
+	// Dropped replies.
+	sess = newSession(ctx, t, addr, 100*time.Millisecond)
+	if err := protocol.Login(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+	inject(t, gw, simulator.Fault{Request: "GetVersion", Drop: true})
+	if _, err := protocol.GetVersionInfo(ctx, sess); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+
+	// Unexpected login responses.
+	inject(t, gw, simulator.Fault{Request: "LocalLogin", Reply: "GetVersionResponse"})
+	sess = newSession(ctx, t, addr, time.Second)
+	if err := protocol.Login(ctx, sess); !errors.Is(err, protocol.ErrUnexpectedResponseCode) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+
+	// Truncated frames and resets.
+	for _, f := range []simulator.Fault{
+		{Request: "GetConfig", Truncate: 4},
+		{Request: "GetConfig", Truncate: 12},
+		{Request: "GetConfig", Reset: true},
+	} {
+		inject(t, gw, f)
+		sess = login(ctx, t, addr)
+		_, err := protocol.GetControllerConfig(ctx, sess)
+		if err == nil {
+			t.Errorf("%+v: expected an error", f)
+		}
+		if f.Truncate > 0 && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%+v: missing or wrong error: %v", f, err)
+		}
+	}
+}
+
+func TestScenario(t *testing.T) {
+	sc, err := simulator.ParseScenario([]byte(`
+faults:
+  - request: getstatus
+    after: 2
+    count: 1
+    reply: BadParameter
+  - request: GetConfig
+    split: 7
+    split_delay: 1ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sc.Faults), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := sc.Faults[1].SplitDelay, time.Millisecond; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	gw, err := simulator.New(simulator.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Inject(sc.Faults...); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []simulator.Fault{{Request: "nope"}, {Reply: "nope"}} {
+		if err := gw.Inject(f); err == nil {
+			t.Errorf("%+v: expected an error", f)
+		}
+	}
+}
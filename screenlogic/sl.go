@@ -13,6 +13,10 @@ import (
 func SupportedDevices() devices.SupportedDevices {
 	return devices.SupportedDevices{
 		"circuit": NewDevice,
+		"body":    NewDevice,
+		"light":   NewDevice,
+		"pump":    NewDevice,
+		"scene":   NewDevice,
 	}
 }
 
@@ -30,8 +34,17 @@ func NewController(typ string, opts devices.Options) (devices.Controller, error)
 }
 
 func NewDevice(typ string, opts devices.Options) (devices.Device, error) {
-	if typ == "circuit" {
+	switch typ {
+	case "circuit":
 		return NewCircuit(opts), nil
+	case "body":
+		return NewBody(opts), nil
+	case "light":
+		return NewLight(opts), nil
+	case "pump":
+		return NewPump(opts), nil
+	case "scene":
+		return NewScene(opts), nil
 	}
 	return nil, fmt.Errorf("unsupported pentair screenlogic device type %s", typ)
 }
@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"cloudeng.io/logging/ctxlog"
@@ -22,30 +23,112 @@ import (
 type AdapterConfig struct {
 	IPAddress string        `yaml:"ip_address"`
 	KeepAlive time.Duration `yaml:"keep_alive"`
+	// PingInterval, if set, is the interval at which pings are sent to
+	// the adapter whilst a connection is held open. A connection whose
+	// ping fails is closed so that it is re-established by the next
+	// operation rather than that operation failing.
+	PingInterval time.Duration `yaml:"ping_interval"`
+	// Record, if set, is the name of a file to which all of the frames
+	// sent to and received from the adapter are appended.
+	Record string `yaml:"record"`
+	// Replay, if set, is the name of a file containing a recording
+	// that is replayed instead of connecting to the adapter.
+	Replay string `yaml:"replay"`
+	// CacheTTL, if set, is the time for which the controller's status
+	// and configuration are cached. The status is invalidated by any
+	// operation that changes the controller's state.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// SyncWait is the maximum time that commands are deferred whilst the
+	// controller is in the sync state, the default is 30s. Commands are
+	// always refused whilst the controller is in service mode.
+	SyncWait time.Duration `yaml:"sync_wait"`
+	// SnapshotDir is the directory in which the snapshots created by the
+	// snapshot operation are stored.
+	SnapshotDir string `yaml:"snapshot_dir"`
+	// Interlocks are rules, checked against the controller's status, that
+	// constrain when circuits may be turned on or off.
+	Interlocks []InterlockConfig `yaml:"interlocks"`
+	// RateLimit limits the rate at which commands that change the
+	// controller's state are sent to the adapter.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// Debounce, if set, is the window within which repeated commands to
+	// set a circuit to the same state are dropped.
+	Debounce time.Duration `yaml:"debounce"`
+	// Reconnect specifies how failed connections to the adapter are
+	// retried and when to stop trying.
+	Reconnect ReconnectConfig `yaml:"reconnect"`
 }
 
 type Adapter struct {
 	devices.ControllerBase[AdapterConfig]
 
 	mgr      *streamconn.SessionManager
-	ondemand *netutil.OnDemandConnection[streamconn.Transport, *Adapter]
+	ondemand *netutil.OnDemandConnection[*adapterConn, *Adapter]
+
+	replayOnce sync.Once
+	replay     *slnet.Replay
+	replayErr  error
+
+	stats adapterStats
+	pings pingStats
+
+	status cached[protocol.ControllerStatus]
+	config cached[protocol.ControllerConfig]
+
+	interlocks []interlock
+	limiter    *tokenBucket
+	debouncer  debouncer
+	breaker    *breaker
 }
 
 func NewAdapter(_ devices.Options) *Adapter {
-	pa := &Adapter{}
+	pa := &Adapter{
+		status:  cached[protocol.ControllerStatus]{clone: protocol.ControllerStatus.Clone},
+		config:  cached[protocol.ControllerConfig]{clone: protocol.ControllerConfig.Clone},
+		breaker: newBreaker(ReconnectConfig{}),
+	}
 	pa.ondemand = netutil.NewOnDemandConnection(pa)
 	pa.mgr = &streamconn.SessionManager{}
 	return pa
 }
 
+// NewStandaloneAdapter returns an Adapter that is configured for use
+// outside of the devices framework, for example by the metrics exporter.
+// The timeout applies to each request sent to the adapter.
+func NewStandaloneAdapter(cfg AdapterConfig, timeout time.Duration) (*Adapter, error) {
+	pa := NewAdapter(devices.Options{})
+	pa.SetConfig(devices.ControllerConfigCommon{
+		Name:        "screenlogic",
+		Type:        "screenlogic-adapter",
+		RetryConfig: devices.RetryConfig{Timeout: timeout},
+	})
+	if err := pa.configure(cfg); err != nil {
+		return nil, err
+	}
+	return pa, nil
+}
+
 func (pa *Adapter) UnmarshalYAML(node *yaml.Node) error {
-	if err := node.Decode(&pa.ControllerConfigCustom); err != nil {
+	var cfg AdapterConfig
+	if err := node.Decode(&cfg); err != nil {
 		return err
 	}
-	if pa.ControllerConfigCustom.KeepAlive == 0 {
+	return pa.configure(cfg)
+}
+
+func (pa *Adapter) configure(cfg AdapterConfig) error {
+	if cfg.KeepAlive == 0 {
 		return fmt.Errorf("keep_alive must be specified")
 	}
-	pa.ondemand.SetKeepAlive(pa.ControllerConfigCustom.KeepAlive)
+	interlocks, err := parseInterlocks(cfg.Interlocks)
+	if err != nil {
+		return err
+	}
+	pa.interlocks = interlocks
+	pa.limiter = newTokenBucket(cfg.RateLimit)
+	pa.breaker = newBreaker(cfg.Reconnect)
+	pa.ControllerConfigCustom = cfg
+	pa.ondemand.SetKeepAlive(cfg.KeepAlive)
 	return nil
 }
 
@@ -54,12 +137,41 @@ func (pa *Adapter) Implementation() any {
 }
 
 func (pa *Adapter) runOperation(ctx context.Context, op func(context.Context, *protocol.Session, devices.OperationArgs) (any, error), args devices.OperationArgs) (any, error) {
-	ctx, sess, err := pa.session(ctx)
-	if err != nil {
-		return nil, err
+	var result any
+	err := pa.withSession(ctx, true, func(ctx context.Context, sess *protocol.Session) error {
+		var err error
+		result, err = op(ctx, sess, args)
+		return err
+	})
+	return result, err
+}
+
+// withSession calls fn with a new session. If retry is set and fn fails
+// because the connection to the adapter failed it is retried, once,
+// using a new connection. Only requests that read the controller's state
+// may be retried since a request that changes it may have been acted on
+// by the adapter before the connection failed.
+func (pa *Adapter) withSession(ctx context.Context, retry bool, fn func(context.Context, *protocol.Session) error) error {
+	attempts := 1
+	if retry {
+		attempts = 2
 	}
-	defer sess.Release()
-	return op(ctx, sess, args)
+	var err error
+	for attempt := range attempts {
+		sctx, sess, serr := pa.session(ctx)
+		if serr != nil {
+			pa.stats.recordSessionError(serr)
+			return serr
+		}
+		err = fn(sctx, sess)
+		sess.Release()
+		pa.stats.record(err)
+		if !isTransportError(err) {
+			return err
+		}
+		ctxlog.Warn(sctx, "screenlogic: operation failed", "attempt", attempt, "err", err)
+	}
+	return err
 }
 
 func (pa *Adapter) Operations() map[string]devices.Operation {
@@ -70,21 +182,31 @@ func (pa *Adapter) Operations() map[string]devices.Operation {
 		"getversion": func(ctx context.Context, args devices.OperationArgs) (any, error) {
 			return pa.runOperation(ctx, pa.getVersion, args)
 		},
-		"getconfig": func(ctx context.Context, args devices.OperationArgs) (any, error) {
-			return pa.runOperation(ctx, pa.getConfig, args)
-		},
-		"getstatus": func(ctx context.Context, args devices.OperationArgs) (any, error) {
-			return pa.runOperation(ctx, pa.getStatus, args)
-		},
+		"apply":         pa.apply,
+		"getconfig":     pa.getConfig,
+		"health":        pa.health,
+		"getstatus":     pa.getStatus,
+		"watch":         pa.watch,
+		"validate":      pa.validate,
+		"exportdevices": pa.exportDevices,
+		"snapshot":      pa.snapshot,
+		"restore":       pa.restore,
 	}
 }
 
 func (pa *Adapter) OperationsHelp() map[string]string {
 	return map[string]string{
-		"gettime":    "get the current time, date and timezone",
-		"getconfig":  "get the current system configuration",
-		"getstatus":  "get the current system satus",
-		"getversion": "get the adapter version",
+		"apply":         "make a series of changes, in order, using a single session, eg. apply circuit 505 on; circuit Cleaner off; setpoint spa 102",
+		"exportdevices": "write a devices: configuration for the controller's circuits, lights, bodies and pumps",
+		"gettime":       "get the current time, date and timezone",
+		"getconfig":     "get the current system configuration",
+		"getstatus":     "get the current system satus",
+		"getversion":    "get the adapter version",
+		"health":        "get the state of the breaker that guards connections to the adapter, the adapter's operation and error counts and ping latencies",
+		"restore":       "restore the named snapshot, changing only those circuits and heat settings that differ from it, eg. restore before-party",
+		"snapshot":      "save the state of all circuits and the heat settings of all bodies as the named snapshot, eg. snapshot before-party",
+		"validate":      "check that all of the configured circuits are known to the controller",
+		"watch":         "write changes to the system's status and configuration as they happen, optionally taking a polling interval and a duration, eg. watch 10s 1h",
 	}
 }
 
@@ -108,44 +230,105 @@ func (pa *Adapter) getVersion(ctx context.Context, sess *protocol.Session, args
 	}{Version: version}, err
 }
 
-func (pa *Adapter) getConfig(ctx context.Context, sess *protocol.Session, args devices.OperationArgs) (any, error) {
-	cfg, err := protocol.GetControllerConfig(ctx, sess)
+func (pa *Adapter) getConfig(ctx context.Context, args devices.OperationArgs) (any, error) {
+	cfg, err := pa.GetConfig(ctx)
 	if err == nil {
 		pa.FormatConfig(args.Writer, cfg)
 	}
 	return cfg, err
 }
 
-func (pa *Adapter) getStatus(ctx context.Context, sess *protocol.Session, args devices.OperationArgs) (any, error) {
-	status, err := protocol.GetControllerStatus(ctx, sess)
+func (pa *Adapter) getStatus(ctx context.Context, args devices.OperationArgs) (any, error) {
+	status, err := pa.GetStatus(ctx)
 	if err == nil {
 		pa.FormatStatus(args.Writer, status)
 	}
 	return status, err
 }
 
-func (pa *Adapter) Connect(ctx context.Context, idle netutil.IdleReset) (streamconn.Transport, error) {
-	ctxlog.Info(ctx, "screenlogic: connect: dialing", "ip", pa.ControllerConfigCustom.IPAddress)
-	conn, err := slnet.Dial(ctx, pa.ControllerConfigCustom.IPAddress, pa.Timeout)
-	if err != nil {
-		return nil, err
+// call calls fn, which must only read the controller's state, with a new
+// session and returns its result.
+func call[T any](ctx context.Context, pa *Adapter, fn func(context.Context, *protocol.Session) (T, error)) (T, error) {
+	var result T
+	err := pa.withSession(ctx, true, func(ctx context.Context, sess *protocol.Session) error {
+		var err error
+		result, err = fn(ctx, sess)
+		return err
+	})
+	return result, err
+}
+
+// GetConfig returns the controller's configuration, which may be cached
+// as per AdapterConfig.CacheTTL.
+func (pa *Adapter) GetConfig(ctx context.Context) (protocol.ControllerConfig, error) {
+	return pa.config.get(ctx, pa.ControllerConfigCustom.CacheTTL, pa.Timeout, &pa.stats, func(ctx context.Context) (protocol.ControllerConfig, error) {
+		return call(ctx, pa, protocol.GetControllerConfig)
+	})
+}
+
+// GetStatus returns the controller's current status, which may be cached
+// as per AdapterConfig.CacheTTL.
+func (pa *Adapter) GetStatus(ctx context.Context) (protocol.ControllerStatus, error) {
+	return pa.status.get(ctx, pa.ControllerConfigCustom.CacheTTL, pa.Timeout, &pa.stats, func(ctx context.Context) (protocol.ControllerStatus, error) {
+		return call(ctx, pa, protocol.GetControllerStatus)
+	})
+}
+
+// GetPumpStatus returns the status of the specified pump, as indexed
+// by protocol.IntelliFlo.Index.
+func (pa *Adapter) GetPumpStatus(ctx context.Context, pump int) (protocol.PumpStatus, error) {
+	return call(ctx, pa, func(ctx context.Context, sess *protocol.Session) (protocol.PumpStatus, error) {
+		return protocol.GetPumpStatus(ctx, sess, pump)
+	})
+}
+
+// dial returns a new connection to the adapter, or the replay transport
+// if a recording is being replayed. The connection is wrapped with
+// a recorder if recording is enabled.
+func (pa *Adapter) dial(ctx context.Context) (streamconn.Transport, error) {
+	cfg := pa.ControllerConfigCustom
+	var conn streamconn.Transport
+	if len(cfg.Replay) > 0 {
+		// A single replay is shared across all connections so that
+		// recordings that span multiple connections can be replayed.
+		pa.replayOnce.Do(func() {
+			pa.replay, pa.replayErr = slnet.OpenReplay(cfg.Replay)
+		})
+		if pa.replayErr != nil {
+			return nil, pa.replayErr
+		}
+		ctxlog.Info(ctx, "screenlogic: connect: replaying", "file", cfg.Replay)
+		conn = pa.replay
+	} else {
+		ctxlog.Info(ctx, "screenlogic: connect: dialing", "ip", cfg.IPAddress)
+		c, err := slnet.Dial(ctx, cfg.IPAddress, pa.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		conn = c
 	}
-	ctx, s := pa.mgr.NewWithContext(ctx, conn, idle)
-	session := protocol.NewSession(s)
-	defer session.Release()
+	if len(cfg.Record) > 0 {
+		rec, err := slnet.RecordToFile(conn, cfg.Record)
+		if err != nil {
+			conn.Close(ctx)
+			return nil, err
+		}
+		ctxlog.Info(ctx, "screenlogic: connect: recording", "file", cfg.Record)
+		conn = rec
+	}
+	return conn, nil
+}
 
-	// Connect, there is no authentication for the screenlogic adapters
-	// on a local network.
-	ctxlog.Info(ctx, "screenlogic: connect: logging in", "ip", pa.ControllerConfigCustom.IPAddress)
-	if err := protocol.Login(ctx, session); err != nil {
-		conn.Close(ctx)
+func (pa *Adapter) Connect(ctx context.Context, idle netutil.IdleReset) (*adapterConn, error) {
+	ac := &adapterConn{pa: pa, idle: idle}
+	if err := ac.connect(ctx); err != nil {
 		return nil, err
 	}
-	ctxlog.Info(ctx, "screenlogic: connect: logged in", "ip", pa.ControllerConfigCustom.IPAddress)
-	return conn, nil
+	ac.startPinger(ctx)
+	return ac, nil
 }
 
-func (pa *Adapter) Disconnect(ctx context.Context, conn streamconn.Transport) error {
+func (pa *Adapter) Disconnect(ctx context.Context, conn *adapterConn) error {
 	return conn.Close(ctx)
 }
 
@@ -155,12 +338,16 @@ func (pa *Adapter) session(ctx context.Context) (context.Context, *protocol.Sess
 	if err != nil {
 		return ctx, nil, err
 	}
+	if err := conn.reconnect(ctx); err != nil {
+		return ctx, nil, err
+	}
 	ctx, s := pa.mgr.NewWithContext(ctx, conn, idle)
 	session := protocol.NewSession(s)
 	return ctx, session, nil
 }
 
 func (pa *Adapter) Close(ctx context.Context) error {
+	pa.breaker.close()
 	return pa.ondemand.Close(ctx)
 }
 
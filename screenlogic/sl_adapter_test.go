@@ -0,0 +1,1441 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"github.com/cosnicolaou/pentair/screenlogic/simulator"
+	"gopkg.in/yaml.v3"
+)
+
+func newAdapter(t *testing.T, cfg string) *screenlogic.Adapter {
+	t.Helper()
+	pa := screenlogic.NewAdapter(devices.Options{})
+	pa.SetConfig(devices.ControllerConfigCommon{
+		Name:        "pool",
+		Type:        "screenlogic-adapter",
+		RetryConfig: devices.RetryConfig{Timeout: time.Second},
+	})
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(cfg), &node); err != nil {
+		t.Fatal(err)
+	}
+	if err := pa.UnmarshalYAML(node.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Allow the idle timer goroutine started by netutil.IdleManager
+		// to run before stopping it, since stopping it before it has
+		// started will block until the context is canceled.
+		time.Sleep(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pa.Close(ctx); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	return pa
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	pa := newAdapter(t, `
+keep_alive: 1m
+replay: testdata/getversion.slrec
+`)
+	var out strings.Builder
+	if _, err := pa.Operations()["getversion"](ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "version: POOL: 5.2 Build 736.0 Rel\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The recording is exhausted so a second operation must fail.
+	if _, err := pa.Operations()["getversion"](ctx, devices.OperationArgs{Writer: &out}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func startSimulator(t *testing.T) (*simulator.Gateway, string) {
+	t.Helper()
+	return startSimulatorConfig(t, simulator.DefaultConfig())
+}
+
+func startSimulatorConfig(t *testing.T, cfg simulator.Config) (*simulator.Gateway, string) {
+	t.Helper()
+	gw, err := simulator.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gw.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return gw, ln.Addr().String()
+}
+
+func TestSimulator(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+
+	var out strings.Builder
+	v, err := pa.Operations()["getconfig"](ctx, devices.OperationArgs{Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(v.(protocol.ControllerConfig).Circuits), len(gw.Config().Circuits); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !strings.Contains(out.String(), "Pool Light") {
+		t.Errorf("missing circuit name in %q", out.String())
+	}
+
+	circuit := screenlogic.NewCircuit(devices.Options{})
+	circuit.DeviceConfigCustom.ID = 502
+	circuit.SetController(pa)
+	if _, err := circuit.On(ctx, devices.OperationArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+	v, err = pa.Operations()["getstatus"](ctx, devices.OperationArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.(protocol.ControllerStatus).StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+	if _, err := circuit.Off(ctx, devices.OperationArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+	getStatus := func() error {
+		_, err := pa.Operations()["getstatus"](ctx, devices.OperationArgs{})
+		return err
+	}
+	inject := func(f simulator.Fault) {
+		t.Helper()
+		gw.ClearFaults()
+		if err := gw.Inject(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := getStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gw.Connections(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A single transport failure is retried on a new connection.
+	for i, f := range []simulator.Fault{
+		{Request: "GetStatus", Count: 1, Reset: true},
+		{Request: "GetStatus", Count: 1, Truncate: 10},
+		{Request: "GetStatus", Count: 1, Drop: true},
+	} {
+		inject(f)
+		if err := getStatus(); err != nil {
+			t.Errorf("%+v: %v", f, err)
+		}
+		if got, want := gw.Connections(), i+2; got != want {
+			t.Errorf("%+v: got %v, want %v", f, got, want)
+		}
+	}
+
+	// Repeated failures are returned and the connection is
+	// re-established on the next operation.
+	inject(simulator.Fault{Request: "GetStatus", Count: 2, Reset: true})
+	if err := getStatus(); err == nil {
+		t.Errorf("expected an error")
+	}
+	if err := getStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gw.Connections(), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Protocol errors are neither retried nor cause a reconnect.
+	inject(simulator.Fault{Request: "GetStatus", Count: 1, Reply: "InvalidRequest"})
+	if err := getStatus(); !errors.Is(err, protocol.ErrInvalidRequest) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if err := getStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gw.Connections(), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Failed logins are returned.
+	inject(simulator.Fault{Request: "GetStatus", Count: 1, Reset: true})
+	if err := gw.Inject(simulator.Fault{Request: "LocalLogin", Count: 1, Reply: "BadLogin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := getStatus(); !errors.Is(err, protocol.ErrBadLogin) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if err := getStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := pa.Stats(), (screenlogic.AdapterStats{
+		Operations:      15,
+		ProtocolErrors:  2, // InvalidRequest and BadLogin.
+		TransportErrors: 6,
+		Connects:        7, // The connection with the failed login is not counted.
+		Reconnects:      7,
+	}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan protocol.Change, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pa.Watch(wctx, 10*time.Millisecond, func(c protocol.Change) {
+			ch <- c
+		})
+	}()
+	// Wait for the initial status to be obtained.
+	time.Sleep(100 * time.Millisecond)
+	if err := gw.SetCircuit(502, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-ch, (protocol.Change{Kind: protocol.ChangeCircuitOn, ID: 502, Name: "Pool Light"}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.Bodies[1].CurrentTemp += 2
+	})
+	if got, want := (<-ch).String(), "Spa temperature: 80 -> 82 (+2)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	v, err := pa.Operations()["watch"](ctx, devices.OperationArgs{Writer: &out, Args: []string{"10ms", "50ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil || out.Len() != 0 {
+		t.Errorf("unexpected changes: %v: %q", v, out.String())
+	}
+
+	// Changes are written as they happen.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		gw.SetCircuit(502, false)
+	}()
+	if _, err := pa.Operations()["watch"](ctx, devices.OperationArgs{Writer: &out, Args: []string{"10ms", "300ms"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), ": circuit 502 (Pool Light): off\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want suffix %q", got, want)
+	}
+	if _, err := pa.Operations()["watch"](ctx, devices.OperationArgs{Args: []string{"soon"}}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\ncache_ttl: 1m\n", addr))
+
+	// Concurrent callers share a single request.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pa.GetStatus(ctx)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := pa.Stats()
+	if got, want := stats.Operations, int64(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stats.CacheHits+stats.SharedRequests, int64(9); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Changes made behind the adapter's back are not seen until the
+	// cache expires or is invalidated.
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.AirTemp = 60
+	})
+	st, err := pa.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.AirTemp, 72; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Modifying the returned value does not affect the cache.
+	st.Circuits[0].State = !st.Circuits[0].State
+	if st2, _ := pa.GetStatus(ctx); st2.Circuits[0].State == st.Circuits[0].State {
+		t.Errorf("cached value was modified")
+	}
+
+	if err := pa.SetCircuit(ctx, 502, true); err != nil {
+		t.Fatal(err)
+	}
+	st, err = pa.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.AirTemp, 60; got != want || !st.StatusForID(502) {
+		t.Errorf("got %v (%v), want %v", got, st.StatusForID(502), want)
+	}
+
+	// The configuration is cached independently of the status.
+	for range 3 {
+		if _, err := pa.GetConfig(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := pa.Stats().Operations, int64(4); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Canceling the caller that initiated a shared request affects
+	// only that caller.
+	if err := pa.SetCircuit(ctx, 502, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Inject(simulator.Fault{Request: "GetStatus", Count: 1, Delay: 200 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := pa.GetStatus(cctx)
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	sharedCh := make(chan error, 1)
+	go func() {
+		_, err := pa.GetStatus(ctx)
+		sharedCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if err := <-sharedCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+
+	circuit := screenlogic.NewCircuit(devices.Options{})
+	circuit.DeviceConfigCustom.ID = 502
+	circuit.DeviceConfigCustom.Verify = 300 * time.Millisecond
+	circuit.SetController(pa)
+	if _, err := circuit.On(ctx, devices.OperationArgs{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the controller acknowledging, but ignoring, button presses
+	// whilst freeze protection and the pool delay are active.
+	if err := gw.Inject(simulator.Fault{Request: "ButtonPress", Reply: "ButtonPressResponse"}); err != nil {
+		t.Fatal(err)
+	}
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.FreezeMode = true
+		st.PoolDelay = true
+	})
+	_, err := circuit.Off(ctx, devices.OperationArgs{})
+	if !errors.Is(err, screenlogic.ErrNotVerified) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	var verr *screenlogic.VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("wrong error type: %T", err)
+	}
+	if got, want := verr.Reasons, []string{"freeze protection is active", "pool delay is active"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := err.Error(), "circuit 502 off: change not reflected in the controller's status: freeze protection is active, pool delay is active"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should still be on")
+	}
+
+	var body screenlogic.Body
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("body: spa\nverify: 300ms\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.UnmarshalYAML(node.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	body.SetController(pa)
+	if _, err := body.SetPoint(ctx, devices.OperationArgs{Args: []string{"102"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := body.HeatMode(ctx, devices.OperationArgs{Args: []string{"solar", "preferred"}}); err != nil {
+		t.Fatal(err)
+	}
+	spa, _ := gw.Status().Body(protocol.BodySpa)
+	if spa.HeatSetPoint != 102 || spa.HeatMode != protocol.HeatModeSolarPreferred {
+		t.Errorf("unexpected spa status: %+v", spa)
+	}
+	if err := gw.Inject(simulator.Fault{Request: "SetHeatSetPoint", Reply: "SetHeatSetPointResponse"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = body.SetPoint(ctx, devices.OperationArgs{Args: []string{"104"}})
+	if got, want := fmt.Sprint(err), "spa heat set point 104: change not reflected in the controller's status: freeze protection is active, pool delay is active"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := body.SetPoint(ctx, devices.OperationArgs{Args: []string{"hot"}}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestControllerState(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nsync_wait: 200ms\n", addr))
+
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.State = protocol.ControllerService
+	})
+	err := pa.SetCircuit(ctx, 502, true)
+	if !errors.Is(err, screenlogic.ErrControllerInService) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	var serr *screenlogic.StateError
+	if !errors.As(err, &serr) || serr.State != protocol.ControllerService {
+		t.Fatalf("wrong error: %#v", err)
+	}
+	if got, want := err.Error(), "set circuit 502 on: controller is in service mode"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should still be off")
+	}
+
+	// Commands are refused if the controller remains in the sync state.
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.State = protocol.ControllerSync
+	})
+	if err := pa.SetHeatSetPoint(ctx, protocol.BodyPool, 84); !errors.Is(err, screenlogic.ErrControllerSyncing) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+
+	// And deferred until it leaves the sync state.
+	pa.ControllerConfigCustom.SyncWait = 5 * time.Second
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+			st.State = protocol.ControllerReady
+		})
+	}()
+	if err := pa.SetCircuit(ctx, 502, true); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+}
+
+func newCircuit(t *testing.T, pa *screenlogic.Adapter, name, cfg string) *screenlogic.Circuit {
+	t.Helper()
+	c := screenlogic.NewCircuit(devices.Options{})
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(cfg), &node); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UnmarshalYAML(node.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	c.SetConfig(devices.DeviceConfigCommon{Name: name, Type: "circuit"})
+	c.SetController(pa)
+	return c
+}
+
+func TestCircuitNames(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+
+	for _, cfg := range []string{"verify: 1s\n", "id: 502\ncircuit: Pool Light\n"} {
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(cfg), &node); err != nil {
+			t.Fatal(err)
+		}
+		if err := screenlogic.NewCircuit(devices.Options{}).UnmarshalYAML(node.Content[0]); err == nil {
+			t.Errorf("%q: expected an error", cfg)
+		}
+	}
+
+	light := newCircuit(t, pa, "light", "circuit: Pool Light\n")
+	if _, err := light.On(ctx, devices.OperationArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+
+	typo := newCircuit(t, pa, "typo", "circuit: pool lite\n")
+	_, err := typo.On(ctx, devices.OperationArgs{})
+	var uerr *screenlogic.UnknownCircuitError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if got, want := err.Error(), `typo: unknown circuit name "pool lite", did you mean "Pool Light" (502) or "Pool" (505)?`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	pa.SetSystem(devices.System{Devices: map[string]devices.Device{
+		"light":   light,
+		"typo":    typo,
+		"waterfa": newCircuit(t, pa, "waterfa", "circuit: Waterfal\n"),
+		"spa":     newCircuit(t, pa, "spa", "id: 500\n"),
+		"bad-id":  newCircuit(t, pa, "bad-id", "id: 509\n"),
+		"unknown": newCircuit(t, pa, "unknown", "circuit: Slide\n"),
+	}})
+	err = pa.ValidateDevices(ctx)
+	want := []string{
+		`bad-id: unknown circuit id 509, did you mean "Spa" (500) or "Cleaner" (501) or "Pool Light" (502)?`,
+		`typo: unknown circuit name "pool lite", did you mean "Pool Light" (502) or "Pool" (505)?`,
+		`unknown: unknown circuit name "Slide"`,
+		`waterfa: unknown circuit name "Waterfal", did you mean "Waterfall" (504)?`,
+	}
+	if got := strings.Split(fmt.Sprint(err), "\n"); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// All of the adapters in a system are validated at startup.
+	sys := devices.System{
+		Controllers: map[string]devices.Controller{"pool": pa},
+		Devices: map[string]devices.Device{
+			"light": light,
+			"typo":  typo,
+		},
+	}
+	pa.SetSystem(sys)
+	err = screenlogic.ValidateSystem(ctx, sys)
+	if !errors.As(err, &uerr) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if got, want := err.Error(), `pool: typo: unknown circuit name "pool lite", did you mean "Pool Light" (502) or "Pool" (505)?`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExportDevices(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+
+	var out strings.Builder
+	if _, err := pa.Operations()["exportdevices"](ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  # Lights\n  - name: pool-light\n    type: light\n    controller: pool\n    circuit: Pool Light # id 502\n",
+		"  - name: spa-heater\n    type: body\n    controller: pool\n    body: spa\n",
+		"  - name: pump-0\n    type: pump\n    controller: pool\n    index: 0\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%s: missing %s", out.String(), want)
+		}
+	}
+
+	// The exported devices must be usable as is.
+	spec := fmt.Sprintf("controllers:\n  - name: pool\n    type: screenlogic-adapter\n    ip_address: %v\n    keep_alive: 1m\n%s", addr, out.String())
+	sys, err := devices.ParseSystemConfig(ctx, []byte(spec),
+		devices.WithControllers(screenlogic.SupportedControllers()),
+		devices.WithDevices(screenlogic.SupportedDevices()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spa := sys.Controllers["pool"].Implementation().(*screenlogic.Adapter)
+	defer func() {
+		time.Sleep(50 * time.Millisecond)
+		spa.Close(ctx)
+	}()
+	if err := spa.ValidateDevices(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sys.Devices), 9; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := sys.Devices["spa-light"].Operations()["mode"](ctx, devices.OperationArgs{Args: []string{"all", "on"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(502) || !gw.Status().StatusForID(503) {
+		t.Errorf("lights should be on")
+	}
+	out.Reset()
+	if _, err := sys.Devices["pump-0"].Operations()["status"](ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "pump 0: running, 850W, 2450 rpm, 45 gpm\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+const sceneSpec = `controllers:
+  - name: pool
+    type: screenlogic-adapter
+    ip_address: %v
+    keep_alive: 1m
+devices:
+  - name: party
+    type: scene
+    controller: pool
+    circuits:
+      - circuit: Spa
+        state: on
+      - circuit: Pool Light
+        state: on
+      - id: 505
+        state: off
+    light_mode: party
+    bodies:
+      - body: spa
+        heat_set_point: 102
+        heat_mode: heater
+`
+
+func TestScene(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	sys, err := devices.ParseSystemConfig(ctx, []byte(fmt.Sprintf(sceneSpec, addr)),
+		devices.WithControllers(screenlogic.SupportedControllers()),
+		devices.WithDevices(screenlogic.SupportedDevices()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := sys.Controllers["pool"].Implementation().(*screenlogic.Adapter)
+	defer func() {
+		time.Sleep(50 * time.Millisecond)
+		pa.Close(ctx)
+	}()
+	if err := pa.ValidateDevices(ctx); err != nil {
+		t.Fatal(err)
+	}
+	apply := sys.Devices["party"].Operations()["apply"]
+
+	// A failure rolls back all of the preceding steps.
+	if err := gw.Inject(simulator.Fault{Request: "SetHeatMode", Reply: "BadParameter", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	_, err = apply(ctx, devices.OperationArgs{Writer: &out})
+	var serr *screenlogic.SceneError
+	if !errors.As(err, &serr) || !errors.Is(err, screenlogic.ErrSceneFailed) || !errors.Is(err, protocol.ErrBadParameter) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	want := `party: circuit 500 (Spa) on: rolled back
+party: circuit 502 (Pool Light) on: rolled back
+party: circuit 505 off: rolled back
+party: light mode Party: not restored
+party: spa heat set point 102: rolled back
+party: spa heat mode Heater: failed: setHeatMode: bad parameter
+`
+	if got := out.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	st := gw.Status()
+	spa, _ := st.Body(protocol.BodySpa)
+	if st.StatusForID(500) || st.StatusForID(502) || !st.StatusForID(505) || spa.HeatSetPoint != 100 || spa.HeatMode != protocol.HeatModeOff {
+		t.Errorf("scene was not rolled back: %+v", st)
+	}
+
+	out.Reset()
+	if _, err := apply(ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(out.String(), ": applied\n"), 6; got != want {
+		t.Errorf("got %v, want %v: %v", got, want, out.String())
+	}
+	st = gw.Status()
+	spa, _ = st.Body(protocol.BodySpa)
+	if !st.StatusForID(500) || !st.StatusForID(502) || st.StatusForID(505) || spa.HeatSetPoint != 102 || spa.HeatMode != protocol.HeatModeHeater {
+		t.Errorf("scene was not applied: %+v", st)
+	}
+
+	// A body that is missing from the prior status is not restored to
+	// a zero value.
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.Bodies = slices.DeleteFunc(st.Bodies, func(b protocol.BodyStatus) bool {
+			return b.Type == protocol.BodySpa
+		})
+	})
+	out.Reset()
+	if _, err := apply(ctx, devices.OperationArgs{Writer: &out}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, want := out.String(), "party: spa heat set point 102: rollback failed: spa: prior status not reported\n"; !strings.Contains(got, want) {
+		t.Errorf("got %v, want it to contain %v", got, want)
+	}
+
+	// Nor is a circuit that is missing from the prior status turned off.
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		st.Circuits = slices.DeleteFunc(st.Circuits, func(c protocol.CircuitStatus) bool {
+			return c.ID == 505
+		})
+	})
+	out.Reset()
+	if _, err := apply(ctx, devices.OperationArgs{Writer: &out}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, want := out.String(), "party: circuit 505 off: rollback failed: circuit 505: prior status not reported\n"; !strings.Contains(got, want) {
+		t.Errorf("got %v, want it to contain %v", got, want)
+	}
+}
+
+func TestSceneRateLimit(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	spec := strings.Replace(sceneSpec, "keep_alive: 1m\n", "keep_alive: 1m\n    rate_limit:\n      rate: 1\n      burst: 3\n      max_wait: 10ms\n", 1)
+	sys, err := devices.ParseSystemConfig(ctx, []byte(fmt.Sprintf(spec, addr)),
+		devices.WithControllers(screenlogic.SupportedControllers()),
+		devices.WithDevices(screenlogic.SupportedDevices()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := sys.Controllers["pool"].Implementation().(*screenlogic.Adapter)
+	defer pa.Close(ctx)
+
+	// A step refused by the rate limiter, whilst the session is released,
+	// is rolled back using a new session.
+	var out strings.Builder
+	_, err = sys.Devices["party"].Operations()["apply"](ctx, devices.OperationArgs{Writer: &out})
+	if !errors.Is(err, screenlogic.ErrSceneFailed) || !errors.Is(err, screenlogic.ErrRateLimited) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	for _, want := range []string{
+		"party: circuit 500 (Spa) on: rolled back\n",
+		"party: circuit 505 off: rolled back\n",
+		"party: light mode Party: failed: light mode Party: rate limit exceeded",
+		"party: spa heat mode Heater: skipped\n",
+	} {
+		if got := out.String(); !strings.Contains(got, want) {
+			t.Errorf("got %v, want it to contain %v", got, want)
+		}
+	}
+	if st := gw.Status(); st.StatusForID(500) || st.StatusForID(502) || !st.StatusForID(505) {
+		t.Errorf("scene was not rolled back: %+v", st)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	dir := t.TempDir()
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nsnapshot_dir: %v\n", addr, dir))
+
+	var out strings.Builder
+	if _, err := pa.Operations()["snapshot"](ctx, devices.OperationArgs{Args: []string{"before"}, Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "snapshot: before: 6 circuits, 2 bodies\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := pa.Snapshot(ctx, "../before"); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	// Add a circuit that no longer exists and change the ID of another
+	// to simulate the controller having been reprogrammed.
+	snap, err := pa.ReadSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Circuits = append(snap.Circuits, screenlogic.SnapshotCircuit{ID: 510, Name: "Slide", State: true})
+	for i, c := range snap.Circuits {
+		if c.Name == "Waterfall" {
+			snap.Circuits[i].ID = 599
+		}
+	}
+	buf, _ := json.Marshal(snap)
+	if err := os.WriteFile(filepath.Join(dir, "before.json"), buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{
+		pa.SetCircuit(ctx, 500, true),
+		pa.SetCircuit(ctx, 504, true),
+		pa.SetCircuit(ctx, 505, false),
+		pa.SetHeatSetPoint(ctx, protocol.BodySpa, 104),
+		pa.SetHeatMode(ctx, protocol.BodySpa, protocol.HeatModeHeater),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applied, err := pa.Restore(ctx, "before")
+	if !errors.Is(err, screenlogic.ErrMissingCircuits) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if got, want := err.Error(), `before: snapshot circuits no longer exist: "Slide" (510)`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := applied, []string{
+		"circuit 500 (Spa) off",
+		"circuit 504 (Waterfall) off",
+		"circuit 505 (Pool) on",
+		"spa heat set point 100",
+		"spa heat mode Off",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	st := gw.Status()
+	spa, _ := st.Body(protocol.BodySpa)
+	if st.StatusForID(500) || st.StatusForID(504) || !st.StatusForID(505) || spa.HeatSetPoint != 100 || spa.HeatMode != protocol.HeatModeOff {
+		t.Errorf("snapshot was not restored: %+v", st)
+	}
+
+	applied, _ = pa.Restore(ctx, "before")
+	if len(applied) != 0 {
+		t.Errorf("unexpected changes: %v", applied)
+	}
+}
+
+func TestSnapshotDuplicateNames(t *testing.T) {
+	ctx := context.Background()
+	cfg := simulator.DefaultConfig()
+	cfg.Circuits = append(cfg.Circuits,
+		simulator.CircuitConfig{ID: 506, Name: "Feature", Function: "Generic", Interface: "Features"},
+		simulator.CircuitConfig{ID: 507, Name: "Feature", Function: "Generic", Interface: "Features"},
+	)
+	gw, addr := startSimulatorConfig(t, cfg)
+	dir := t.TempDir()
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nsnapshot_dir: %v\n", addr, dir))
+
+	if _, err := pa.Snapshot(ctx, "before"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{504, 506, 507} {
+		if err := pa.SetCircuit(ctx, id, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Circuits whose names are duplicated are restored by ID.
+	applied, err := pa.Restore(ctx, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := applied, []string{
+		"circuit 504 (Waterfall) off",
+		"circuit 506 (Feature) off",
+		"circuit 507 (Feature) off",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A circuit whose name no longer agrees with its ID is matched by
+	// name only if that name is unique, otherwise it is reported as
+	// missing rather than guessing.
+	snap, err := pa.ReadSnapshot("before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range snap.Circuits {
+		switch c.ID {
+		case 504:
+			snap.Circuits[i].ID = 598
+		case 507:
+			snap.Circuits[i].ID = 599
+		}
+	}
+	buf, _ := json.Marshal(snap)
+	if err := os.WriteFile(filepath.Join(dir, "before.json"), buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{504, 506, 507} {
+		if err := pa.SetCircuit(ctx, id, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	applied, err = pa.Restore(ctx, "before")
+	if !errors.Is(err, screenlogic.ErrMissingCircuits) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if got, want := err.Error(), `before: snapshot circuits no longer exist: "Feature" (599)`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := applied, []string{
+		"circuit 504 (Waterfall) off",
+		"circuit 506 (Feature) off",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if st := gw.Status(); st.StatusForID(504) || st.StatusForID(506) || !st.StatusForID(507) {
+		t.Errorf("snapshot was not restored as expected: %+v", st)
+	}
+}
+
+func TestInterlocks(t *testing.T) {
+	ctx := context.Background()
+	_, addr := startSimulator(t)
+	now := time.Now()
+	window := now.Add(time.Hour).Format("15:04") + "-" + now.Add(2*time.Hour).Format("15:04")
+	pa := newAdapter(t, fmt.Sprintf(`ip_address: %v
+keep_alive: 1m
+snapshot_dir: %v
+interlocks:
+  - circuit: Cleaner
+    requires: Pool
+  - circuit: "500"
+    excludes: Waterfall
+  - circuit: Pool Light
+    during: %v
+`, addr, t.TempDir(), window))
+	if err := pa.ValidateDevices(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := func(err error, want string) {
+		t.Helper()
+		if !errors.Is(err, screenlogic.ErrInterlock) {
+			t.Fatalf("missing or wrong error: %v", err)
+		}
+		if got := err.Error(); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	ok := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ok(pa.SetCircuit(ctx, 501, true))
+	refused(pa.SetCircuit(ctx, 505, false), "set circuit 505 off: interlock violation: Cleaner requires Pool: Cleaner is on")
+	ok(pa.SetCircuit(ctx, 501, false))
+	ok(pa.SetCircuit(ctx, 505, false))
+	refused(pa.SetCircuit(ctx, 501, true), "set circuit 501 on: interlock violation: Cleaner requires Pool: Pool is off")
+
+	ok(pa.SetCircuit(ctx, 504, true))
+	refused(pa.SetCircuit(ctx, 500, true), "set circuit 500 on: interlock violation: 500 excludes Waterfall: Waterfall is on")
+	ok(pa.SetCircuit(ctx, 504, false))
+	ok(pa.SetCircuit(ctx, 500, true))
+	refused(pa.SetCircuit(ctx, 504, true), "set circuit 504 on: interlock violation: 500 excludes Waterfall: 500 is on")
+
+	err := pa.SetCircuit(ctx, 502, true)
+	if !errors.Is(err, screenlogic.ErrInterlock) || !strings.Contains(err.Error(), "Pool Light only during "+window) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	ok(pa.SetCircuit(ctx, 502, false))
+
+	// Restoring a snapshot makes the changes in an order that satisfies
+	// the interlocks.
+	ok(pa.SetCircuit(ctx, 505, true))
+	ok(pa.SetCircuit(ctx, 501, true))
+	_, err = pa.Snapshot(ctx, "cleaning")
+	ok(err)
+	ok(pa.SetCircuit(ctx, 501, false))
+	ok(pa.SetCircuit(ctx, 505, false))
+	applied, err := pa.Restore(ctx, "cleaning")
+	ok(err)
+	if got, want := applied, []string{"circuit 505 (Pool) on", "circuit 501 (Cleaner) on"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// An interlock that refers to an unknown circuit is reported by
+	// validation and refuses changes only to the circuits it does refer
+	// to.
+	pa = newAdapter(t, fmt.Sprintf(`ip_address: %v
+keep_alive: 1m
+interlocks:
+  - circuit: Cleaner
+    requires: Pol
+`, addr))
+	if err := pa.ValidateDevices(ctx); err == nil || !strings.Contains(err.Error(), `interlocks: unknown circuit name "Pol", did you mean "Pool" (505)?`) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	ok(pa.SetCircuit(ctx, 504, true))
+	ok(pa.SetCircuit(ctx, 504, false))
+	refused(pa.SetCircuit(ctx, 501, true), "set circuit 501 on: interlock violation: Cleaner requires Pol: Pol is not known to the controller")
+
+	for _, cfg := range []string{
+		"  - circuit: Pool\n    requires: Spa\n    excludes: Cleaner\n",
+		"  - circuit: Pool\n    during: 9am-5pm\n",
+	} {
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte("ip_address: x\nkeep_alive: 1m\ninterlocks:\n"+cfg), &node); err != nil {
+			t.Fatal(err)
+		}
+		if err := screenlogic.NewAdapter(devices.Options{}).UnmarshalYAML(node.Content[0]); err == nil {
+			t.Errorf("%v: expected an error", cfg)
+		}
+	}
+}
+
+func TestCircuitOperations(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\n", addr))
+	light := newCircuit(t, pa, "light", "circuit: Pool Light\nverify: 1s\n")
+
+	for _, want := range []bool{true, false} {
+		r, err := light.Toggle(ctx, devices.OperationArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := gw.Status().StatusForID(502); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got := fmt.Sprintf("%+v", r); got != fmt.Sprintf("{State:%v}", want) {
+			t.Errorf("got %v, want state %v", got, want)
+		}
+	}
+
+	// A toggle whose acknowledgement is lost, but that was acted on, is
+	// not retried since that would toggle the circuit back again.
+	if err := gw.Inject(simulator.Fault{Request: "ButtonPress", Count: 1, Drop: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pa.ToggleCircuit(ctx, 502); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+	if err := pa.SetCircuit(ctx, 502, false); err != nil {
+		t.Fatal(err)
+	}
+
+	gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+		for i := range st.Circuits {
+			if st.Circuits[i].ID == 502 {
+				st.Circuits[i].Delay = true
+			}
+		}
+	})
+	var out strings.Builder
+	r, err := light.Status(ctx, devices.OperationArgs{Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := screenlogic.CircuitInfo{ID: 502, Name: "Pool Light", Function: protocol.CircuitIntelliBrite, Interface: protocol.InterfaceLights, Delay: true}
+	if got := r.(screenlogic.CircuitInfo); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got, want := out.String(), "Pool Light (502): off, IntelliBrite, Lights, delayed\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := light.Pulse(ctx, devices.OperationArgs{Args: []string{"100ms"}}); err != nil {
+		t.Fatal(err)
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+	for _, args := range [][]string{nil, {"0s"}, {"soon"}} {
+		if _, err := light.Pulse(ctx, devices.OperationArgs{Args: args}); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	// Canceling a pulse turns the circuit off.
+	cctx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := light.Pulse(cctx, devices.OperationArgs{Args: []string{"1h"}})
+		errCh <- err
+	}()
+	for !gw.Status().StatusForID(502) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+
+	// A pulse whose "on" fails, but is acted on, still turns the circuit off.
+	if err := gw.Inject(simulator.Fault{Request: "ButtonPress", Count: 1, Drop: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := light.Pulse(ctx, devices.OperationArgs{Args: []string{"1h"}}); err == nil {
+		t.Errorf("expected an error")
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\ninterlocks:\n  - circuit: Cleaner\n    requires: Pool\n", addr))
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := screenlogic.ParseOps(cfg, "circuit Pool Light on; circuit 505 off\nsetpoint spa 102;heatmode spa solar preferred; lightmode party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := pa.Do(ctx, ops...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"circuit 502 (Pool Light) on: applied",
+		"circuit 505 (Pool) off: applied",
+		"spa heat set point 102: applied",
+		"spa heat mode Solar Preferred: applied",
+		"light mode Party: applied",
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.String())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	st := gw.Status()
+	spa, _ := st.Body(protocol.BodySpa)
+	if !st.StatusForID(502) || st.StatusForID(505) || spa.HeatSetPoint != 102 || spa.HeatMode != protocol.HeatModeSolarPreferred {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	// The batch stops at the first failure, here an interlock violation
+	// since Pool was turned off above.
+	var out strings.Builder
+	_, err = pa.Operations()["apply"](ctx, devices.OperationArgs{
+		Writer: &out,
+		Args:   strings.Fields("circuit 504 on; circuit Cleaner on; circuit 504 off"),
+	})
+	if !errors.Is(err, screenlogic.ErrInterlock) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if got, want := out.String(), `apply: circuit 504 (Waterfall) on: applied
+apply: circuit 501 (Cleaner) on: failed: circuit 501 (Cleaner) on: interlock violation: Cleaner requires Pool: Pool is off
+apply: circuit 504 (Waterfall) off: skipped
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !gw.Status().StatusForID(504) {
+		t.Errorf("circuit 504 should be on")
+	}
+
+	for _, script := range []string{
+		"",
+		"circuit 505",
+		"circuit Pool maybe",
+		"circuit Slide on",
+		"setpoint spa hot",
+		"setpoint hottub 100",
+		"heatmode spa sometimes",
+		"lightmode disco",
+		"reboot",
+	} {
+		if _, err := screenlogic.ParseOps(cfg, script); err == nil {
+			t.Errorf("%q: expected an error", script)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nrate_limit:\n  rate: 5\n  burst: 1\n  max_wait: 150ms\n", addr))
+
+	if err := pa.SetCircuit(ctx, 502, true); err != nil {
+		t.Fatal(err)
+	}
+	err := pa.SetCircuit(ctx, 504, true)
+	var rerr *screenlogic.RateLimitError
+	if !errors.As(err, &rerr) || !errors.Is(err, screenlogic.ErrRateLimited) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if rerr.Op != "set circuit 504 on" || rerr.Wait <= 150*time.Millisecond {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if gw.Status().StatusForID(504) {
+		t.Errorf("circuit 504 should be off")
+	}
+	// Commands that would wait for less than max_wait are delayed.
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := pa.SetCircuit(ctx, 504, true); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < 20*time.Millisecond {
+		t.Errorf("command was not delayed: %v", took)
+	}
+	// Reads are not rate limited.
+	if _, err := pa.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Each command in a batch takes a token.
+	time.Sleep(250 * time.Millisecond)
+	results, err := pa.Do(ctx, screenlogic.CircuitOp(505, true), screenlogic.HeatSetPointOp(protocol.BodySpa, 101), screenlogic.CircuitOp(502, false))
+	if !errors.As(err, &rerr) || rerr.Op != "spa heat set point 101" {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if got, want := []string{results[0].Status, results[1].Status, results[2].Status}, []string{"applied", "failed", "skipped"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if st := gw.Status(); !st.StatusForID(505) || !st.StatusForID(502) {
+		t.Errorf("circuits 502 and 505 should be on")
+	}
+	// The "off" at the end of a pulse is retried until a token is
+	// available.
+	time.Sleep(250 * time.Millisecond)
+	circuit := screenlogic.NewCircuit(devices.Options{})
+	circuit.DeviceConfigCustom.ID = 504
+	circuit.SetController(pa)
+	if _, err := circuit.Pulse(ctx, devices.OperationArgs{Args: []string{"10ms"}}); err != nil {
+		t.Fatal(err)
+	}
+	if gw.Status().StatusForID(504) {
+		t.Errorf("circuit 504 should be off")
+	}
+
+	// The session is released whilst a command is delayed, so that other
+	// requests are not blocked, and interlocks are checked against the
+	// status read once the command may be sent.
+	pa = newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nrate_limit:\n  rate: 2\n  burst: 1\n  max_wait: 1s\ninterlocks:\n  - circuit: Cleaner\n    requires: Pool\n", addr))
+	if err := pa.SetCircuit(ctx, 505, true); err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pa.SetCircuit(ctx, 501, true)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start = time.Now()
+	if _, err := pa.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 200*time.Millisecond {
+		t.Errorf("status request was blocked by a delayed command: %v", took)
+	}
+	if err := gw.SetCircuit(505, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; !errors.Is(err, screenlogic.ErrInterlock) || !strings.HasSuffix(err.Error(), "Pool is off") {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if gw.Status().StatusForID(501) {
+		t.Errorf("circuit 501 should be off")
+	}
+
+	pa = newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\ndebounce: 1h\n", addr))
+	setOff := func() {
+		gw.UpdateStatus(func(st *protocol.ControllerStatus) {
+			for i := range st.Circuits {
+				if st.Circuits[i].ID == 502 {
+					st.Circuits[i].State = false
+				}
+			}
+		})
+	}
+	for _, state := range []bool{true, true, false, true} {
+		setOff()
+		if err := pa.SetCircuit(ctx, 502, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setOff()
+	// The repeated command is dropped.
+	if err := pa.SetCircuit(ctx, 502, true); err != nil {
+		t.Fatal(err)
+	}
+	if gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be off")
+	}
+	// Toggle is not debounced.
+	if _, err := pa.ToggleCircuit(ctx, 502); err != nil {
+		t.Fatal(err)
+	}
+	if !gw.Status().StatusForID(502) {
+		t.Errorf("circuit 502 should be on")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf(`ip_address: %v
+keep_alive: 1m
+reconnect:
+  attempts: 2
+  backoff: 1ms
+  breaker_threshold: 2
+  probe_interval: 20ms
+`, addr))
+	health := func() screenlogic.Health {
+		r, err := pa.Operations()["health"](ctx, devices.OperationArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.(screenlogic.Health)
+	}
+
+	// Each connection is attempted twice and the breaker opens after
+	// two failed connections, the first probe fails too.
+	if err := gw.Inject(simulator.Fault{Request: "LocalLogin", Count: 5, Reset: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if _, err := pa.GetStatus(ctx); err == nil || errors.Is(err, screenlogic.ErrGatewayUnavailable) {
+			t.Fatalf("%v: missing or wrong error: %v", i, err)
+		}
+	}
+	if got, want := gw.Connections(), 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	start := time.Now()
+	if _, err := pa.GetStatus(ctx); !errors.Is(err, screenlogic.ErrGatewayUnavailable) {
+		t.Fatalf("missing or wrong error: %v", err)
+	}
+	if took := time.Since(start); took > 10*time.Millisecond {
+		t.Errorf("open breaker did not fail fast: %v", took)
+	}
+	if h := health(); h.Breaker != screenlogic.BreakerOpen || h.Failures != 2 || len(h.LastError) == 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+
+	// A successful probe half opens the breaker and the next successful
+	// connection closes it.
+	for health().Breaker != screenlogic.BreakerHalfOpen {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, want := gw.Connections(), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := pa.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if _, err := pa.Operations()["health"](ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if h := health(); h.Breaker != screenlogic.BreakerClosed || h.Failures != 0 || len(h.LastError) != 0 {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "health: breaker closed since ") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	gw, addr := startSimulator(t)
+	pa := newAdapter(t, fmt.Sprintf("ip_address: %v\nkeep_alive: 1m\nping_interval: 20ms\n", addr))
+	waitFor := func(done func(screenlogic.PingStats) bool) screenlogic.PingStats {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			ps := pa.Health().Ping
+			if done(ps) {
+				return ps
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out: %+v", ps)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if _, err := pa.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ps := waitFor(func(ps screenlogic.PingStats) bool { return ps.Pings >= 3 })
+	if ps.Failures != 0 || ps.Min <= 0 || ps.Min > ps.Mean || ps.Mean > ps.Max {
+		t.Errorf("unexpected stats: %+v", ps)
+	}
+
+	// A failed ping closes the connection, which is re-established by
+	// the next operation.
+	if err := gw.Inject(simulator.Fault{Request: "Ping", Count: 1, Drop: true}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func(ps screenlogic.PingStats) bool { return ps.Failures == 1 })
+	if _, err := pa.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gw.Connections(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var out strings.Builder
+	if _, err := pa.Operations()["health"](ctx, devices.OperationArgs{Writer: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, " failed, latency: last ") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
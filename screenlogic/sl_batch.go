@@ -0,0 +1,366 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// Op is a single change made as part of a batch, see Adapter.Do.
+type Op struct {
+	Description string // eg. "circuit 505 on".
+	apply       func(context.Context, *batch) error
+}
+
+// batch is the state shared by the ops of a batch.
+type batch struct {
+	pa   *Adapter
+	sess *protocol.Session
+	cfg  protocol.ControllerConfig  // Set if interlocks are configured.
+	st   *protocol.ControllerStatus // Updated as circuits are changed.
+}
+
+// CircuitOp returns an Op that turns the specified circuit on or off,
+// subject to AdapterConfig.Interlocks.
+func CircuitOp(id int, on bool) Op {
+	return circuitOp(fmt.Sprintf("circuit %v %v", id, circuitState[on]), id, on)
+}
+
+func circuitOp(desc string, id int, on bool) Op {
+	return Op{Description: desc, apply: func(ctx context.Context, b *batch) error {
+		return b.pa.setCircuit(ctx, b.sess, desc, b.cfg, b.st, id, on)
+	}}
+}
+
+// HeatSetPointOp returns an Op that sets the heat set point for the
+// specified body.
+func HeatSetPointOp(body protocol.BodyType, temp int) Op {
+	return Op{
+		Description: fmt.Sprintf("%v heat set point %v", strings.ToLower(body.String()), temp),
+		apply: func(ctx context.Context, b *batch) error {
+			return protocol.SetHeatSetPoint(ctx, b.sess, body, temp)
+		}}
+}
+
+// HeatModeOp returns an Op that sets the heat mode for the specified
+// body.
+func HeatModeOp(body protocol.BodyType, mode protocol.HeatMode) Op {
+	return Op{
+		Description: fmt.Sprintf("%v heat mode %v", strings.ToLower(body.String()), mode),
+		apply: func(ctx context.Context, b *batch) error {
+			return protocol.SetHeatMode(ctx, b.sess, body, mode)
+		}}
+}
+
+// LightModeOp returns an Op that sends the specified command to all of
+// the color lights.
+func LightModeOp(mode protocol.ColorMode) Op {
+	return Op{
+		Description: fmt.Sprintf("light mode %v", mode),
+		apply: func(ctx context.Context, b *batch) error {
+			return protocol.SendLightCommand(ctx, b.sess, mode)
+		}}
+}
+
+// OpResult records the outcome of a single Op.
+type OpResult struct {
+	Description string `json:"description"`
+	// Status is one of applied, failed or skipped, and for scenes,
+	// rolled back, rollback failed or not restored. The light mode
+	// cannot be restored since the controller does not report it.
+	Status string `json:"status"`
+	Err    error  `json:"-"` // Set for failed ops and failed rollbacks.
+}
+
+func (r OpResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%v: %v: %v", r.Description, r.Status, r.Err)
+	}
+	return fmt.Sprintf("%v: %v", r.Description, r.Status)
+}
+
+func newResults(ops []Op) []OpResult {
+	results := make([]OpResult, len(ops))
+	for i, op := range ops {
+		results[i] = OpResult{Description: op.Description, Status: "skipped"}
+	}
+	return results
+}
+
+// runner specifies how pa.run applies a list of ops, it is the only
+// means by which the Adapter changes the controller's state.
+type runner struct {
+	op string // Describes the run as a whole, eg. "apply scene party".
+	// ops returns the ops to apply given the controller's status at the
+	// start of the run.
+	ops func(protocol.ControllerStatus) []Op
+	// retry, if set, reports whether an op that failed with err should
+	// be retried once the others have been applied. Such ops are retried
+	// for as long as at least one of them is applied.
+	retry func(err error) bool
+	// rollback, if set, is called when an op fails, using the same
+	// session, with the status at the start of the run and the results
+	// so far, the last of which is for the failed op.
+	rollback func(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus, results []OpResult)
+}
+
+// execution is the state of a run, which may span several sessions
+// since the session is released whilst waiting for the rate limiter.
+type execution struct {
+	runner
+	pa      *Adapter
+	cfg     protocol.ControllerConfig
+	prior   *protocol.ControllerStatus // Recorded by the first session.
+	ops     []Op
+	pending []int   // The ops yet to be tried in this pass, in order.
+	refused []int   // The ops to be retried in the next pass.
+	errs    []error // The errors for the refused ops.
+	applied bool    // Set if an op was applied in this pass.
+	done    []bool
+	results []OpResult
+	limited bool  // Set if a token has been taken for pending[0].
+	wait    bool  // Set if the session was released to wait for a token.
+	err     error // Set if pending[0] was refused by the rate limiter.
+}
+
+// apply applies the pending ops using sess, returning with wait set if
+// the next op must wait for the rate limiter.
+func (e *execution) apply(ctx context.Context, sess *protocol.Session, st protocol.ControllerStatus) error {
+	if e.prior == nil {
+		prior := st.Clone()
+		e.prior = &prior
+		e.ops = e.runner.ops(prior)
+		e.errs = make([]error, len(e.ops))
+		e.done = make([]bool, len(e.ops))
+		e.pending = make([]int, len(e.ops))
+		for i := range e.ops {
+			e.pending[i] = i
+		}
+	}
+	e.wait = false
+	if e.err != nil {
+		return e.fail(ctx, sess, e.pending[0], e.err)
+	}
+	b := &batch{pa: e.pa, sess: sess, cfg: e.cfg, st: &st}
+	for {
+		if len(e.pending) == 0 {
+			if len(e.refused) == 0 {
+				return nil
+			}
+			if !e.applied {
+				for _, i := range e.refused {
+					e.record(i, "failed", e.errs[i])
+				}
+				return e.errs[e.refused[len(e.refused)-1]]
+			}
+			e.pending, e.refused, e.applied = e.refused, nil, false
+		}
+		i := e.pending[0]
+		if !e.limited && !e.pa.tryLimit() {
+			e.wait = true
+			return nil
+		}
+		e.limited = false
+		e.pending = e.pending[1:]
+		err := e.ops[i].apply(ctx, b)
+		switch {
+		case err == nil:
+			e.record(i, "applied", nil)
+			e.applied = true
+		case e.retry != nil && e.retry(err):
+			e.refused, e.errs[i] = append(e.refused, i), err
+		default:
+			return e.fail(ctx, sess, i, err)
+		}
+	}
+}
+
+func (e *execution) record(i int, status string, err error) {
+	e.results = append(e.results, OpResult{Description: e.ops[i].Description, Status: status, Err: err})
+	e.done[i] = true
+}
+
+// fail records the failure of op i and then, if required, rolls back
+// the run using sess.
+func (e *execution) fail(ctx context.Context, sess *protocol.Session, i int, err error) error {
+	e.record(i, "failed", err)
+	if e.rollback != nil {
+		e.rollback(ctx, sess, *e.prior, e.results)
+	}
+	return err
+}
+
+// skipped returns the results for every op, including those that were
+// not tried.
+func (e *execution) skipped() []OpResult {
+	for i, op := range e.ops {
+		if !e.done[i] {
+			e.results = append(e.results, OpResult{Description: op.Description, Status: "skipped"})
+			e.done[i] = true
+		}
+	}
+	return e.results
+}
+
+// run applies the ops specified by r, in order, stopping at the first one
+// that fails, and returns the results of every op and the error for the
+// failed one. The results are in the order in which the ops were applied,
+// followed by those that were skipped. The ops are applied using a single
+// session unless one of them must wait for AdapterConfig.RateLimit, in
+// which case the session is released whilst waiting and the status is
+// read again, and interlocks checked against it, before continuing.
+func (pa *Adapter) run(ctx context.Context, r runner) ([]OpResult, error) {
+	cfg, err := pa.interlockConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e := &execution{runner: r, pa: pa, cfg: cfg}
+	for {
+		err := pa.update(ctx, r.op, e.apply)
+		if err != nil || !e.wait {
+			return e.skipped(), err
+		}
+		i := e.pending[0]
+		if err := pa.limit(ctx, e.ops[i].Description); err != nil {
+			if e.rollback == nil {
+				e.pending = e.pending[1:]
+				e.record(i, "failed", err)
+				return e.skipped(), err
+			}
+			// Roll back using a new session.
+			e.err = err
+			continue
+		}
+		e.limited = true
+	}
+}
+
+// Do makes the specified changes, in order, using a single session and
+// stopping at the first one that fails, whose error is returned. The
+// returned results record the outcome of every op. Changes made before
+// a failure are not undone, see Scene for that. Each change is subject
+// to AdapterConfig.RateLimit, so that a large batch is paced rather
+// than sent all at once, and the session is released whilst waiting.
+func (pa *Adapter) Do(ctx context.Context, ops ...Op) ([]OpResult, error) {
+	descriptions := make([]string, len(ops))
+	for i, op := range ops {
+		descriptions[i] = op.Description
+	}
+	results, err := pa.run(ctx, runner{
+		op:  "batch: " + strings.Join(descriptions, "; "),
+		ops: func(protocol.ControllerStatus) []Op { return ops },
+	})
+	if err != nil {
+		ctxlog.Error(ctx, "screenlogic: batch failed", "ops", descriptions, "err", err)
+		return results, err
+	}
+	ctxlog.Info(ctx, "screenlogic: batch applied", "ops", descriptions)
+	return results, nil
+}
+
+// ParseOps parses a script of semicolon or newline separated statements
+// into a list of Ops, the supported statements are:
+//
+//	circuit <id or name> on|off
+//	setpoint pool|spa <temperature>
+//	heatmode pool|spa <mode>
+//	lightmode <mode>
+//
+// eg. "circuit 505 on; circuit Cleaner off; setpoint spa 102". The
+// controller's configuration is used to resolve circuit names.
+func ParseOps(cfg protocol.ControllerConfig, script string) ([]Op, error) {
+	var ops []Op
+	for i, stmt := range strings.FieldsFunc(script, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(stmt)
+		if len(fields) == 0 {
+			continue
+		}
+		op, err := parseOp(cfg, fields)
+		if err != nil {
+			return nil, fmt.Errorf("statement %v: %q: %w", i+1, strings.TrimSpace(stmt), err)
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no statements found")
+	}
+	return ops, nil
+}
+
+func parseOp(cfg protocol.ControllerConfig, fields []string) (Op, error) {
+	switch cmd, args := fields[0], fields[1:]; cmd {
+	case "circuit":
+		if len(args) < 2 {
+			return Op{}, fmt.Errorf("expected: circuit <id or name> on|off")
+		}
+		var on bool
+		switch state := args[len(args)-1]; state {
+		case "on", "off":
+			on = state == "on"
+		default:
+			return Op{}, fmt.Errorf("invalid circuit state: %q", state)
+		}
+		id, err := resolveRef(cfg, strings.Join(args[:len(args)-1], " "))
+		if err != nil {
+			return Op{}, err
+		}
+		return circuitOp(fmt.Sprintf("circuit %v (%v) %v", id, cfg.CircuitName(id), circuitState[on]), id, on), nil
+	case "setpoint", "heatmode":
+		if len(args) < 2 || (cmd == "setpoint" && len(args) != 2) {
+			return Op{}, fmt.Errorf("expected: %v pool|spa <value>", cmd)
+		}
+		body, err := protocol.ParseBodyType(args[0])
+		if err != nil {
+			return Op{}, err
+		}
+		if cmd == "heatmode" {
+			mode, err := protocol.ParseHeatMode(strings.Join(args[1:], " "))
+			if err != nil {
+				return Op{}, err
+			}
+			return HeatModeOp(body, mode), nil
+		}
+		temp, err := strconv.Atoi(args[1])
+		if err != nil {
+			return Op{}, fmt.Errorf("invalid temperature: %q", args[1])
+		}
+		return HeatSetPointOp(body, temp), nil
+	case "lightmode":
+		if len(args) == 0 {
+			return Op{}, fmt.Errorf("expected: lightmode <mode>")
+		}
+		mode, err := protocol.ParseColorMode(strings.Join(args, " "))
+		if err != nil {
+			return Op{}, err
+		}
+		return LightModeOp(mode), nil
+	}
+	return Op{}, fmt.Errorf("unknown statement: %q", fields[0])
+}
+
+func (pa *Adapter) apply(ctx context.Context, args devices.OperationArgs) (any, error) {
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := ParseOps(cfg, strings.Join(args.Args, " "))
+	if err != nil {
+		return nil, fmt.Errorf("apply: %w", err)
+	}
+	results, err := pa.Do(ctx, ops...)
+	if args.Writer != nil {
+		for _, r := range results {
+			fmt.Fprintf(args.Writer, "apply: %v\n", r)
+		}
+	}
+	return results, err
+}
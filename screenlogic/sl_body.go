@@ -0,0 +1,125 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+type BodyConfig struct {
+	Body string `yaml:"body"` // pool or spa.
+	// Verify, if set, is the time to wait for the controller's status
+	// to reflect a change to the body's heat set point or heat mode,
+	// an error is returned if it does not.
+	Verify time.Duration `yaml:"verify"`
+}
+
+func NewBody(_ devices.Options) *Body {
+	return &Body{}
+}
+
+// Body represents a body of water, ie. the pool or spa, and supports
+// setting its heat set point and heat mode.
+type Body struct {
+	devices.DeviceBase[BodyConfig]
+
+	adapter *Adapter
+	body    protocol.BodyType
+}
+
+func (b *Body) UnmarshalYAML(node *yaml.Node) error {
+	if err := node.Decode(&b.DeviceConfigCustom); err != nil {
+		return err
+	}
+	bt, err := protocol.ParseBodyType(b.DeviceConfigCustom.Body)
+	if err != nil {
+		return err
+	}
+	b.body = bt
+	return nil
+}
+
+func (b *Body) SetController(ctrl devices.Controller) {
+	b.adapter = ctrl.Implementation().(*Adapter)
+}
+
+func (b *Body) ControlledBy() devices.Controller {
+	return b.adapter
+}
+
+func (b *Body) OperationsHelp() map[string]string {
+	return map[string]string{
+		"setpoint": "set the heat set point, eg. setpoint 82",
+		"heatmode": "set the heat mode to one of off, solar, solar preferred or heater, eg. heatmode heater",
+	}
+}
+
+func (b *Body) Operations() map[string]devices.Operation {
+	return map[string]devices.Operation{
+		"setpoint": b.SetPoint,
+		"heatmode": b.HeatMode,
+	}
+}
+
+func (b *Body) verify(ctx context.Context, what string, done func(protocol.BodyStatus) bool) error {
+	verify := b.DeviceConfigCustom.Verify
+	if verify == 0 {
+		return nil
+	}
+	return b.adapter.VerifyBody(ctx, verify, b.body, what, done)
+}
+
+func (b *Body) SetPoint(ctx context.Context, args devices.OperationArgs) (any, error) {
+	if len(args.Args) != 1 {
+		return nil, fmt.Errorf("setpoint: expected a single temperature argument")
+	}
+	temp, err := strconv.Atoi(args.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("setpoint: invalid temperature: %q", args.Args[0])
+	}
+	if err := b.adapter.SetHeatSetPoint(ctx, b.body, temp); err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to set heat set point", "body", b.body, "temp", temp, "err", err)
+		return nil, err
+	}
+	if err := b.verify(ctx, fmt.Sprintf("heat set point %v", temp), func(bs protocol.BodyStatus) bool {
+		return bs.HeatSetPoint == temp
+	}); err != nil {
+		ctxlog.Error(ctx, "screenlogic: heat set point not verified", "body", b.body, "temp", temp, "err", err)
+		return nil, err
+	}
+	ctxlog.Info(ctx, "screenlogic: heat set point set", "body", b.body, "temp", temp)
+	return nil, nil
+}
+
+func (b *Body) HeatMode(ctx context.Context, args devices.OperationArgs) (any, error) {
+	name := strings.Join(args.Args, " ")
+	mode, err := protocol.ParseHeatMode(name)
+	if err != nil {
+		return nil, fmt.Errorf("heatmode: %w", err)
+	}
+	if err := b.adapter.SetHeatMode(ctx, b.body, mode); err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to set heat mode", "body", b.body, "mode", mode, "err", err)
+		return nil, err
+	}
+	if mode != protocol.HeatModeUnchanged {
+		if err := b.verify(ctx, fmt.Sprintf("heat mode %v", mode), func(bs protocol.BodyStatus) bool {
+			return bs.HeatMode == mode
+		}); err != nil {
+			ctxlog.Error(ctx, "screenlogic: heat mode not verified", "body", b.body, "mode", mode, "err", err)
+			return nil, err
+		}
+	}
+	ctxlog.Info(ctx, "screenlogic: heat mode set", "body", b.body, "mode", mode)
+	return nil, nil
+}
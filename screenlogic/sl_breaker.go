@@ -0,0 +1,267 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// ReconnectConfig specifies how failed connections to the adapter are
+// retried and when to stop trying, eg:
+//
+//	reconnect:
+//	  attempts: 3
+//	  backoff: 250ms
+//	  max_backoff: 5s
+//	  breaker_threshold: 3
+//	  probe_interval: 30s
+//
+// Each attempt to connect is retried, with exponential backoff and
+// jitter, up to Attempts times. Once BreakerThreshold consecutive
+// connections have failed the breaker opens and all operations fail
+// immediately with ErrGatewayUnavailable whilst the gateway is probed in
+// the background every ProbeInterval. Once a probe succeeds the next
+// operation is allowed to connect, closing the breaker if it succeeds
+// and reopening it otherwise. Rejected logins are neither retried nor
+// counted since they show that the gateway is reachable.
+type ReconnectConfig struct {
+	Attempts         int           `yaml:"attempts"`          // The default is 3.
+	Backoff          time.Duration `yaml:"backoff"`           // The default is 250ms.
+	MaxBackoff       time.Duration `yaml:"max_backoff"`       // The default is 5s.
+	BreakerThreshold int           `yaml:"breaker_threshold"` // The default is 3.
+	ProbeInterval    time.Duration `yaml:"probe_interval"`    // The default is 30s.
+}
+
+func (rc ReconnectConfig) withDefaults() ReconnectConfig {
+	if rc.Attempts <= 0 {
+		rc.Attempts = 3
+	}
+	if rc.Backoff <= 0 {
+		rc.Backoff = 250 * time.Millisecond
+	}
+	if rc.MaxBackoff <= 0 {
+		rc.MaxBackoff = 5 * time.Second
+	}
+	if rc.BreakerThreshold <= 0 {
+		rc.BreakerThreshold = 3
+	}
+	if rc.ProbeInterval <= 0 {
+		rc.ProbeInterval = 30 * time.Second
+	}
+	return rc
+}
+
+// backoff returns the delay before the specified retry, which doubles
+// with each retry up to max and is jittered to be between half of and
+// the full delay.
+func backoff(base, maxDelay time.Duration, retry int) time.Duration {
+	d := maxDelay
+	if retry < 32 && base<<retry < maxDelay {
+		d = base << retry
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// ErrGatewayUnavailable is returned whilst the breaker is open.
+var ErrGatewayUnavailable = errors.New("gateway unavailable")
+
+// BreakerState represents the state of the breaker that guards
+// connections to the adapter.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Connections are allowed.
+	BreakerOpen                         // Connections fail immediately.
+	BreakerHalfOpen                     // A probe succeeded, the next connection decides.
+)
+
+func (bs BreakerState) String() string {
+	switch bs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return ""
+}
+
+func (bs BreakerState) MarshalText() ([]byte, error) {
+	return []byte(bs.String()), nil
+}
+
+// Health represents the state of the connection to the adapter.
+type Health struct {
+	Breaker  BreakerState `json:"breaker"`
+	Failures int          `json:"failures"` // Consecutive failed connections.
+	// Since is when the breaker last changed state.
+	Since     time.Time    `json:"since"`
+	LastError string       `json:"last_error,omitempty"`
+	Stats     AdapterStats `json:"stats"`
+	Ping      PingStats    `json:"ping"`
+}
+
+// breaker guards connections to the adapter.
+type breaker struct {
+	cfg ReconnectConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	since    time.Time
+	lastErr  error
+	cancel   context.CancelFunc // Stops the background probe.
+}
+
+func newBreaker(cfg ReconnectConfig) *breaker {
+	return &breaker{cfg: cfg.withDefaults(), since: time.Now()}
+}
+
+func (b *breaker) setState(state BreakerState) {
+	if b.state != state {
+		b.state, b.since = state, time.Now()
+	}
+}
+
+// connect calls dial, retrying it with backoff, unless the breaker is
+// open. Whilst the breaker is half open dial is called once. Probe is
+// used to probe the gateway in the background if the breaker opens.
+func (b *breaker) connect(ctx context.Context, dial, probe func(context.Context) error) error {
+	b.mu.Lock()
+	state, failures, lastErr := b.state, b.failures, b.lastErr
+	b.mu.Unlock()
+	if state == BreakerOpen {
+		return fmt.Errorf("%w: %v consecutive connection failures: %w", ErrGatewayUnavailable, failures, lastErr)
+	}
+	attempts := b.cfg.Attempts
+	if state == BreakerHalfOpen {
+		attempts = 1
+	}
+	var err error
+	for attempt := range attempts {
+		if attempt > 0 {
+			delay := backoff(b.cfg.Backoff, b.cfg.MaxBackoff, attempt-1)
+			ctxlog.Info(ctx, "screenlogic: connect: retrying", "attempt", attempt, "delay", delay, "err", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		if err = dial(ctx); err == nil || errors.Is(err, protocol.ErrBadLogin) || ctx.Err() != nil {
+			break
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err == nil, errors.Is(err, protocol.ErrBadLogin):
+		if b.state != BreakerClosed {
+			ctxlog.Info(ctx, "screenlogic: breaker closed")
+		}
+		b.failures = 0
+		b.setState(BreakerClosed)
+	case ctx.Err() != nil:
+	default:
+		b.failures++
+		b.lastErr = err
+		if b.state == BreakerHalfOpen || b.failures >= b.cfg.BreakerThreshold {
+			b.open(ctx, probe)
+		}
+	}
+	return err
+}
+
+// open opens the breaker and starts probing the gateway, it must be
+// called with b.mu held.
+func (b *breaker) open(ctx context.Context, probe func(context.Context) error) {
+	ctxlog.Warn(ctx, "screenlogic: breaker opened", "failures", b.failures, "probe_interval", b.cfg.ProbeInterval, "err", b.lastErr)
+	b.setState(BreakerOpen)
+	if b.cancel != nil {
+		b.cancel()
+	}
+	ctx, b.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	go b.probe(ctx, probe)
+}
+
+// probe calls probe every ProbeInterval until it succeeds, at which
+// point the breaker is half opened, or ctx is canceled.
+func (b *breaker) probe(ctx context.Context, probe func(context.Context) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.cfg.ProbeInterval):
+		}
+		err := probe(ctx)
+		b.mu.Lock()
+		if ctx.Err() != nil {
+			b.mu.Unlock()
+			return
+		}
+		if err == nil {
+			ctxlog.Info(ctx, "screenlogic: probe succeeded, breaker half open")
+			b.setState(BreakerHalfOpen)
+			b.mu.Unlock()
+			return
+		}
+		b.lastErr = err
+		b.mu.Unlock()
+		ctxlog.Info(ctx, "screenlogic: probe failed", "err", err)
+	}
+}
+
+// close stops any background probe.
+func (b *breaker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+func (b *breaker) health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := Health{Breaker: b.state, Failures: b.failures, Since: b.since}
+	if b.lastErr != nil && b.state != BreakerClosed {
+		h.LastError = b.lastErr.Error()
+	}
+	return h
+}
+
+// Health returns the state of the breaker that guards connections to
+// the adapter, the adapter's operation and error counts and the latency
+// of the keepalive pings sent to it.
+func (pa *Adapter) Health() Health {
+	h := pa.breaker.health()
+	h.Stats = pa.Stats()
+	h.Ping = pa.pings.snapshot()
+	return h
+}
+
+func (pa *Adapter) health(_ context.Context, args devices.OperationArgs) (any, error) {
+	h := pa.Health()
+	if args.Writer != nil {
+		fmt.Fprintf(args.Writer, "health: breaker %v since %v, %v consecutive connection failures\n", h.Breaker, h.Since.Format(time.RFC3339), h.Failures)
+		if len(h.LastError) > 0 {
+			fmt.Fprintf(args.Writer, "health: last error: %v\n", h.LastError)
+		}
+		if p := h.Ping; p.Pings > 0 {
+			fmt.Fprintf(args.Writer, "health: %v pings, %v failed, latency: last %v, min %v, mean %v, max %v\n", p.Pings, p.Failures, p.Last, p.Min, p.Mean, p.Max)
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flight represents a request to the adapter that may be shared by
+// multiple callers.
+type flight[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// cached caches a value obtained from the adapter for a configurable
+// TTL. Concurrent callers that miss the cache share a single request
+// to the adapter, regardless of whether caching is enabled.
+type cached[T any] struct {
+	clone func(T) T
+
+	mu       sync.Mutex
+	value    T
+	expires  time.Time
+	gen      uint64 // Incremented by invalidate.
+	inflight *flight[T]
+}
+
+// get returns the cached value if it has not expired, or the result of
+// fetch otherwise. A ttl of zero disables caching. The request made by
+// fetch is shared by all of the callers that miss the cache whilst it
+// is in flight and so uses a context that is detached from that of the
+// caller that initiated it, with the specified timeout, whereas each
+// caller stops waiting for it when its own context is canceled.
+func (c *cached[T]) get(ctx context.Context, ttl, timeout time.Duration, stats *adapterStats, fetch func(context.Context) (T, error)) (T, error) {
+	c.mu.Lock()
+	if ttl > 0 && time.Now().Before(c.expires) {
+		v := c.clone(c.value)
+		c.mu.Unlock()
+		stats.cacheHits.Add(1)
+		return v, nil
+	}
+	if f := c.inflight; f != nil {
+		c.mu.Unlock()
+		stats.sharedRequests.Add(1)
+		return c.wait(ctx, f)
+	}
+	f := &flight[T]{done: make(chan struct{})}
+	c.inflight = f
+	gen := c.gen
+	c.mu.Unlock()
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		c.fetch(ctx, f, gen, ttl, fetch)
+	}()
+	return c.wait(ctx, f)
+}
+
+func (c *cached[T]) fetch(ctx context.Context, f *flight[T], gen uint64, ttl time.Duration, fetch func(context.Context) (T, error)) {
+	f.value, f.err = fetch(ctx)
+	c.mu.Lock()
+	if c.inflight == f {
+		c.inflight = nil
+	}
+	// Do not cache a value obtained before the cache was invalidated.
+	if f.err == nil && ttl > 0 && gen == c.gen {
+		c.value = f.value
+		c.expires = time.Now().Add(ttl)
+	}
+	c.mu.Unlock()
+	close(f.done)
+}
+
+func (c *cached[T]) wait(ctx context.Context, f *flight[T]) (T, error) {
+	select {
+	case <-f.done:
+		return c.clone(f.value), f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// invalidate discards the cached value and ensures that subsequent
+// callers do not share a request that was started before the call to
+// invalidate.
+func (c *cached[T]) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero T
+	c.value, c.expires, c.inflight = zero, time.Time{}, nil
+	c.gen++
+}
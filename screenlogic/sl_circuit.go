@@ -6,14 +6,28 @@ package screenlogic
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"cloudeng.io/logging/ctxlog"
 	"github.com/cosnicolaou/automation/devices"
 	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"gopkg.in/yaml.v3"
 )
 
+// CircuitConfig specifies a circuit by either its ID or its name, names
+// are resolved using the controller's configuration when the circuit
+// is first used, or when validated by ValidateSystem. The name
+// is specified as circuit: since name: is the name of the device.
 type CircuitConfig struct {
-	ID int `yaml:"id"`
+	ID   int    `yaml:"id"`
+	Name string `yaml:"circuit"`
+	// Verify, if set, is the time to wait for the controller's status
+	// to reflect a change to the circuit's state, an error is returned
+	// if it does not.
+	Verify time.Duration `yaml:"verify"`
 }
 
 func NewCircuit(_ devices.Options) *Circuit {
@@ -25,6 +39,20 @@ type Circuit struct {
 	devices.DeviceBase[CircuitConfig]
 
 	adapter *Adapter
+
+	mu sync.Mutex
+	id int // The resolved ID.
+}
+
+func (c *Circuit) UnmarshalYAML(node *yaml.Node) error {
+	if err := node.Decode(&c.DeviceConfigCustom); err != nil {
+		return err
+	}
+	cfg := c.DeviceConfigCustom
+	if (cfg.ID == 0) == (len(cfg.Name) == 0) {
+		return errors.New("exactly one of id or circuit must be specified")
+	}
+	return nil
 }
 
 func (c *Circuit) SetController(ctrl devices.Controller) {
@@ -37,15 +65,21 @@ func (c *Circuit) ControlledBy() devices.Controller {
 
 func (c *Circuit) OperationsHelp() map[string]string {
 	return map[string]string{
-		"on":  "turn the circuit on",
-		"off": "turn the circuit off",
+		"on":     "turn the circuit on",
+		"off":    "turn the circuit off",
+		"toggle": "turn the circuit on if it is off and vice versa",
+		"status": "get the circuit's state, function, interface and whether a change to it is delayed",
+		"pulse":  "turn the circuit on and then off again after the specified duration, eg. pulse 10m",
 	}
 }
 
 func (c *Circuit) Operations() map[string]devices.Operation {
 	return map[string]devices.Operation{
-		"on":  c.On,
-		"off": c.Off,
+		"on":     c.On,
+		"off":    c.Off,
+		"toggle": c.Toggle,
+		"status": c.Status,
+		"pulse":  c.Pulse,
 	}
 }
 
@@ -54,20 +88,64 @@ var circuitState = map[bool]string{
 	false: "off",
 }
 
-func (c *Circuit) setState(ctx context.Context, state bool) (any, error) {
-	ctx, sess, err := c.adapter.session(ctx)
+// ID returns the circuit's ID, resolving its name if necessary.
+func (c *Circuit) ID(ctx context.Context) (int, error) {
+	if id := c.DeviceConfigCustom.ID; id != 0 {
+		return id, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id != 0 {
+		return c.id, nil
+	}
+	cfg, err := c.adapter.GetConfig(ctx)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer sess.Release()
+	if err := c.resolve(cfg); err != nil {
+		return 0, err
+	}
+	return c.id, nil
+}
 
-	circuit := c.DeviceConfigCustom.ID
-	err = protocol.SetCircuitState(ctx, sess, circuit, state)
+// resolve resolves the circuit's name, or checks that its ID exists,
+// using the supplied configuration. It must be called with c.mu held.
+func (c *Circuit) resolve(cfg protocol.ControllerConfig) error {
+	id, err := resolveCircuit(cfg, c.Config().Name, c.DeviceConfigCustom.ID, c.DeviceConfigCustom.Name)
 	if err != nil {
-		ctxlog.Error(ctx, "screenlogic: failed to set circuit state", "op", circuitState[state], "circuit", circuit, "err", err)
-		return nil, err
+		return err
+	}
+	c.id = id
+	return nil
+}
+
+// change changes the circuit's state using set, which returns the
+// circuit's new state, and verifies the change if configured to do so.
+func (c *Circuit) change(ctx context.Context, op string, set func(ctx context.Context, id int) (bool, error)) (bool, error) {
+	circuit, err := c.ID(ctx)
+	if err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to resolve circuit", "op", op, "name", c.DeviceConfigCustom.Name, "err", err)
+		return false, err
+	}
+	state, err := set(ctx, circuit)
+	if err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to set circuit state", "op", op, "circuit", circuit, "err", err)
+		return false, err
 	}
-	ctxlog.Info(ctx, "screenlogic: circuit state set", "op", circuitState[state], "circuit", circuit)
+	if verify := c.DeviceConfigCustom.Verify; verify > 0 {
+		if err := c.adapter.VerifyCircuit(ctx, verify, circuit, state); err != nil {
+			ctxlog.Error(ctx, "screenlogic: circuit state not verified", "op", op, "circuit", circuit, "err", err)
+			return false, err
+		}
+	}
+	ctxlog.Info(ctx, "screenlogic: circuit state set", "op", op, "circuit", circuit, "state", circuitState[state])
+	return state, nil
+}
+
+func (c *Circuit) setState(ctx context.Context, state bool) (any, error) {
+	_, err := c.change(ctx, circuitState[state], func(ctx context.Context, id int) (bool, error) {
+		return state, c.adapter.SetCircuit(ctx, id, state)
+	})
 	return nil, err
 }
 
@@ -78,3 +156,120 @@ func (c *Circuit) On(ctx context.Context, _ devices.OperationArgs) (any, error)
 func (c *Circuit) Off(ctx context.Context, _ devices.OperationArgs) (any, error) {
 	return c.setState(ctx, false)
 }
+
+func (c *Circuit) Toggle(ctx context.Context, args devices.OperationArgs) (any, error) {
+	state, err := c.change(ctx, "toggle", c.adapter.ToggleCircuit)
+	if err != nil {
+		return nil, err
+	}
+	if args.Writer != nil {
+		fmt.Fprintf(args.Writer, "toggle: %v\n", circuitState[state])
+	}
+	return struct {
+		State bool `json:"state"`
+	}{State: state}, nil
+}
+
+// CircuitInfo is returned by the circuit status operation.
+type CircuitInfo struct {
+	ID        int                       `json:"id"`
+	Name      string                    `json:"name"`
+	State     bool                      `json:"state"`
+	Function  protocol.CircuitFunction  `json:"function"`
+	Interface protocol.CircuitInterface `json:"interface"`
+	// Delay is true if a change to the circuit's state is pending, eg.
+	// whilst a heater cools down.
+	Delay bool `json:"delay"`
+}
+
+func (c *Circuit) Status(ctx context.Context, args devices.OperationArgs) (any, error) {
+	id, err := c.ID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := c.adapter.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st, err := c.adapter.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ckt := cfg.CircuitByID(id)
+	info := CircuitInfo{ID: id, Name: ckt.Name, Function: ckt.Function, Interface: ckt.Interface}
+	for _, cs := range st.Circuits {
+		if cs.ID == id {
+			info.State, info.Delay = cs.State, cs.Delay
+		}
+	}
+	if args.Writer != nil {
+		delay := ""
+		if info.Delay {
+			delay = ", delayed"
+		}
+		fmt.Fprintf(args.Writer, "%v (%v): %v, %v, %v%v\n", info.Name, info.ID, circuitState[info.State], info.Function, info.Interface, delay)
+	}
+	return info, nil
+}
+
+// pulseOffTimeout is the time allowed for turning a circuit off at the
+// end of a pulse.
+var pulseOffTimeout = time.Minute
+
+// Pulse turns the circuit on and then off again after the specified
+// duration, eg. "pulse 30s". The circuit is turned off if the pulse is
+// canceled, or if turning it on fails, since the controller may still
+// have acted on the command.
+func (c *Circuit) Pulse(ctx context.Context, args devices.OperationArgs) (any, error) {
+	if len(args.Args) != 1 {
+		return nil, fmt.Errorf("pulse: expected a single duration argument")
+	}
+	d, err := time.ParseDuration(args.Args[0])
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("pulse: invalid duration: %q", args.Args[0])
+	}
+	if _, err := c.setState(ctx, true); err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			// The command was not sent.
+			return nil, err
+		}
+		ctxlog.Info(ctx, "screenlogic: pulse failed, turning circuit off", "name", c.Config().Name, "err", err)
+		if oerr := c.pulseOff(ctx); oerr != nil {
+			return nil, errors.Join(err, oerr)
+		}
+		return nil, err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil, c.pulseOff(ctx)
+	case <-ctx.Done():
+	}
+	ctxlog.Info(ctx, "screenlogic: pulse canceled, turning circuit off", "name", c.Config().Name, "err", ctx.Err())
+	if err := c.pulseOff(ctx); err != nil {
+		return nil, errors.Join(ctx.Err(), err)
+	}
+	return nil, ctx.Err()
+}
+
+// pulseOff turns the circuit off, using a context that is not canceled
+// along with ctx, retrying for up to pulseOffTimeout whilst the command
+// is refused by the rate limiter.
+func (c *Circuit) pulseOff(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pulseOffTimeout)
+	defer cancel()
+	for {
+		_, err := c.setState(ctx, false)
+		var rerr *RateLimitError
+		if !errors.As(err, &rerr) {
+			return err
+		}
+		ctxlog.Info(ctx, "screenlogic: pulse: retrying off", "name", c.Config().Name, "wait", rerr.Wait)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(rerr.Wait):
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/net/netutil"
+	"github.com/cosnicolaou/automation/net/streamconn"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// ErrNotConnected is returned when an operation is attempted on a
+// connection that has failed and not yet been re-established.
+var ErrNotConnected = errors.New("not connected")
+
+// transportError wraps an error returned by the underlying transport.
+type transportError struct {
+	err error
+}
+
+func (te *transportError) Error() string {
+	return te.err.Error()
+}
+
+func (te *transportError) Unwrap() error {
+	return te.err
+}
+
+// isTransportError returns true if err was returned by the underlying
+// transport, ie. the connection to the adapter has failed.
+func isTransportError(err error) bool {
+	var te *transportError
+	return errors.As(err, &te)
+}
+
+// adapterConn is the connection managed by the on demand connection.
+// It closes the underlying transport when it returns an error and
+// re-establishes it, via reconnect, the next time a session is
+// created. This avoids reusing a connection that is no longer
+// synchronized with the adapter, eg. after a timeout or a truncated
+// response.
+type adapterConn struct {
+	pa   *Adapter
+	idle netutil.IdleReset
+
+	reconnectMu sync.Mutex // serializes reconnects.
+
+	mu         sync.Mutex
+	conn       streamconn.Transport // nil when the connection has failed.
+	stopPinger context.CancelFunc
+}
+
+// connect dials and logs in to the adapter, subject to the retries and
+// breaker specified by AdapterConfig.Reconnect.
+func (ac *adapterConn) connect(ctx context.Context) error {
+	return ac.pa.breaker.connect(ctx, func(ctx context.Context) error {
+		conn, err := ac.login(ctx)
+		if err != nil {
+			return err
+		}
+		ac.pa.stats.connects.Add(1)
+		ac.mu.Lock()
+		defer ac.mu.Unlock()
+		ac.conn = conn
+		return nil
+	}, ac.probe)
+}
+
+// probe checks that the adapter can be connected to and logged in to.
+func (ac *adapterConn) probe(ctx context.Context) error {
+	conn, err := ac.login(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close(ctx)
+}
+
+// login dials and logs in to the adapter.
+func (ac *adapterConn) login(ctx context.Context) (streamconn.Transport, error) {
+	conn, err := ac.pa.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, s := ac.pa.mgr.NewWithContext(ctx, conn, ac.idle)
+	session := protocol.NewSession(s)
+	defer session.Release()
+
+	// Connect, there is no authentication for the screenlogic adapters
+	// on a local network.
+	ctxlog.Info(ctx, "screenlogic: connect: logging in", "ip", ac.pa.ControllerConfigCustom.IPAddress)
+	if err := protocol.Login(ctx, session); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	ctxlog.Info(ctx, "screenlogic: connect: logged in", "ip", ac.pa.ControllerConfigCustom.IPAddress)
+	return conn, nil
+}
+
+// reconnect re-establishes the connection if it has failed.
+func (ac *adapterConn) reconnect(ctx context.Context) error {
+	ac.reconnectMu.Lock()
+	defer ac.reconnectMu.Unlock()
+	if _, err := ac.transport(); err == nil {
+		return nil
+	}
+	ctxlog.Info(ctx, "screenlogic: reconnecting", "ip", ac.pa.ControllerConfigCustom.IPAddress)
+	ac.pa.stats.reconnects.Add(1)
+	return ac.connect(ctx)
+}
+
+func (ac *adapterConn) transport() (streamconn.Transport, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return ac.conn, nil
+}
+
+// failed closes the supplied transport if it is still the current one.
+func (ac *adapterConn) failed(ctx context.Context, conn streamconn.Transport, err error) error {
+	ac.mu.Lock()
+	current := ac.conn == conn
+	if current {
+		ac.conn = nil
+	}
+	ac.mu.Unlock()
+	if current {
+		ctxlog.Warn(ctx, "screenlogic: connection failed, closing", "ip", ac.pa.ControllerConfigCustom.IPAddress, "err", err)
+		conn.Close(ctx)
+	}
+	return &transportError{err: err}
+}
+
+func (ac *adapterConn) Send(ctx context.Context, buf []byte) (int, error) {
+	conn, err := ac.transport()
+	if err != nil {
+		return -1, &transportError{err: err}
+	}
+	n, err := conn.Send(ctx, buf)
+	if err != nil {
+		return n, ac.failed(ctx, conn, err)
+	}
+	return n, nil
+}
+
+func (ac *adapterConn) SendSensitive(ctx context.Context, buf []byte) (int, error) {
+	conn, err := ac.transport()
+	if err != nil {
+		return -1, &transportError{err: err}
+	}
+	n, err := conn.SendSensitive(ctx, buf)
+	if err != nil {
+		return n, ac.failed(ctx, conn, err)
+	}
+	return n, nil
+}
+
+func (ac *adapterConn) ReadUntil(ctx context.Context, expected []string) ([]byte, error) {
+	conn, err := ac.transport()
+	if err != nil {
+		return nil, &transportError{err: err}
+	}
+	buf, err := conn.ReadUntil(ctx, expected)
+	if err != nil {
+		return nil, ac.failed(ctx, conn, err)
+	}
+	return buf, nil
+}
+
+func (ac *adapterConn) Close(ctx context.Context) error {
+	ac.mu.Lock()
+	conn := ac.conn
+	ac.conn = nil
+	if ac.stopPinger != nil {
+		ac.stopPinger()
+	}
+	ac.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close(ctx)
+}
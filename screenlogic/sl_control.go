@@ -0,0 +1,144 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// update checks the controller's state and then calls fn, using the
+// same session and with the status used for that check, to send the
+// commands described by op. Commands are refused with a StateError
+// whilst the controller is in service mode and are deferred, for up to
+// AdapterConfig.SyncWait, whilst it is in the sync state. The cached
+// status is invalidated regardless of whether fn succeeds since a failed
+// request may still have been acted on by the controller. Commands are
+// only sent via pa.run, which applies AdapterConfig.RateLimit.
+func (pa *Adapter) update(ctx context.Context, op string, fn func(context.Context, *protocol.Session, protocol.ControllerStatus) error) error {
+	defer pa.status.invalidate()
+	deadline := time.Now().Add(pa.syncWait())
+	for {
+		var state protocol.ControllerState
+		err := pa.withSession(ctx, false, func(ctx context.Context, sess *protocol.Session) error {
+			st, err := protocol.GetControllerStatus(ctx, sess)
+			if err != nil {
+				return err
+			}
+			state = st.State
+			if state == protocol.ControllerService || state == protocol.ControllerSync {
+				return nil
+			}
+			return fn(ctx, sess, st)
+		})
+		if err != nil {
+			pa.debouncer.reset()
+			return err
+		}
+		switch state {
+		case protocol.ControllerService:
+			ctxlog.Warn(ctx, "screenlogic: command refused: controller is in service mode", "op", op)
+			return &StateError{Op: op, State: state}
+		case protocol.ControllerSync:
+			if time.Now().Add(syncRetryInterval).After(deadline) {
+				ctxlog.Warn(ctx, "screenlogic: command refused: controller is still syncing", "op", op, "waited", pa.syncWait())
+				return &StateError{Op: op, State: state}
+			}
+			ctxlog.Info(ctx, "screenlogic: command deferred: controller is syncing", "op", op)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%v: %w", op, ctx.Err())
+			case <-time.After(syncRetryInterval):
+			}
+			continue
+		}
+		return nil
+	}
+}
+
+// interlockConfig returns the controller's configuration if interlocks
+// are configured. It must be called before update since only one session
+// may be in use at a time.
+func (pa *Adapter) interlockConfig(ctx context.Context) (protocol.ControllerConfig, error) {
+	if len(pa.interlocks) == 0 {
+		return protocol.ControllerConfig{}, nil
+	}
+	return pa.GetConfig(ctx)
+}
+
+// setCircuit turns the specified circuit on or off, using an existing
+// session, if doing so does not violate AdapterConfig.Interlocks given
+// the status st, which is updated to reflect the change.
+func (pa *Adapter) setCircuit(ctx context.Context, sess *protocol.Session, op string, cfg protocol.ControllerConfig, st *protocol.ControllerStatus, id int, on bool) error {
+	if err := pa.checkInterlocks(ctx, op, cfg, id, on, *st); err != nil {
+		return err
+	}
+	if err := protocol.SetCircuitState(ctx, sess, id, on); err != nil {
+		return err
+	}
+	pa.debouncer.record(id, on, time.Now())
+	for i := range st.Circuits {
+		if st.Circuits[i].ID == id {
+			st.Circuits[i].State = on
+		}
+	}
+	return nil
+}
+
+// SetCircuit turns the specified circuit on or off, subject to
+// AdapterConfig.Interlocks. A command that repeats the most recent one
+// for the circuit within AdapterConfig.Debounce is dropped.
+func (pa *Adapter) SetCircuit(ctx context.Context, id int, on bool) error {
+	op := fmt.Sprintf("set circuit %v %v", id, circuitState[on])
+	if pa.debounced(ctx, op, id, on) {
+		return nil
+	}
+	return pa.runOne(ctx, op, circuitOp(op, id, on))
+}
+
+// ToggleCircuit turns the specified circuit on if it is off and vice
+// versa, subject to AdapterConfig.Interlocks, and returns its new state.
+func (pa *Adapter) ToggleCircuit(ctx context.Context, id int) (bool, error) {
+	var on bool
+	op := fmt.Sprintf("toggle circuit %v", id)
+	err := pa.runOne(ctx, op, Op{Description: op, apply: func(ctx context.Context, b *batch) error {
+		on = !b.st.StatusForID(id)
+		return pa.setCircuit(ctx, b.sess, fmt.Sprintf("set circuit %v %v", id, circuitState[on]), b.cfg, b.st, id, on)
+	}})
+	return on, err
+}
+
+// SetHeatSetPoint sets the heat set point for the specified body.
+func (pa *Adapter) SetHeatSetPoint(ctx context.Context, body protocol.BodyType, temp int) error {
+	return pa.updateOne(ctx, HeatSetPointOp(body, temp))
+}
+
+// SetHeatMode sets the heat mode for the specified body.
+func (pa *Adapter) SetHeatMode(ctx context.Context, body protocol.BodyType, mode protocol.HeatMode) error {
+	return pa.updateOne(ctx, HeatModeOp(body, mode))
+}
+
+// SetLightMode sends the specified command to all of the color lights.
+func (pa *Adapter) SetLightMode(ctx context.Context, mode protocol.ColorMode) error {
+	return pa.updateOne(ctx, LightModeOp(mode))
+}
+
+// updateOne applies a single Op that is not subject to interlocks.
+func (pa *Adapter) updateOne(ctx context.Context, op Op) error {
+	return pa.runOne(ctx, "set "+op.Description, op)
+}
+
+// runOne applies a single Op, op describes the command for logging.
+func (pa *Adapter) runOne(ctx context.Context, op string, o Op) error {
+	_, err := pa.run(ctx, runner{
+		op:  op,
+		ops: func(protocol.ControllerStatus) []Op { return []Op{o} },
+	})
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// deviceName returns a device name, eg. pool-light, for the supplied
+// name, eg. Pool Light.
+func deviceName(name string) string {
+	var out strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && out.Len() > 0 {
+				out.WriteByte('-')
+			}
+			out.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return out.String()
+}
+
+type deviceExporter struct {
+	controller string
+	names      map[string]bool
+	seq        yaml.Node
+}
+
+func scalar(v string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: v}
+}
+
+// add appends a device whose name is derived from name, suffixed with
+// suffix if that name is already in use, and whose type specific
+// configuration is given by kv as key, value pairs.
+func (de *deviceExporter) add(comment, name, suffix, typ string, kv ...*yaml.Node) {
+	name = deviceName(name)
+	if len(name) == 0 || de.names[name] {
+		name = strings.TrimPrefix(name+"-"+suffix, "-")
+	}
+	de.names[name] = true
+	dev := &yaml.Node{Kind: yaml.MappingNode, HeadComment: comment}
+	dev.Content = append(dev.Content,
+		scalar("name"), scalar(name),
+		scalar("type"), scalar(typ),
+		scalar("controller"), scalar(de.controller))
+	dev.Content = append(dev.Content, kv...)
+	de.seq.Content = append(de.seq.Content, dev)
+}
+
+// ExportDevices writes a YAML devices: specification for all of the
+// visible circuits, bodies and pumps in the supplied configuration,
+// for use with the named controller. Bodies are inferred from the
+// presence of pool and spa circuits. Circuits are grouped by their
+// interface, those on the lights interface are exported as lights and
+// the remainder as circuits. Circuits are referred to by name unless
+// that name is not unique.
+func ExportDevices(out io.Writer, controller string, cfg protocol.ControllerConfig) error {
+	de := &deviceExporter{
+		controller: controller,
+		names:      map[string]bool{},
+		seq:        yaml.Node{Kind: yaml.SequenceNode},
+	}
+	circuitNames := map[string]int{}
+	bodies := map[protocol.BodyType]bool{}
+	for _, c := range cfg.Circuits {
+		circuitNames[c.Name]++
+		switch c.Function {
+		case protocol.CircuitPool, protocol.CircuitSecondPool:
+			bodies[protocol.BodyPool] = true
+		case protocol.CircuitSpa, protocol.CircuitSecondSpa:
+			bodies[protocol.BodySpa] = true
+		}
+	}
+	interfaces := []protocol.CircuitInterface{
+		protocol.InterfacePool,
+		protocol.InterfaceSpa,
+		protocol.InterfaceFeatures,
+		protocol.InterfaceSyncSwim,
+		protocol.InterfaceLights,
+	}
+	for _, ifc := range interfaces {
+		comment := ifc.String()
+		for _, c := range cfg.Circuits {
+			if c.Interface != ifc {
+				continue
+			}
+			id := strconv.Itoa(c.ID)
+			ref := []*yaml.Node{scalar("circuit"), scalar(c.Name)}
+			if circuitNames[c.Name] > 1 || len(c.Name) == 0 {
+				ref = []*yaml.Node{scalar("id"), scalar(id)}
+			} else {
+				ref[1].LineComment = "id " + id
+			}
+			typ := "circuit"
+			if ifc == protocol.InterfaceLights {
+				typ = "light"
+			}
+			de.add(comment, c.Name, id, typ, ref...)
+			comment = ""
+		}
+	}
+	comment := "Bodies"
+	for _, bt := range []protocol.BodyType{protocol.BodyPool, protocol.BodySpa} {
+		if !bodies[bt] {
+			continue
+		}
+		name := strings.ToLower(bt.String())
+		de.add(comment, name+" heater", "", "body", scalar("body"), scalar(name))
+		comment = ""
+	}
+	comment = "Pumps"
+	for _, p := range cfg.IntelliFlo {
+		idx := strconv.Itoa(p.Index)
+		de.add(comment, "pump "+idx, "", "pump", scalar("index"), scalar(idx))
+		comment = ""
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("devices"), &de.seq}}
+	doc.HeadComment = fmt.Sprintf("Devices for the %v controller %v.", cfg.Model, cfg.ID)
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("exportDevices: %w", err)
+	}
+	return enc.Close()
+}
+
+func (pa *Adapter) exportDevices(ctx context.Context, args devices.OperationArgs) (any, error) {
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out strings.Builder
+	if err := ExportDevices(&out, pa.Config().Name, cfg); err != nil {
+		return nil, err
+	}
+	if args.Writer != nil {
+		io.WriteString(args.Writer, out.String())
+	}
+	return out.String(), nil
+}
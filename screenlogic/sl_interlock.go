@@ -0,0 +1,239 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// InterlockConfig specifies a rule that constrains when a circuit may be
+// turned on, exactly one of Requires, Excludes or During must be set.
+// Circuits are specified by name or ID, eg:
+//
+//	interlocks:
+//	  - circuit: Booster
+//	    requires: Pool
+//	  - circuit: Spa Heater
+//	    excludes: Cover
+//	  - circuit: Pool Light
+//	    during: 18:00-06:00
+//
+// A circuit that requires another cannot be turned on unless the other
+// is on, and the other cannot be turned off whilst it is on. A circuit
+// that excludes another cannot be turned on whilst the other is on, and
+// vice versa. A circuit with a time window, which may span midnight,
+// can only be turned on during that window. Interlocks apply to all
+// circuit changes made via the Adapter, including those made by scenes
+// and when restoring snapshots, but not to the rollback of a scene.
+type InterlockConfig struct {
+	Circuit  string `yaml:"circuit"`
+	Requires string `yaml:"requires"`
+	Excludes string `yaml:"excludes"`
+	During   string `yaml:"during"`
+}
+
+func (ic InterlockConfig) String() string {
+	switch {
+	case len(ic.Requires) > 0:
+		return fmt.Sprintf("%v requires %v", ic.Circuit, ic.Requires)
+	case len(ic.Excludes) > 0:
+		return fmt.Sprintf("%v excludes %v", ic.Circuit, ic.Excludes)
+	}
+	return fmt.Sprintf("%v only during %v", ic.Circuit, ic.During)
+}
+
+// ErrInterlock is returned, wrapped in an InterlockError, for changes to
+// circuits that would violate an interlock.
+var ErrInterlock = errors.New("interlock violation")
+
+// InterlockError is returned when changing a circuit would violate an
+// interlock.
+type InterlockError struct {
+	Op     string          // The refused command, eg. "set circuit 502 on".
+	Rule   InterlockConfig // The rule that would be violated.
+	Reason string          // eg. "Pool is off".
+}
+
+func (e *InterlockError) Error() string {
+	return fmt.Sprintf("%v: %v: %v: %v", e.Op, ErrInterlock, e.Rule, e.Reason)
+}
+
+func (e *InterlockError) Unwrap() error {
+	return ErrInterlock
+}
+
+// timeWindow is a time of day window, in minutes since midnight, that
+// spans midnight if start is after end.
+type timeWindow struct {
+	start, end int
+}
+
+func parseTimeOfDay(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseTimeWindow(v string) (timeWindow, error) {
+	from, to, ok := strings.Cut(v, "-")
+	if !ok {
+		return timeWindow{}, fmt.Errorf("invalid time window: %q, expected hh:mm-hh:mm", v)
+	}
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	return timeWindow{start: start, end: end}, nil
+}
+
+func (tw timeWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if tw.start <= tw.end {
+		return m >= tw.start && m < tw.end
+	}
+	return m >= tw.start || m < tw.end
+}
+
+// interlock is a parsed InterlockConfig.
+type interlock struct {
+	InterlockConfig
+	window timeWindow
+}
+
+func parseInterlocks(cfgs []InterlockConfig) ([]interlock, error) {
+	interlocks := make([]interlock, len(cfgs))
+	for i, ic := range cfgs {
+		n := 0
+		for _, v := range []string{ic.Requires, ic.Excludes, ic.During} {
+			if len(v) > 0 {
+				n++
+			}
+		}
+		if len(ic.Circuit) == 0 || n != 1 {
+			return nil, fmt.Errorf("interlock %v: a circuit and exactly one of requires, excludes or during must be specified", i)
+		}
+		interlocks[i].InterlockConfig = ic
+		if len(ic.During) > 0 {
+			tw, err := parseTimeWindow(ic.During)
+			if err != nil {
+				return nil, fmt.Errorf("interlock %v: %w", i, err)
+			}
+			interlocks[i].window = tw
+		}
+	}
+	return interlocks, nil
+}
+
+// resolveRef resolves a circuit specified by name or ID.
+func resolveRef(cfg protocol.ControllerConfig, ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return resolveCircuit(cfg, "interlocks", id, "")
+	}
+	return resolveCircuit(cfg, "interlocks", 0, ref)
+}
+
+// validateInterlocks checks that all of the circuits referred to by the
+// interlocks exist. It is called by ValidateDevices so that interlocks
+// that cannot be resolved are reported at startup, checkInterlocks
+// ignores those that do not involve the circuit being changed.
+func (pa *Adapter) validateInterlocks(cfg protocol.ControllerConfig) error {
+	var errs []error
+	for _, il := range pa.interlocks {
+		for _, ref := range il.refs() {
+			if _, err := resolveRef(cfg, ref); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refs returns the circuits referred to by the interlock.
+func (il interlock) refs() []string {
+	if len(il.Requires) > 0 {
+		return []string{il.Circuit, il.Requires}
+	}
+	if len(il.Excludes) > 0 {
+		return []string{il.Circuit, il.Excludes}
+	}
+	return []string{il.Circuit}
+}
+
+func (pa *Adapter) now() time.Time {
+	if loc := pa.System().Location.TimeLocation; loc != nil {
+		return time.Now().In(loc)
+	}
+	return time.Now()
+}
+
+// checkInterlocks returns an InterlockError if turning the specified
+// circuit on or off would violate an interlock given the current status.
+// An interlock that refers to a circuit unknown to the controller is
+// ignored, having been reported by validateInterlocks, unless one of the
+// circuits it does refer to is the one being changed, in which case the
+// change is refused since the interlock cannot be checked.
+func (pa *Adapter) checkInterlocks(ctx context.Context, op string, cfg protocol.ControllerConfig, id int, on bool, st protocol.ControllerStatus) error {
+	for _, il := range pa.interlocks {
+		refs := il.refs()
+		ids := make([]int, len(refs))
+		var unknown string
+		for i, ref := range refs {
+			ids[i], _ = resolveRef(cfg, ref)
+			if ids[i] == 0 && len(unknown) == 0 {
+				unknown = ref
+			}
+		}
+		var reason string
+		switch {
+		case len(unknown) > 0:
+			if !slices.Contains(ids, id) {
+				ctxlog.Warn(ctx, "screenlogic: interlock ignored: unknown circuit", "op", op, "rule", il.InterlockConfig.String(), "circuit", unknown)
+				continue
+			}
+			reason = unknown + " is not known to the controller"
+		case len(il.Requires) > 0:
+			a, b := ids[0], ids[1]
+			switch {
+			case on && id == a && !st.StatusForID(b):
+				reason = il.Requires + " is off"
+			case !on && id == b && st.StatusForID(a):
+				reason = il.Circuit + " is on"
+			}
+		case len(il.Excludes) > 0:
+			a, b := ids[0], ids[1]
+			switch {
+			case on && id == a && st.StatusForID(b):
+				reason = il.Excludes + " is on"
+			case on && id == b && st.StatusForID(a):
+				reason = il.Circuit + " is on"
+			}
+		default:
+			if now := pa.now(); on && id == ids[0] && !il.window.contains(now) {
+				reason = "it is " + now.Format("15:04")
+			}
+		}
+		if len(reason) > 0 {
+			err := &InterlockError{Op: op, Rule: il.InterlockConfig, Reason: reason}
+			ctxlog.Warn(ctx, "screenlogic: command refused: interlock", "op", op, "rule", il.InterlockConfig.String(), "reason", reason)
+			return err
+		}
+	}
+	return nil
+}
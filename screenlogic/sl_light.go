@@ -0,0 +1,50 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+func NewLight(_ devices.Options) *Light {
+	return &Light{}
+}
+
+// Light is a circuit that controls a light and that, in addition to
+// being turned on and off, supports the color light commands.
+type Light struct {
+	Circuit
+}
+
+func (l *Light) OperationsHelp() map[string]string {
+	help := l.Circuit.OperationsHelp()
+	help["mode"] = "send a command, eg. party or all off, to all of the color lights, not just this one"
+	return help
+}
+
+func (l *Light) Operations() map[string]devices.Operation {
+	ops := l.Circuit.Operations()
+	ops["mode"] = l.Mode
+	return ops
+}
+
+func (l *Light) Mode(ctx context.Context, args devices.OperationArgs) (any, error) {
+	mode, err := protocol.ParseColorMode(strings.Join(args.Args, " "))
+	if err != nil {
+		return nil, fmt.Errorf("mode: %w", err)
+	}
+	if err := l.adapter.SetLightMode(ctx, mode); err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to set light mode", "mode", mode, "err", err)
+		return nil, err
+	}
+	ctxlog.Info(ctx, "screenlogic: light mode set", "mode", mode)
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// PingStats records the outcome and latency of the keepalive pings
+// sent to the adapter.
+type PingStats struct {
+	Pings    int64         `json:"pings"`
+	Failures int64         `json:"failures"`
+	Last     time.Duration `json:"last"` // Latency of the most recent successful ping.
+	Min      time.Duration `json:"min"`
+	Max      time.Duration `json:"max"`
+	Mean     time.Duration `json:"mean"`
+}
+
+type pingStats struct {
+	mu    sync.Mutex
+	stats PingStats
+	total time.Duration
+}
+
+func (ps *pingStats) record(latency time.Duration, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	s := &ps.stats
+	s.Pings++
+	if err != nil {
+		s.Failures++
+		return
+	}
+	ok := s.Pings - s.Failures
+	if ok == 1 || latency < s.Min {
+		s.Min = latency
+	}
+	s.Max = max(s.Max, latency)
+	s.Last = latency
+	ps.total += latency
+	s.Mean = ps.total / time.Duration(ok)
+}
+
+func (ps *pingStats) snapshot() PingStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.stats
+}
+
+// noIdleReset is used for the sessions used to send pings so that they
+// do not keep an otherwise idle connection open.
+type noIdleReset struct{}
+
+func (noIdleReset) Reset(context.Context) {}
+
+// startPinger starts sending pings every AdapterConfig.PingInterval for
+// as long as the connection is held open, ie. until Close is called.
+func (ac *adapterConn) startPinger(ctx context.Context) {
+	interval := ac.pa.ControllerConfigCustom.PingInterval
+	if interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	ac.mu.Lock()
+	ac.stopPinger = cancel
+	ac.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			ac.ping(ctx)
+		}
+	}()
+}
+
+// ping sends a ping, if the connection has not already failed, and
+// closes the connection if the ping fails so that it is re-established
+// by the next operation rather than that operation failing.
+func (ac *adapterConn) ping(ctx context.Context) {
+	conn, err := ac.transport()
+	if err != nil {
+		return
+	}
+	ctx, s := ac.pa.mgr.NewWithContext(ctx, ac, noIdleReset{})
+	sess := protocol.NewSession(s)
+	start := time.Now()
+	err = protocol.Ping(ctx, sess)
+	latency := time.Since(start)
+	sess.Release()
+	if ctx.Err() != nil {
+		// The connection was closed whilst the ping was in flight.
+		return
+	}
+	ac.pa.pings.record(latency, err)
+	if err != nil {
+		ctxlog.Warn(ctx, "screenlogic: ping failed, closing connection", "ip", ac.pa.ControllerConfigCustom.IPAddress, "latency", latency, "err", err)
+		ac.failed(ctx, conn, err)
+		return
+	}
+	ctxlog.Debug(ctx, "screenlogic: ping", "latency", latency)
+}
@@ -0,0 +1,63 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cosnicolaou/automation/devices"
+)
+
+type PumpConfig struct {
+	Index int `yaml:"index"` // The pump's index, as per protocol.IntelliFlo.
+}
+
+func NewPump(_ devices.Options) *Pump {
+	return &Pump{}
+}
+
+// Pump represents an IntelliFlo pump, its speed is determined by the
+// circuits that are on and hence it only supports querying its status.
+type Pump struct {
+	devices.DeviceBase[PumpConfig]
+
+	adapter *Adapter
+}
+
+func (p *Pump) SetController(ctrl devices.Controller) {
+	p.adapter = ctrl.Implementation().(*Adapter)
+}
+
+func (p *Pump) ControlledBy() devices.Controller {
+	return p.adapter
+}
+
+func (p *Pump) OperationsHelp() map[string]string {
+	return map[string]string{
+		"status": "get the pump's current power, speed and flow rate",
+	}
+}
+
+func (p *Pump) Operations() map[string]devices.Operation {
+	return map[string]devices.Operation{
+		"status": p.Status,
+	}
+}
+
+func (p *Pump) Status(ctx context.Context, args devices.OperationArgs) (any, error) {
+	ps, err := p.adapter.GetPumpStatus(ctx, p.DeviceConfigCustom.Index)
+	if err != nil {
+		return nil, err
+	}
+	if args.Writer != nil {
+		state := "stopped"
+		if ps.Running {
+			state = "running"
+		}
+		fmt.Fprintf(args.Writer, "pump %v: %v, %vW, %v rpm, %v gpm\n", p.DeviceConfigCustom.Index, state, ps.Watts, ps.RPM, ps.GPM)
+	}
+	return ps, nil
+}
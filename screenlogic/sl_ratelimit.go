@@ -0,0 +1,208 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+)
+
+// RateLimitConfig specifies a token bucket rate limit for the commands
+// that change the controller's state, eg:
+//
+//	rate_limit:
+//	  rate: 2       # commands per second.
+//	  burst: 5
+//	  max_wait: 2s
+//
+// Commands are delayed, for up to MaxWait, until a token is available
+// and are otherwise rejected with a RateLimitError. Every command sent
+// takes a token, including each of those sent by a batch or scene. The
+// session is released whilst a command is delayed, so that other requests
+// are not blocked, and the controller's status is read again before it is
+// sent. Commands that read the controller's status or configuration are
+// not limited.
+type RateLimitConfig struct {
+	Rate    float64       `yaml:"rate"`     // Commands per second, 0 disables rate limiting.
+	Burst   int           `yaml:"burst"`    // The size of the bucket, the default is 1.
+	MaxWait time.Duration `yaml:"max_wait"` // The default is 5s.
+}
+
+// defaultRateLimitMaxWait is the default for RateLimitConfig.MaxWait.
+const defaultRateLimitMaxWait = 5 * time.Second
+
+// ErrRateLimited is returned, wrapped in a RateLimitError, for commands
+// that are rejected by the rate limiter.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitError is returned for commands that are rejected because
+// a token would not be available within RateLimitConfig.MaxWait.
+type RateLimitError struct {
+	Op   string        // The rejected command, eg. "set circuit 502 on".
+	Wait time.Duration // The time until a token would have been available.
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v: %v: retry in %v", e.Op, ErrRateLimited, e.Wait.Round(time.Millisecond))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// tokenBucket implements a token bucket that allows tokens to be
+// reserved ahead of their availability.
+type tokenBucket struct {
+	rate, burst float64
+	maxWait     time.Duration
+
+	mu     sync.Mutex
+	tokens float64 // Negative when tokens have been reserved.
+	last   time.Time
+}
+
+func newTokenBucket(cfg RateLimitConfig) *tokenBucket {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	tb := &tokenBucket{rate: cfg.Rate, burst: max(1, float64(cfg.Burst)), maxWait: cfg.MaxWait}
+	if tb.maxWait == 0 {
+		tb.maxWait = defaultRateLimitMaxWait
+	}
+	tb.tokens = tb.burst
+	return tb
+}
+
+// reserve takes a token, returning the time to wait until it becomes
+// available. If that exceeds maxWait, no token is taken and false is
+// returned along with the time that would have been spent waiting.
+func (tb *tokenBucket) reserve(now time.Time) (time.Duration, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.takeLocked(now) {
+		return 0, true
+	}
+	wait := time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+	if wait > tb.maxWait {
+		return wait, false
+	}
+	tb.tokens--
+	return wait, true
+}
+
+// take takes a token only if one is available immediately.
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.takeLocked(now)
+}
+
+func (tb *tokenBucket) takeLocked(now time.Time) bool {
+	if !tb.last.IsZero() {
+		tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	}
+	tb.last = now
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return true
+	}
+	return false
+}
+
+// cancel returns a reserved token that was not used.
+func (tb *tokenBucket) cancel() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.tokens = math.Min(tb.burst, tb.tokens+1)
+}
+
+// tryLimit returns true if the rate limiter, if any, allows a command to
+// be sent immediately.
+func (pa *Adapter) tryLimit() bool {
+	return pa.limiter == nil || pa.limiter.take(time.Now())
+}
+
+// limit waits for the rate limiter, if any, to allow the command
+// described by op to be sent. It must not be called whilst holding a
+// session.
+func (pa *Adapter) limit(ctx context.Context, op string) error {
+	tb := pa.limiter
+	if tb == nil {
+		return nil
+	}
+	wait, ok := tb.reserve(time.Now())
+	if !ok {
+		ctxlog.Warn(ctx, "screenlogic: command refused: rate limited", "op", op, "wait", wait)
+		return &RateLimitError{Op: op, Wait: wait}
+	}
+	if wait == 0 {
+		return nil
+	}
+	ctxlog.Info(ctx, "screenlogic: command delayed: rate limited", "op", op, "wait", wait)
+	select {
+	case <-ctx.Done():
+		tb.cancel()
+		return fmt.Errorf("%v: %w", op, ctx.Err())
+	case <-time.After(wait):
+	}
+	return nil
+}
+
+// circuitCommand is the most recent command sent for a circuit.
+type circuitCommand struct {
+	on bool
+	at time.Time
+}
+
+// debouncer records the most recent command sent for each circuit so
+// that identical commands repeated within a window may be dropped.
+type debouncer struct {
+	mu   sync.Mutex
+	last map[int]circuitCommand
+}
+
+func (d *debouncer) record(id int, on bool, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.last == nil {
+		d.last = map[int]circuitCommand{}
+	}
+	d.last[id] = circuitCommand{on: on, at: at}
+}
+
+// repeated returns true if the most recent command for the circuit set
+// it to the same state within the window.
+func (d *debouncer) repeated(id int, on bool, now time.Time, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last, ok := d.last[id]
+	return ok && last.on == on && now.Sub(last.at) < window
+}
+
+// reset discards all of the recorded commands, it is called when a
+// command fails since the state of the circuits is then uncertain.
+func (d *debouncer) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.last)
+}
+
+// debounced returns true, and logs that it was dropped, if the command
+// to set the specified circuit on or off repeats one sent within
+// AdapterConfig.Debounce.
+func (pa *Adapter) debounced(ctx context.Context, op string, id int, on bool) bool {
+	window := pa.ControllerConfigCustom.Debounce
+	if window == 0 || !pa.debouncer.repeated(id, on, time.Now(), window) {
+		return false
+	}
+	ctxlog.Info(ctx, "screenlogic: command dropped: debounced", "op", op, "window", window)
+	return true
+}
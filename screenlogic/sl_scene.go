@@ -0,0 +1,338 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// SceneCircuit specifies the target state of a circuit, by ID or name,
+// as for CircuitConfig.
+type SceneCircuit struct {
+	ID    int    `yaml:"id"`
+	Name  string `yaml:"circuit"`
+	State bool   `yaml:"state"`
+}
+
+// SceneBody specifies the target heat set point and/or heat mode of a
+// body, either may be omitted.
+type SceneBody struct {
+	Body         string `yaml:"body"` // pool or spa.
+	HeatSetPoint int    `yaml:"heat_set_point"`
+	HeatMode     string `yaml:"heat_mode"`
+
+	body     protocol.BodyType
+	heatMode protocol.HeatMode
+}
+
+// SceneConfig specifies the target states of the circuits, lights and
+// bodies that make up a scene, eg:
+//
+//	circuits:
+//	  - circuit: Spa
+//	    state: on
+//	  - circuit: Cleaner
+//	    state: off
+//	light_mode: party
+//	bodies:
+//	  - body: spa
+//	    heat_set_point: 102
+//	    heat_mode: heater
+//
+// The circuits are changed first, in order, followed by the light mode,
+// which is sent to all of the color lights, and then the bodies.
+type SceneConfig struct {
+	Circuits  []SceneCircuit `yaml:"circuits"`
+	LightMode string         `yaml:"light_mode"`
+	Bodies    []SceneBody    `yaml:"bodies"`
+
+	lightMode protocol.ColorMode
+}
+
+// SceneStep records the outcome of a single step of a scene.
+type SceneStep = OpResult
+
+// ErrSceneFailed is returned, wrapped in a SceneError, when a scene
+// could not be applied.
+var ErrSceneFailed = errors.New("scene failed")
+
+// SceneError is returned when a step of a scene fails, Steps records
+// the outcome of every step, including the rollback of those that were
+// applied before the failure.
+type SceneError struct {
+	Scene string
+	Steps []SceneStep
+	Err   error // The error for the failed step.
+}
+
+func (e *SceneError) Error() string {
+	return fmt.Sprintf("%v: %v: %v", e.Scene, ErrSceneFailed, e.Err)
+}
+
+func (e *SceneError) Unwrap() []error {
+	return []error{ErrSceneFailed, e.Err}
+}
+
+func NewScene(_ devices.Options) *Scene {
+	return &Scene{}
+}
+
+// Scene represents a set of circuit, light and body changes that are
+// applied together, using a single session unless rate limited, and that
+// are rolled back to their prior states if any one of them fails.
+type Scene struct {
+	devices.DeviceBase[SceneConfig]
+
+	adapter *Adapter
+
+	mu       sync.Mutex
+	circuits []int // The resolved circuit IDs.
+}
+
+func (s *Scene) UnmarshalYAML(node *yaml.Node) error {
+	cfg := &s.DeviceConfigCustom
+	if err := node.Decode(cfg); err != nil {
+		return err
+	}
+	for _, c := range cfg.Circuits {
+		if (c.ID == 0) == (len(c.Name) == 0) {
+			return errors.New("exactly one of id or circuit must be specified for each circuit")
+		}
+	}
+	if len(cfg.LightMode) > 0 {
+		mode, err := protocol.ParseColorMode(cfg.LightMode)
+		if err != nil {
+			return err
+		}
+		cfg.lightMode = mode
+	}
+	for i, b := range cfg.Bodies {
+		bt, err := protocol.ParseBodyType(b.Body)
+		if err != nil {
+			return err
+		}
+		cfg.Bodies[i].body = bt
+		if len(b.HeatMode) > 0 {
+			mode, err := protocol.ParseHeatMode(b.HeatMode)
+			if err != nil {
+				return err
+			}
+			cfg.Bodies[i].heatMode = mode
+		}
+	}
+	return nil
+}
+
+func (s *Scene) SetController(ctrl devices.Controller) {
+	s.adapter = ctrl.Implementation().(*Adapter)
+}
+
+func (s *Scene) ControlledBy() devices.Controller {
+	return s.adapter
+}
+
+func (s *Scene) OperationsHelp() map[string]string {
+	return map[string]string{
+		"apply": "apply the scene, rolling back all of its changes if any one of them fails",
+	}
+}
+
+func (s *Scene) Operations() map[string]devices.Operation {
+	return map[string]devices.Operation{
+		"apply": s.Apply,
+	}
+}
+
+// resolve resolves the names of the scene's circuits. It must be called
+// with s.mu held.
+func (s *Scene) resolve(cfg protocol.ControllerConfig) error {
+	ids := make([]int, len(s.DeviceConfigCustom.Circuits))
+	var errs []error
+	for i, c := range s.DeviceConfigCustom.Circuits {
+		id, err := resolveCircuit(cfg, s.Config().Name, c.ID, c.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ids[i] = id
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	s.circuits = ids
+	return nil
+}
+
+func (s *Scene) circuitIDs(ctx context.Context) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.circuits != nil {
+		return s.circuits, nil
+	}
+	cfg, err := s.adapter.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resolve(cfg); err != nil {
+		return nil, err
+	}
+	return s.circuits, nil
+}
+
+// sceneAction is a single step of a scene and the means of undoing it.
+type sceneAction struct {
+	Op
+	// undo restores the state recorded prior to applying the scene,
+	// it is nil if that is not possible.
+	undo func(context.Context, *protocol.Session, protocol.ControllerStatus) error
+}
+
+func (s *Scene) actions(ids []int) []sceneAction {
+	cfg := s.DeviceConfigCustom
+	var actions []sceneAction
+	for i, c := range cfg.Circuits {
+		id, on := ids[i], c.State
+		desc := fmt.Sprintf("circuit %v %v", id, circuitState[on])
+		if len(c.Name) > 0 {
+			desc = fmt.Sprintf("circuit %v (%v) %v", id, c.Name, circuitState[on])
+		}
+		actions = append(actions, sceneAction{
+			Op: circuitOp(desc, id, on),
+			undo: func(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus) error {
+				on, err := priorCircuit(prior, id)
+				if err != nil {
+					return err
+				}
+				return protocol.SetCircuitState(ctx, sess, id, on)
+			},
+		})
+	}
+	if len(cfg.LightMode) > 0 {
+		actions = append(actions, sceneAction{Op: LightModeOp(cfg.lightMode)})
+	}
+	for _, b := range cfg.Bodies {
+		body := b.body
+		if temp := b.HeatSetPoint; temp != 0 {
+			actions = append(actions, sceneAction{
+				Op: HeatSetPointOp(body, temp),
+				undo: func(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus) error {
+					bs, err := priorBody(prior, body)
+					if err != nil {
+						return err
+					}
+					return protocol.SetHeatSetPoint(ctx, sess, body, bs.HeatSetPoint)
+				},
+			})
+		}
+		if len(b.HeatMode) > 0 {
+			actions = append(actions, sceneAction{
+				Op: HeatModeOp(body, b.heatMode),
+				undo: func(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus) error {
+					bs, err := priorBody(prior, body)
+					if err != nil {
+						return err
+					}
+					return protocol.SetHeatMode(ctx, sess, body, bs.HeatMode)
+				},
+			})
+		}
+	}
+	return actions
+}
+
+// priorCircuit returns the prior state of the specified circuit, or an
+// error if the controller did not report it, since restoring a zero value
+// would turn the circuit off.
+func priorCircuit(prior protocol.ControllerStatus, id int) (bool, error) {
+	for _, c := range prior.Circuits {
+		if c.ID == id {
+			return c.State, nil
+		}
+	}
+	return false, fmt.Errorf("circuit %v: prior status not reported", id)
+}
+
+// priorBody returns the prior status of the specified body, or an error
+// if the controller did not report it, since restoring a zero value
+// would turn the heater off or set its set point to zero.
+func priorBody(prior protocol.ControllerStatus, body protocol.BodyType) (protocol.BodyStatus, error) {
+	bs, ok := prior.Body(body)
+	if !ok {
+		return bs, fmt.Errorf("%v: prior status not reported", strings.ToLower(body.String()))
+	}
+	return bs, nil
+}
+
+// rollback undoes the actions that were applied, including the failed
+// one, which is the last of results, since it may have been acted on, in
+// reverse order. Changes are subject to the adapter's rate limit and
+// circuit changes to its interlocks, but their rollback is subject to
+// neither since it restores the prior state and must not be refused part
+// way through.
+func rollback(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus, actions []sceneAction, steps []SceneStep) {
+	failed := len(steps) - 1
+	for i := failed; i >= 0; i-- {
+		undo := actions[i].undo
+		if undo == nil {
+			if i != failed {
+				steps[i].Status = "not restored"
+			}
+			continue
+		}
+		if err := undo(ctx, sess, prior); err != nil {
+			steps[i].Status, steps[i].Err = "rollback failed", err
+			continue
+		}
+		if i != failed {
+			steps[i].Status = "rolled back"
+		}
+	}
+}
+
+// Apply applies the scene, the returned []SceneStep records the outcome
+// of each step and is also written to args.Writer if set.
+func (s *Scene) Apply(ctx context.Context, args devices.OperationArgs) (any, error) {
+	name := s.Config().Name
+	ids, err := s.circuitIDs(ctx)
+	if err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to resolve scene circuits", "scene", name, "err", err)
+		return nil, err
+	}
+	actions := s.actions(ids)
+	ops := make([]Op, len(actions))
+	for i, a := range actions {
+		ops[i] = a.Op
+	}
+	steps, err := s.adapter.run(ctx, runner{
+		op:  "apply scene " + name,
+		ops: func(protocol.ControllerStatus) []Op { return ops },
+		rollback: func(ctx context.Context, sess *protocol.Session, prior protocol.ControllerStatus, steps []OpResult) {
+			rollback(ctx, sess, prior, actions, steps)
+		},
+	})
+	if args.Writer != nil {
+		for _, step := range steps {
+			fmt.Fprintf(args.Writer, "%v: %v\n", name, step)
+		}
+	}
+	if err != nil {
+		if steps != nil {
+			err = &SceneError{Scene: name, Steps: steps, Err: err}
+		}
+		ctxlog.Error(ctx, "screenlogic: failed to apply scene", "scene", name, "err", err)
+		return steps, err
+	}
+	ctxlog.Info(ctx, "screenlogic: scene applied", "scene", name, "steps", len(steps))
+	return steps, nil
+}
@@ -0,0 +1,273 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// SnapshotCircuit records the state of a single circuit.
+type SnapshotCircuit struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	State bool   `json:"state"`
+}
+
+// SnapshotBody records the heat settings of a body.
+type SnapshotBody struct {
+	Type         protocol.BodyType `json:"type"`
+	HeatSetPoint int               `json:"heat_set_point"`
+	HeatMode     protocol.HeatMode `json:"heat_mode"`
+}
+
+// Snapshot records the state of every circuit and the heat settings of
+// every body.
+type Snapshot struct {
+	Name     string            `json:"name"`
+	Time     time.Time         `json:"time"`
+	Circuits []SnapshotCircuit `json:"circuits"`
+	Bodies   []SnapshotBody    `json:"bodies"`
+}
+
+// NewSnapshot returns a Snapshot of the supplied status, the config is
+// used to name the circuits.
+func NewSnapshot(name string, cfg protocol.ControllerConfig, st protocol.ControllerStatus) Snapshot {
+	snap := Snapshot{Name: name, Time: time.Now().UTC()}
+	for _, c := range st.Circuits {
+		snap.Circuits = append(snap.Circuits, SnapshotCircuit{ID: c.ID, Name: cfg.CircuitName(c.ID), State: c.State})
+	}
+	for _, b := range st.Bodies {
+		snap.Bodies = append(snap.Bodies, SnapshotBody{Type: b.Type, HeatSetPoint: b.HeatSetPoint, HeatMode: b.HeatMode})
+	}
+	return snap
+}
+
+// ErrMissingCircuits is returned, wrapped in a MissingCircuitsError,
+// when a snapshot refers to circuits that no longer exist.
+var ErrMissingCircuits = errors.New("snapshot circuits no longer exist")
+
+// MissingCircuitsError is returned by Restore when the snapshot refers
+// to circuits that no longer exist, all other changes are still made.
+type MissingCircuitsError struct {
+	Snapshot string
+	Circuits []SnapshotCircuit
+}
+
+func (e *MissingCircuitsError) Error() string {
+	names := make([]string, len(e.Circuits))
+	for i, c := range e.Circuits {
+		names[i] = fmt.Sprintf("%q (%v)", c.Name, c.ID)
+	}
+	return fmt.Sprintf("%v: %v: %v", e.Snapshot, ErrMissingCircuits, strings.Join(names, ", "))
+}
+
+func (e *MissingCircuitsError) Unwrap() error {
+	return ErrMissingCircuits
+}
+
+// snapshotFile returns the file used for the named snapshot.
+func (pa *Adapter) snapshotFile(name string) (string, error) {
+	dir := pa.ControllerConfigCustom.SnapshotDir
+	if len(dir) == 0 {
+		return "", errors.New("snapshot_dir is not configured")
+	}
+	if len(name) == 0 || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Snapshot records the current state of every circuit and the heat
+// settings of every body in a file named for the snapshot in the
+// AdapterConfig.SnapshotDir directory, replacing any existing snapshot
+// of the same name.
+func (pa *Adapter) Snapshot(ctx context.Context, name string) (Snapshot, error) {
+	filename, err := pa.snapshotFile(name)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	st, err := call(ctx, pa, protocol.GetControllerStatus)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	snap := NewSnapshot(name, cfg, st)
+	buf, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	// Write to a temporary file first so that an existing snapshot is
+	// not lost if the write fails.
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, append(buf, '\n'), 0o600); err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot: %w", err)
+	}
+	ctxlog.Info(ctx, "screenlogic: snapshot saved", "name", name, "file", filename)
+	return snap, nil
+}
+
+// ReadSnapshot reads the named snapshot.
+func (pa *Adapter) ReadSnapshot(name string) (Snapshot, error) {
+	filename, err := pa.snapshotFile(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(buf, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("%v: %w", filename, err)
+	}
+	return snap, nil
+}
+
+// snapshotCircuitID returns the ID of the circuit that corresponds to
+// sc, or zero if there is none. The recorded ID is used if the circuit
+// with that ID still has the same name, otherwise the circuit is matched
+// by name, since IDs may change when the controller is reprogrammed, but
+// only if that name is unique.
+func snapshotCircuitID(cfg protocol.ControllerConfig, sc SnapshotCircuit) int {
+	if c := cfg.CircuitByID(sc.ID); c.ID == sc.ID && c.Name == sc.Name {
+		return sc.ID
+	}
+	id, matches := 0, 0
+	for _, c := range cfg.Circuits {
+		if c.Name == sc.Name {
+			id, matches = c.ID, matches+1
+		}
+	}
+	if matches != 1 {
+		return 0
+	}
+	return id
+}
+
+// restoreChanges returns the changes required to restore the snapshot
+// and the circuits that no longer exist, or that can no longer be
+// unambiguously identified.
+func restoreChanges(snap Snapshot, cfg protocol.ControllerConfig, st protocol.ControllerStatus) ([]Op, []SnapshotCircuit) {
+	var changes []Op
+	var missing []SnapshotCircuit
+	for _, sc := range snap.Circuits {
+		id := snapshotCircuitID(cfg, sc)
+		if id == 0 {
+			missing = append(missing, sc)
+			continue
+		}
+		if st.StatusForID(id) == sc.State {
+			continue
+		}
+		on := sc.State
+		changes = append(changes, circuitOp(fmt.Sprintf("circuit %v (%v) %v", id, sc.Name, circuitState[on]), id, on))
+	}
+	for _, sb := range snap.Bodies {
+		bs, ok := st.Body(sb.Type)
+		if !ok {
+			continue
+		}
+		if bs.HeatSetPoint != sb.HeatSetPoint {
+			changes = append(changes, HeatSetPointOp(sb.Type, sb.HeatSetPoint))
+		}
+		if bs.HeatMode != sb.HeatMode {
+			changes = append(changes, HeatModeOp(sb.Type, sb.HeatMode))
+		}
+	}
+	return changes, missing
+}
+
+// Restore restores the named snapshot, making only those changes that
+// are required, and returns a description of each change made. Circuits
+// in the snapshot that no longer exist, or that can no longer be
+// unambiguously identified, are reported via a MissingCircuitsError once
+// all of the other changes have been made. Circuit changes are subject
+// to AdapterConfig.Interlocks and since the order in which they are made
+// may matter, those refused are retried for as long as other changes are
+// being made.
+func (pa *Adapter) Restore(ctx context.Context, name string) ([]string, error) {
+	snap, err := pa.ReadSnapshot(name)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	var missing []SnapshotCircuit
+	results, err := pa.run(ctx, runner{
+		op: "restore snapshot " + name,
+		ops: func(st protocol.ControllerStatus) []Op {
+			var changes []Op
+			changes, missing = restoreChanges(snap, cfg, st)
+			return changes
+		},
+		retry: func(err error) bool { return errors.Is(err, ErrInterlock) },
+	})
+	var applied []string
+	for _, r := range results {
+		if r.Status == "applied" {
+			applied = append(applied, r.Description)
+		}
+	}
+	if err != nil {
+		ctxlog.Error(ctx, "screenlogic: failed to restore snapshot", "name", name, "applied", applied, "err", err)
+		return applied, fmt.Errorf("restore: %v: %w", name, err)
+	}
+	if len(missing) > 0 {
+		err := &MissingCircuitsError{Snapshot: name, Circuits: missing}
+		ctxlog.Warn(ctx, "screenlogic: snapshot restored with missing circuits", "name", name, "applied", applied, "err", err)
+		return applied, err
+	}
+	ctxlog.Info(ctx, "screenlogic: snapshot restored", "name", name, "applied", applied)
+	return applied, nil
+}
+
+func (pa *Adapter) snapshot(ctx context.Context, args devices.OperationArgs) (any, error) {
+	if len(args.Args) != 1 {
+		return nil, fmt.Errorf("snapshot: expected a single snapshot name")
+	}
+	snap, err := pa.Snapshot(ctx, args.Args[0])
+	if err == nil && args.Writer != nil {
+		fmt.Fprintf(args.Writer, "snapshot: %v: %v circuits, %v bodies\n", snap.Name, len(snap.Circuits), len(snap.Bodies))
+	}
+	return snap, err
+}
+
+func (pa *Adapter) restore(ctx context.Context, args devices.OperationArgs) (any, error) {
+	if len(args.Args) != 1 {
+		return nil, fmt.Errorf("restore: expected a single snapshot name")
+	}
+	applied, err := pa.Restore(ctx, args.Args[0])
+	if args.Writer != nil {
+		for _, a := range applied {
+			fmt.Fprintf(args.Writer, "restore: %v\n", a)
+		}
+		if err != nil {
+			fmt.Fprintf(args.Writer, "restore: %v\n", err)
+		}
+	}
+	return applied, err
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+var (
+	// ErrControllerInService is returned, wrapped in a StateError, for
+	// commands sent whilst the controller has been placed in service
+	// mode, typically by a technician working on the equipment.
+	ErrControllerInService = errors.New("controller is in service mode")
+	// ErrControllerSyncing is returned, wrapped in a StateError, for
+	// commands sent whilst the controller remains in the sync state for
+	// longer than AdapterConfig.SyncWait.
+	ErrControllerSyncing = errors.New("controller is syncing")
+)
+
+// StateError is returned for commands that are refused because of the
+// controller's state.
+type StateError struct {
+	Op    string // The refused command, eg. "set circuit 502 on".
+	State protocol.ControllerState
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Op, e.Unwrap())
+}
+
+func (e *StateError) Unwrap() error {
+	if e.State == protocol.ControllerService {
+		return ErrControllerInService
+	}
+	return ErrControllerSyncing
+}
+
+// defaultSyncWait is the default for AdapterConfig.SyncWait.
+const defaultSyncWait = 30 * time.Second
+
+// syncRetryInterval is the interval at which the controller's state is
+// checked whilst waiting for it to leave the sync state.
+var syncRetryInterval = 500 * time.Millisecond
+
+func (pa *Adapter) syncWait() time.Duration {
+	if sw := pa.ControllerConfigCustom.SyncWait; sw > 0 {
+		return sw
+	}
+	return defaultSyncWait
+}
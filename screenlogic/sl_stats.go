@@ -0,0 +1,96 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// AdapterStats records the number of operations performed by an Adapter
+// and the errors that they encountered.
+type AdapterStats struct {
+	Operations      int64 // Operations attempted, including retries.
+	ProtocolErrors  int64 // Errors returned by, or malformed responses from, the adapter.
+	TransportErrors int64 // Connection failures and timeouts.
+	Connects        int64 // Successful connections, including reconnects.
+	Reconnects      int64 // Reconnections following a transport error.
+	CacheHits       int64 // Requests for the status or configuration served from the cache.
+	SharedRequests  int64 // Requests that shared the result of a concurrent request.
+}
+
+type adapterStats struct {
+	operations      atomic.Int64
+	protocolErrors  atomic.Int64
+	transportErrors atomic.Int64
+	connects        atomic.Int64
+	reconnects      atomic.Int64
+	cacheHits       atomic.Int64
+	sharedRequests  atomic.Int64
+}
+
+// isProtocolError returns true if err was returned by, or is the result
+// of a malformed response from, the adapter rather than a failure of the
+// connection to it.
+func isProtocolError(err error) bool {
+	for _, perr := range []error{
+		protocol.ErrBadLogin,
+		protocol.ErrUnexpectedResponseID,
+		protocol.ErrUnexpectedResponseCode,
+		protocol.ErrInvalidRequest,
+		protocol.ErrInvalidResponse,
+		protocol.ErrBadParameter,
+		protocol.ErrNoValidResponse,
+	} {
+		if errors.Is(err, perr) {
+			return true
+		}
+	}
+	return false
+}
+
+// record updates the operation and error counts for an operation that
+// returned err.
+func (s *adapterStats) record(err error) {
+	s.operations.Add(1)
+	switch {
+	case err == nil:
+	case isProtocolError(err):
+		s.protocolErrors.Add(1)
+	default:
+		s.transportErrors.Add(1)
+	}
+}
+
+// recordSessionError updates the operation and error counts for a
+// failure to establish a session, which is treated as a transport error
+// unless the adapter rejected the login.
+func (s *adapterStats) recordSessionError(err error) {
+	s.operations.Add(1)
+	if errors.Is(err, protocol.ErrBadLogin) {
+		s.protocolErrors.Add(1)
+		return
+	}
+	s.transportErrors.Add(1)
+}
+
+func (s *adapterStats) snapshot() AdapterStats {
+	return AdapterStats{
+		Operations:      s.operations.Load(),
+		ProtocolErrors:  s.protocolErrors.Load(),
+		TransportErrors: s.transportErrors.Load(),
+		Connects:        s.connects.Load(),
+		Reconnects:      s.reconnects.Load(),
+		CacheHits:       s.cacheHits.Load(),
+		SharedRequests:  s.sharedRequests.Load(),
+	}
+}
+
+// Stats returns the adapter's operation and error counts.
+func (pa *Adapter) Stats() AdapterStats {
+	return pa.stats.snapshot()
+}
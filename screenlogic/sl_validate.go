@@ -0,0 +1,210 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// UnknownCircuitError is returned for a circuit device whose configured
+// ID or name is not known to the controller.
+type UnknownCircuitError struct {
+	Device string // The name of the device.
+	ID     int    // The configured ID, if any.
+	Name   string // The configured name, if any.
+	// Suggestions lists the circuits, formatted as "<name> (<id>)", whose
+	// IDs or names are close to the configured ones.
+	Suggestions []string
+}
+
+func (e *UnknownCircuitError) Error() string {
+	msg := fmt.Sprintf("%v: unknown circuit name %q", e.Device, e.Name)
+	if e.ID != 0 {
+		msg = fmt.Sprintf("%v: unknown circuit id %v", e.Device, e.ID)
+	}
+	if len(e.Suggestions) > 0 {
+		msg += ", did you mean " + strings.Join(e.Suggestions, " or ") + "?"
+	}
+	return msg
+}
+
+// resolveCircuit returns the ID of the circuit specified by either id
+// or name, or an UnknownCircuitError for the named device if there is
+// no such circuit.
+func resolveCircuit(cfg protocol.ControllerConfig, device string, id int, name string) (int, error) {
+	if id != 0 {
+		if cfg.CircuitByID(id).ID == id {
+			return id, nil
+		}
+	} else if ckt := cfg.CircuitBytName(name); ckt.ID != 0 {
+		return ckt.ID, nil
+	}
+	return 0, &UnknownCircuitError{
+		Device:      device,
+		ID:          id,
+		Name:        name,
+		Suggestions: suggestCircuits(cfg, id, name),
+	}
+}
+
+// maxSuggestions is the maximum number of suggestions returned by
+// suggestCircuits.
+const maxSuggestions = 3
+
+// suggestCircuits returns the circuits whose IDs are within a single
+// edit of id, if id is non-zero, or otherwise those whose names are
+// close to name, ignoring case, closest first.
+func suggestCircuits(cfg protocol.ControllerConfig, id int, name string) []string {
+	type candidate struct {
+		circuit  protocol.Circuit
+		distance int
+	}
+	var candidates []candidate
+	for _, c := range cfg.Circuits {
+		var d int
+		if id != 0 {
+			d = editDistance(strconv.Itoa(id), strconv.Itoa(c.ID))
+			if d > 1 {
+				continue
+			}
+		} else {
+			n, cn := strings.ToLower(name), strings.ToLower(c.Name)
+			d = editDistance(n, cn)
+			if d > max(1, len(n)/3) && !strings.Contains(cn, n) && !strings.Contains(n, cn) {
+				continue
+			}
+		}
+		candidates = append(candidates, candidate{c, d})
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return cmp.Compare(a.distance, b.distance)
+	})
+	var suggestions []string
+	for _, c := range candidates[:min(len(candidates), maxSuggestions)] {
+		suggestions = append(suggestions, fmt.Sprintf("%q (%v)", c.circuit.Name, c.circuit.ID))
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range ra {
+		cur[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			cur[j+1] = min(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// ValidateDevices checks that every circuit, light and scene device
+// controlled by this adapter refers to circuits known to the controller,
+// resolving those that are configured by name, as well as the circuits
+// referred to by AdapterConfig.Interlocks. It is intended to be called
+// at startup, see ValidateSystem, so that configuration errors are
+// reported immediately rather than when the device is first used. All
+// unknown circuits are reported.
+func (pa *Adapter) ValidateDevices(ctx context.Context) error {
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	var errs []error
+	if err := pa.validateInterlocks(cfg); err != nil {
+		ctxlog.Error(ctx, "screenlogic: invalid interlocks", "err", err)
+		errs = append(errs, err)
+	}
+	devs := pa.System().Devices
+	n := 0
+	for _, name := range slices.Sorted(maps.Keys(devs)) {
+		if ctrl, ok := devs[name].ControlledBy().(*Adapter); !ok || ctrl != pa {
+			continue
+		}
+		var err error
+		switch dev := devs[name].(type) {
+		case *Circuit:
+			err = dev.validate(cfg)
+		case *Light:
+			err = dev.validate(cfg)
+		case *Scene:
+			err = dev.validate(cfg)
+		default:
+			continue
+		}
+		n++
+		if err != nil {
+			ctxlog.Error(ctx, "screenlogic: invalid circuit", "device", name, "err", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	ctxlog.Info(ctx, "screenlogic: devices validated", "devices", n)
+	return nil
+}
+
+// ValidateSystem calls ValidateDevices for every screenlogic adapter in
+// sys and returns all of the errors encountered. It is intended to be
+// called once the system has been configured, eg. by
+// devices.ParseSystemConfig, so that startup fails, or warns, if any of
+// the configured circuits are unknown to their controllers.
+func ValidateSystem(ctx context.Context, sys devices.System) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(sys.Controllers)) {
+		pa, ok := sys.Controllers[name].Implementation().(*Adapter)
+		if !ok {
+			continue
+		}
+		if err := pa.ValidateDevices(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Circuit) validate(cfg protocol.ControllerConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resolve(cfg)
+}
+
+func (s *Scene) validate(cfg protocol.ControllerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resolve(cfg)
+}
+
+func (pa *Adapter) validate(ctx context.Context, args devices.OperationArgs) (any, error) {
+	if err := pa.ValidateDevices(ctx); err != nil {
+		return nil, err
+	}
+	if args.Writer != nil {
+		fmt.Fprintf(args.Writer, "validate: ok\n")
+	}
+	return nil, nil
+}
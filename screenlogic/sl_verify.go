@@ -0,0 +1,125 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// ErrNotVerified is returned, wrapped in a VerifyError, when the
+// controller's status does not reflect a change that it acknowledged.
+var ErrNotVerified = errors.New("change not reflected in the controller's status")
+
+// VerifyError is returned by WaitForStatus when the controller's status
+// does not reflect the expected change within the allotted time.
+type VerifyError struct {
+	// What describes the expected change, eg. "circuit 502 on".
+	What string
+	// Reasons lists the conditions reported by the controller's status
+	// that may explain why the change was not made, eg. freeze
+	// protection being active.
+	Reasons []string
+	// Status is the most recently obtained status.
+	Status protocol.ControllerStatus
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("%v: %v", e.What, ErrNotVerified)
+	if len(e.Reasons) > 0 {
+		msg += ": " + strings.Join(e.Reasons, ", ")
+	}
+	return msg
+}
+
+func (e *VerifyError) Unwrap() error {
+	return ErrNotVerified
+}
+
+// verifyInterval is the interval at which the controller's status is
+// polled when verifying a change.
+var verifyInterval = 250 * time.Millisecond
+
+// explain returns the conditions in the controller's status that may
+// prevent a change from being made.
+func explain(st protocol.ControllerStatus, circuit int) []string {
+	var reasons []string
+	if st.State != protocol.ControllerReady {
+		reasons = append(reasons, fmt.Sprintf("controller is in the %v state", st.State))
+	}
+	if st.FreezeMode {
+		reasons = append(reasons, "freeze protection is active")
+	}
+	for _, c := range st.Circuits {
+		if c.ID == circuit && c.Delay {
+			reasons = append(reasons, fmt.Sprintf("circuit %v is delayed", c.ID))
+		}
+	}
+	if st.PoolDelay {
+		reasons = append(reasons, "pool delay is active")
+	}
+	if st.SpaDelay {
+		reasons = append(reasons, "spa delay is active")
+	}
+	if st.CleanerDelay {
+		reasons = append(reasons, "cleaner delay is active")
+	}
+	if st.Alert != 0 {
+		reasons = append(reasons, fmt.Sprintf("alert %v is raised", st.Alert))
+	}
+	return reasons
+}
+
+// WaitForStatus polls the controller's status, bypassing the cache,
+// until done returns true or the timeout expires, in which case a
+// VerifyError is returned. What describes the expected change and
+// circuit, if non-zero, the circuit that it applies to.
+func (pa *Adapter) WaitForStatus(ctx context.Context, timeout time.Duration, what string, circuit int, done func(protocol.ControllerStatus) bool) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		st, err := call(ctx, pa, protocol.GetControllerStatus)
+		if err != nil {
+			return fmt.Errorf("verify: %v: %w", what, err)
+		}
+		if done(st) {
+			return nil
+		}
+		if time.Now().Add(verifyInterval).After(deadline) {
+			return &VerifyError{What: what, Reasons: explain(st, circuit), Status: st}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("verify: %v: %w", what, ctx.Err())
+		case <-time.After(verifyInterval):
+		}
+	}
+}
+
+// VerifyCircuit waits for the specified circuit to be on or off.
+func (pa *Adapter) VerifyCircuit(ctx context.Context, timeout time.Duration, id int, on bool) error {
+	return pa.WaitForStatus(ctx, timeout, fmt.Sprintf("circuit %v %v", id, circuitState[on]), id,
+		func(st protocol.ControllerStatus) bool {
+			for _, c := range st.Circuits {
+				if c.ID == id {
+					return c.State == on
+				}
+			}
+			return false
+		})
+}
+
+// VerifyBody waits for the status of the specified body to satisfy done.
+func (pa *Adapter) VerifyBody(ctx context.Context, timeout time.Duration, body protocol.BodyType, what string, done func(protocol.BodyStatus) bool) error {
+	return pa.WaitForStatus(ctx, timeout, fmt.Sprintf("%v %v", strings.ToLower(body.String()), what), 0,
+		func(st protocol.ControllerStatus) bool {
+			bs, ok := st.Body(body)
+			return ok && done(bs)
+		})
+}
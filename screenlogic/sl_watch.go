@@ -0,0 +1,101 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package screenlogic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/cosnicolaou/automation/devices"
+	"github.com/cosnicolaou/pentair/screenlogic/protocol"
+)
+
+// watchConfigEvery is the number of status polls between each poll of
+// the controller's configuration when watching for changes.
+const watchConfigEvery = 10
+
+// defaultWatchInterval is the polling interval used by the watch
+// operation if none is specified.
+const defaultWatchInterval = 10 * time.Second
+
+// Watch polls the controller at the specified interval and calls fn for
+// each change, as determined by protocol.DiffConfig and
+// protocol.DiffStatus, between successive polls until the context is
+// canceled. Circuits are named using the most recently obtained
+// configuration. Errors encountered whilst polling are logged and
+// polling continues.
+func (pa *Adapter) Watch(ctx context.Context, interval time.Duration, fn func(protocol.Change)) error {
+	cfg, err := pa.GetConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	st, err := pa.GetStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if n%watchConfigEvery == 0 {
+			next, err := pa.GetConfig(ctx)
+			if err != nil {
+				ctxlog.Warn(ctx, "screenlogic: watch: poll failed", "err", err)
+				continue
+			}
+			for _, c := range protocol.DiffConfig(cfg, next) {
+				fn(c)
+			}
+			cfg = next
+		}
+		next, err := pa.GetStatus(ctx)
+		if err != nil {
+			ctxlog.Warn(ctx, "screenlogic: watch: poll failed", "err", err)
+			continue
+		}
+		changes := protocol.DiffStatus(st, next)
+		cfg.NameChanges(changes)
+		for _, c := range changes {
+			fn(c)
+		}
+		st = next
+	}
+}
+
+// watch implements the watch operation whose optional arguments are
+// the polling interval and the duration for which to watch, the default
+// being to watch until the context is canceled. Changes are written to
+// args.Writer as they happen rather than being accumulated and returned,
+// since there is no bound on how many there may be.
+func (pa *Adapter) watch(ctx context.Context, args devices.OperationArgs) (any, error) {
+	interval := defaultWatchInterval
+	if len(args.Args) > 0 {
+		d, err := time.ParseDuration(args.Args[0])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("watch: invalid interval: %q", args.Args[0])
+		}
+		interval = d
+	}
+	if len(args.Args) > 1 {
+		d, err := time.ParseDuration(args.Args[1])
+		if err != nil {
+			return nil, fmt.Errorf("watch: invalid duration: %q", args.Args[1])
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	return nil, pa.Watch(ctx, interval, func(c protocol.Change) {
+		if args.Writer != nil {
+			fmt.Fprintf(args.Writer, "%v: %v\n", time.Now().Format(time.RFC3339), c)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package slnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+)
+
+// DiscoveryAddr is the broadcast address to which discovery requests are
+// sent, gateways listen for them on UDP port 1444.
+const DiscoveryAddr = "255.255.255.255:1444"
+
+const (
+	discoveryChecksum = 2
+	discoveryNameSize = 28
+	discoveryRespSize = 12 + discoveryNameSize
+)
+
+var discoveryRequest = []byte{1, 0, 0, 0, 0, 0, 0, 0}
+
+// ErrInvalidDiscoveryResponse is returned for a malformed discovery
+// response.
+var ErrInvalidDiscoveryResponse = errors.New("invalid discovery response")
+
+// Gateway represents a gateway that responded to a discovery request.
+type Gateway struct {
+	Addr    netip.AddrPort // The gateway's TCP address.
+	Type    uint8
+	Subtype uint8
+	Name    string
+}
+
+// IsDiscoveryRequest returns true if buf is a discovery request.
+func IsDiscoveryRequest(buf []byte) bool {
+	return bytes.Equal(buf, discoveryRequest)
+}
+
+// EncodeDiscoveryResponse encodes the response to a discovery request.
+func EncodeDiscoveryResponse(gw Gateway) []byte {
+	buf := make([]byte, discoveryRespSize)
+	binary.LittleEndian.PutUint32(buf, discoveryChecksum)
+	ip := gw.Addr.Addr().As4()
+	copy(buf[4:8], ip[:])
+	binary.LittleEndian.PutUint16(buf[8:], gw.Addr.Port())
+	buf[10], buf[11] = gw.Type, gw.Subtype
+	copy(buf[12:12+discoveryNameSize-1], gw.Name)
+	return buf
+}
+
+// DecodeDiscoveryResponse decodes a response to a discovery request.
+func DecodeDiscoveryResponse(buf []byte) (Gateway, error) {
+	if len(buf) < 12 || binary.LittleEndian.Uint32(buf) != discoveryChecksum {
+		return Gateway{}, ErrInvalidDiscoveryResponse
+	}
+	ip := netip.AddrFrom4([4]byte(buf[4:8]))
+	name := buf[12:]
+	if idx := bytes.IndexByte(name, 0); idx >= 0 {
+		name = name[:idx]
+	}
+	return Gateway{
+		Addr:    netip.AddrPortFrom(ip, binary.LittleEndian.Uint16(buf[8:])),
+		Type:    buf[10],
+		Subtype: buf[11],
+		Name:    string(name),
+	}, nil
+}
+
+// Discover sends a discovery request to addr, typically DiscoveryAddr,
+// and returns all of the gateways that respond within the specified
+// timeout.
+func Discover(ctx context.Context, addr string, timeout time.Duration) ([]Gateway, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	ctxlog.Info(ctx, "screenlogic: discovery", "addr", addr)
+	if _, err := conn.WriteToUDP(discoveryRequest, raddr); err != nil {
+		return nil, fmt.Errorf("discovery request to %v failed: %w", addr, err)
+	}
+	var gateways []Gateway
+	seen := map[netip.AddrPort]bool{}
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return gateways, nil
+			}
+			return gateways, err
+		}
+		gw, err := DecodeDiscoveryResponse(buf[:n])
+		if err != nil {
+			ctxlog.Info(ctx, "screenlogic: discovery: ignoring response", "from", from.String(), "err", err)
+			continue
+		}
+		if seen[gw.Addr] {
+			continue
+		}
+		seen[gw.Addr] = true
+		ctxlog.Info(ctx, "screenlogic: discovery: found", "from", from.String(), "addr", gw.Addr.String(), "name", gw.Name)
+		gateways = append(gateways, gw)
+	}
+}
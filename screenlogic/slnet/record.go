@@ -0,0 +1,292 @@
+// Copyright 2025 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package slnet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cosnicolaou/automation/net/streamconn"
+)
+
+// Direction of a recorded frame.
+const (
+	RecordSend  = "send"
+	RecordRecv  = "recv"
+	RecordClose = "close"
+)
+
+// Record represents a single recorded frame, or a close of the
+// underlying connection. Frames are stored as hex strings, Err records
+// any error returned by the underlying transport.
+type Record struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	Data string    `json:"data,omitempty"`
+	Err  string    `json:"err,omitempty"`
+}
+
+// Recorder is a streamconn.Transport that records every frame sent
+// and received over the underlying transport as a json encoded Record
+// per line.
+type Recorder struct {
+	streamconn.Transport
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+	err    error
+}
+
+// NewRecorder returns a Recorder that writes the recording to w.
+func NewRecorder(t streamconn.Transport, w io.Writer) *Recorder {
+	return &Recorder{Transport: t, enc: json.NewEncoder(w)}
+}
+
+// RecordToFile returns a Recorder that appends the recording to the
+// specified file, which is closed when the Recorder is closed.
+func RecordToFile(t streamconn.Transport, filename string) (*Recorder, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(t, f)
+	r.closer = f
+	return r, nil
+}
+
+func (r *Recorder) record(dir string, buf []byte, err error) {
+	rec := Record{Time: time.Now().UTC(), Dir: dir, Data: hex.EncodeToString(buf)}
+	if err != nil {
+		rec.Err = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if werr := r.enc.Encode(rec); werr != nil && r.err == nil {
+		r.err = werr
+	}
+}
+
+// Err returns the first error encountered writing the recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) Send(ctx context.Context, buf []byte) (int, error) {
+	n, err := r.Transport.Send(ctx, buf)
+	r.record(RecordSend, buf, err)
+	return n, err
+}
+
+func (r *Recorder) SendSensitive(ctx context.Context, buf []byte) (int, error) {
+	n, err := r.Transport.SendSensitive(ctx, buf)
+	r.record(RecordSend, buf, err)
+	return n, err
+}
+
+func (r *Recorder) ReadUntil(ctx context.Context, expected []string) ([]byte, error) {
+	buf, err := r.Transport.ReadUntil(ctx, expected)
+	r.record(RecordRecv, buf, err)
+	return buf, err
+}
+
+func (r *Recorder) Close(ctx context.Context) error {
+	err := r.Transport.Close(ctx)
+	r.record(RecordClose, nil, err)
+	if r.closer != nil {
+		if cerr := r.closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ReadRecording reads a recording created by a Recorder.
+func ReadRecording(rd io.Reader) ([]Record, error) {
+	var recs []Record
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		switch rec.Dir {
+		case RecordSend, RecordRecv, RecordClose:
+		default:
+			return nil, fmt.Errorf("line %v: unknown direction: %q", line, rec.Dir)
+		}
+		if _, err := hex.DecodeString(rec.Data); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+// ErrReplayMismatch is returned when the traffic generated by the client
+// differs from that in the recording being replayed.
+var ErrReplayMismatch = errors.New("replay mismatch")
+
+// Replay is a streamconn.Transport that replays a recording created by
+// a Recorder. Every frame sent must match the next frame sent in the
+// recording, with the exception of message IDs which are ignored since
+// they will typically differ from run to run. Every read returns
+// the next frame received in the recording with its message ID set to
+// that of the most recently sent message if the recorded IDs matched.
+// Close may be called multiple times to allow for recordings that
+// span multiple connections. Once a mismatch is detected all subsequent
+// operations fail.
+type Replay struct {
+	mu           sync.Mutex
+	recs         []Record
+	next         int
+	sentID       uint16
+	recordedID   uint16
+	replayedSent bool
+	err          error // sticky mismatch error.
+}
+
+// NewReplay returns a Replay for the supplied records.
+func NewReplay(recs []Record) *Replay {
+	return &Replay{recs: recs}
+}
+
+// OpenReplay reads the recording in the specified file and returns a
+// Replay for it.
+func OpenReplay(filename string) (*Replay, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recs, err := ReadRecording(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+	return NewReplay(recs), nil
+}
+
+// Remaining returns the number of records that have not yet been replayed.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.recs) - r.next
+}
+
+func (r *Replay) nextRecord(dir string) (Record, error) {
+	if r.err != nil {
+		return Record{}, r.err
+	}
+	// Skip over close records when looking for other frames since the
+	// client may reuse a connection that was closed in the recording.
+	for r.next < len(r.recs) && dir != RecordClose && r.recs[r.next].Dir == RecordClose {
+		r.next++
+	}
+	if r.next >= len(r.recs) {
+		return Record{}, r.mismatch(fmt.Errorf("record %v: unexpected %v, recording exhausted: %w", r.next, dir, ErrReplayMismatch))
+	}
+	rec := r.recs[r.next]
+	if rec.Dir != dir {
+		return Record{}, r.mismatch(fmt.Errorf("record %v: unexpected %v, expected %v: %w", r.next, dir, rec.Dir, ErrReplayMismatch))
+	}
+	r.next++
+	return rec, nil
+}
+
+// mismatch records the first mismatch, all subsequent operations
+// will fail with the same error.
+func (r *Replay) mismatch(err error) error {
+	r.err = err
+	return err
+}
+
+func recordError(rec Record) error {
+	if len(rec.Err) == 0 {
+		return nil
+	}
+	return errors.New(rec.Err)
+}
+
+func isFramed(buf []byte) bool {
+	return len(buf) >= MessageHeaderSize && int(MessageHeader(buf).Size())+MessageHeaderSize == len(buf)
+}
+
+func (r *Replay) send(buf []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, err := r.nextRecord(RecordSend)
+	if err != nil {
+		return -1, err
+	}
+	expected, _ := hex.DecodeString(rec.Data)
+	if isFramed(buf) && isFramed(expected) {
+		got, want := MessageHeader(buf), MessageHeader(expected)
+		if got.Code() != want.Code() || !bytes.Equal(got[4:], want[4:]) {
+			return -1, r.mismatch(fmt.Errorf("record %v: sent code %v size %v, recorded code %v size %v: %w", r.next-1, codeNamer(got.Code()), got.Size(), codeNamer(want.Code()), want.Size(), ErrReplayMismatch))
+		}
+		r.sentID, r.recordedID, r.replayedSent = got.ID(), want.ID(), true
+	} else if !bytes.Equal(buf, expected) {
+		return -1, r.mismatch(fmt.Errorf("record %v: sent %q, recorded %q: %w", r.next-1, buf, expected, ErrReplayMismatch))
+	}
+	if err := recordError(rec); err != nil {
+		return -1, err
+	}
+	return len(buf), nil
+}
+
+func (r *Replay) Send(_ context.Context, buf []byte) (int, error) {
+	return r.send(buf)
+}
+
+func (r *Replay) SendSensitive(_ context.Context, buf []byte) (int, error) {
+	return r.send(buf)
+}
+
+func (r *Replay) ReadUntil(_ context.Context, _ []string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, err := r.nextRecord(RecordRecv)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordError(rec); err != nil {
+		return nil, err
+	}
+	buf, _ := hex.DecodeString(rec.Data)
+	if len(buf) >= MessageHeaderSize && r.replayedSent {
+		hdr := MessageHeader(buf)
+		if hdr.ID() == r.recordedID {
+			hdr.SetID(r.sentID)
+		}
+	}
+	return buf, nil
+}
+
+func (r *Replay) Close(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next < len(r.recs) && r.recs[r.next].Dir == RecordClose {
+		rec := r.recs[r.next]
+		r.next++
+		return recordError(rec)
+	}
+	return nil
+}
@@ -7,8 +7,11 @@ package slnet
 import (
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"time"
 
 	"cloudeng.io/logging/ctxlog"
@@ -22,8 +25,22 @@ type Conn struct {
 
 type MessageHeader []byte
 
+var codeNamer = func(code uint16) string {
+	return strconv.Itoa(int(code))
+}
+
+// SetCodeNamer sets the function used to display message codes in
+// log messages. It is intended to be called by higher level packages
+// that define the message codes, it is not safe for concurrent use.
+func SetCodeNamer(fn func(code uint16) string) {
+	codeNamer = fn
+}
+
 const MessageHeaderSize = 8
 
+// ErrFraming is returned when a message header is invalid.
+var ErrFraming = errors.New("invalid message framing")
+
 func (m MessageHeader) ID() uint16 {
 	return binary.LittleEndian.Uint16(m[0:2])
 }
@@ -69,7 +86,7 @@ func (tc *Conn) Send(ctx context.Context, buf []byte) (int, error) {
 	}
 	n, err := tc.conn.Write(buf)
 	hdr := MessageHeader(buf)
-	ctxlog.Info(ctx, "screenlogic: sent", "addr", tc.addr, "id", hdr.ID(), "code", hdr.Code(), "size", hdr.Size(), "err", err)
+	ctxlog.Info(ctx, "screenlogic: sent", "addr", tc.addr, "id", hdr.ID(), "code", codeNamer(hdr.Code()), "size", hdr.Size(), "err", err)
 	return n, err
 }
 
@@ -77,18 +94,30 @@ func (tc *Conn) SendSensitive(ctx context.Context, buf []byte) (int, error) {
 	return tc.Send(ctx, buf)
 }
 
+// maxMessageSize is used to detect a loss of framing.
+const maxMessageSize = 1 << 20
+
+// readResponse reads a single framed message, the header is read first
+// to determine the size of the payload since messages may be split
+// across, or share, TCP segments.
 func (tc *Conn) readResponse() (MessageHeader, []byte, error) {
-	buf := make([]byte, 1024)
-	n, err := io.ReadAtLeast(tc.conn, buf, MessageHeaderSize)
-	if err != nil {
+	hdr := make([]byte, MessageHeaderSize)
+	if _, err := io.ReadFull(tc.conn, hdr); err != nil {
 		return nil, nil, err
 	}
-	hdr := MessageHeader(buf)
-	msgSize := hdr.Size()
-	if n < int(msgSize)+MessageHeaderSize {
-		return nil, nil, io.ErrUnexpectedEOF
+	msgSize := MessageHeader(hdr).Size()
+	if msgSize > maxMessageSize {
+		return nil, nil, fmt.Errorf("message size of %v is too large: %w", msgSize, ErrFraming)
+	}
+	buf := make([]byte, MessageHeaderSize+int(msgSize))
+	copy(buf, hdr)
+	if _, err := io.ReadFull(tc.conn, buf[MessageHeaderSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
 	}
-	return hdr, buf[:n], nil
+	return MessageHeader(buf), buf, nil
 }
 
 func (tc *Conn) ReadUntil(ctx context.Context, _ []string) ([]byte, error) {
@@ -101,7 +130,7 @@ func (tc *Conn) ReadUntil(ctx context.Context, _ []string) ([]byte, error) {
 		ctxlog.Error(ctx, "screenlogic: readUntil failed", "addr", tc.addr, "err", err)
 		return nil, err
 	}
-	ctxlog.Info(ctx, "screenlogic: readUntil", "addr", tc.addr, "id", hdr.ID(), "code", hdr.Code(), "size", hdr.Size())
+	ctxlog.Info(ctx, "screenlogic: readUntil", "addr", tc.addr, "id", hdr.ID(), "code", codeNamer(hdr.Code()), "size", hdr.Size())
 	return buf, err
 }
 
@@ -5,10 +5,13 @@
 package slnet_test
 
 import (
+	"bytes"
 	"context"
-	"embed"
-	"fmt"
+	"errors"
+	"io"
 	"net"
+	"net/netip"
+	"reflect"
 	"testing"
 	"time"
 
@@ -40,32 +43,6 @@ func runGateway(listener net.Listener, errCh chan error) {
 	}()
 }
 
-//go:embed testdata/msg_*
-var embeddedMessages embed.FS
-
-var (
-	cannedResponses = map[uint32][]byte{}
-)
-
-func init() {
-	msgs, err := embeddedMessages.ReadDir("testdata")
-	if err != nil {
-		panic(err)
-	}
-	for _, msg := range msgs {
-		var id uint32
-		_, err := fmt.Sscanf(msg.Name(), "msg_%d", &id)
-		if err != nil {
-			panic(err)
-		}
-		b, err := embeddedMessages.ReadFile(fmt.Sprintf("testdata/%s", msg.Name()))
-		if err != nil {
-			panic(err)
-		}
-		cannedResponses[id] = b
-	}
-}
-
 func (slg *screenlogicGateway) run() error {
 	for {
 		buf := make([]byte, 4096)
@@ -98,3 +75,178 @@ func TestSLConn(t *testing.T) {
 		t.Fatalf("failed to close: %v", err)
 	}
 }
+
+type cannedTransport struct {
+	replies [][]byte
+}
+
+func (ct *cannedTransport) Send(_ context.Context, buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (ct *cannedTransport) SendSensitive(ctx context.Context, buf []byte) (int, error) {
+	return ct.Send(ctx, buf)
+}
+
+func (ct *cannedTransport) ReadUntil(context.Context, []string) ([]byte, error) {
+	if len(ct.replies) == 0 {
+		return nil, io.EOF
+	}
+	r := ct.replies[0]
+	ct.replies = ct.replies[1:]
+	return r, nil
+}
+
+func (ct *cannedTransport) Close(context.Context) error {
+	return nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	req1 := protocol.NewMessage(10, protocol.MsgGetVersion, nil)
+	resp1 := protocol.NewMessage(10, protocol.MsgGetVersion+1, []byte{1, 2, 3, 4})
+	req2 := protocol.NewMessage(11, protocol.MsgGetStatus, []byte{0, 0, 0, 0})
+
+	var out bytes.Buffer
+	rec := slnet.NewRecorder(&cannedTransport{replies: [][]byte{resp1}}, &out)
+	rec.Send(ctx, []byte(protocol.ConnectString))
+	rec.Send(ctx, req1)
+	if _, err := rec.ReadUntil(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	rec.Send(ctx, req2)
+	if _, err := rec.ReadUntil(ctx, nil); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := rec.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := slnet.ReadRecording(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(recs), 6; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Replay with different message IDs.
+	replay := slnet.NewReplay(recs)
+	if _, err := replay.Send(ctx, []byte(protocol.ConnectString)); err != nil {
+		t.Fatal(err)
+	}
+	req1.SetID(20)
+	if _, err := replay.Send(ctx, req1); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := replay.ReadUntil(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := protocol.Message(buf).ID(), uint16(20); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := protocol.Message(buf).Payload(), resp1.Payload(); !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := replay.Send(ctx, req2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replay.ReadUntil(ctx, nil); err == nil || err.Error() != io.EOF.Error() {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if err := replay.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := replay.Remaining(), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Mismatches.
+	replay = slnet.NewReplay(recs)
+	if _, err := replay.Send(ctx, req1); !errors.Is(err, slnet.ErrReplayMismatch) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	replay = slnet.NewReplay(recs[1:])
+	if _, err := replay.Send(ctx, req2); !errors.Is(err, slnet.ErrReplayMismatch) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+	if _, err := replay.ReadUntil(ctx, nil); !errors.Is(err, slnet.ErrReplayMismatch) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	ctx := context.Background()
+	gl := newListener(t)
+	defer gl.Close()
+
+	m1 := protocol.NewMessage(1, protocol.MsgGetVersion+1, bytes.Repeat([]byte{1}, 2000))
+	m2 := protocol.NewMessage(2, protocol.MsgGetStatus+1, []byte{2, 2, 2, 2})
+	m3 := protocol.NewMessage(3, protocol.MsgGetConfig+1, []byte{3, 3, 3, 3})
+	go func() {
+		conn, err := gl.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// m1 is split across writes, m2 and the first half of m3 share
+		// a write and m3 is then truncated.
+		all := append(append(bytes.Clone(m1), m2...), m3[:6]...)
+		for _, w := range [][]byte{all[:3], all[3:100], all[100:]} {
+			conn.Write(w)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	conn, err := slnet.Dial(ctx, gl.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	for _, want := range [][]byte{m1, m2} {
+		got, err := conn.ReadUntil(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("got %v, want %v", got[:slnet.MessageHeaderSize], want[:slnet.MessageHeaderSize])
+		}
+	}
+	if _, err := conn.ReadUntil(ctx, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("missing or wrong error: %v", err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	want := slnet.Gateway{
+		Addr: netip.MustParseAddrPort("192.168.1.10:80"),
+		Type: 2,
+		Name: "Pentair: 00-11-22",
+	}
+	go func() {
+		buf := make([]byte, 64)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil || !slnet.IsDiscoveryRequest(buf[:n]) {
+			return
+		}
+		// Duplicate and invalid responses are ignored.
+		resp := slnet.EncodeDiscoveryResponse(want)
+		pc.WriteTo(resp, from)
+		pc.WriteTo(resp, from)
+		pc.WriteTo([]byte{1, 2, 3}, from)
+	}()
+	gws, err := slnet.Discover(ctx, pc.LocalAddr().String(), 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gws, []slnet.Gateway{want}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}